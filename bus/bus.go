@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"github.com/TykTechnologies/logrus"
 	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
 	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	"github.com/TykTechnologies/tyk-cluster-framework/tracing"
 	"strings"
 
 	"github.com/TykTechnologies/tyk-cluster-framework/client"
@@ -99,6 +101,9 @@ func (b *Bus) handleRawPayload(msg []byte) error {
 }
 
 func (b *Bus) handlePayload(msg []byte) error {
+	metrics.IncrCounter([]string{"bus", "received"}, 1)
+	metrics.IncrCounter([]string{"bus", "received_bytes"}, float32(len(msg)))
+
 	if b.rawMode {
 		return b.handleRawPayload(msg)
 	}
@@ -110,7 +115,7 @@ func (b *Bus) handlePayload(msg []byte) error {
 
 	handler, found := b.payloadHandlers[pl.GetTopic()]
 	if found {
-		handler(pl)
+		b.Dispatch(handler, pl)
 	}
 
 	return nil
@@ -162,6 +167,10 @@ func (b *Bus) Send(topic string, payload payloads.Payload) error {
 		payload.SetFrom(b.GetID())
 	}
 
+	payload = payload.Copy()
+	span := tracing.StartProducer(payload, "send "+topic)
+	defer span.End()
+
 	data, encErr := payloads.Marshal(payload, b.enc)
 	if encErr != nil {
 		return encErr
@@ -190,6 +199,9 @@ func (b *Bus) Send(topic string, payload payloads.Payload) error {
 		return fmt.Errorf("sock.Send: %s", err.Error())
 	}
 
+	metrics.IncrCounter([]string{"bus", "sent"}, 1)
+	metrics.IncrCounter([]string{"bus", "sent_bytes"}, float32(len(encodedPayload)))
+
 	return nil
 }
 
@@ -198,6 +210,7 @@ func (b *Bus) SendRaw(value []byte) error {
 	h := fmt.Sprintf("%x", md5.Sum(value))
 	if f, _ := b.dupeCache.ContainsOrAdd(h, true); f == true {
 		log.Warningf("Duplicate message to  bus (%v), ignoring\n", h)
+		metrics.IncrCounter([]string{"bus", "duplicates"}, 1)
 		return nil
 	}
 
@@ -205,5 +218,8 @@ func (b *Bus) SendRaw(value []byte) error {
 		return fmt.Errorf("sock.Send: %s", err.Error())
 	}
 
+	metrics.IncrCounter([]string{"bus", "sent"}, 1)
+	metrics.IncrCounter([]string{"bus", "sent_bytes"}, float32(len(value)))
+
 	return nil
 }
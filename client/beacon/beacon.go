@@ -29,20 +29,81 @@ import (
 	"sync"
 	"time"
 
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
 )
 
 const (
-	beaconMax       = 255
+	// beaconMax is the largest UDP payload, larger transmits are fragmented
+	beaconMax       = 65507
 	defaultInterval = 1 * time.Second
 )
 
 var (
 	ipv4Group = net.IPv4(224, 0, 0, 250)
 	ipv6Group = "ff02::fa"
+
+	errTooLarge = errors.New("transmit needs more fragments than a beacon will reassemble")
+)
+
+// IP families that a beacon can be restricted to
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// outbound is a destination for transmits and the interface to send them from
+type outbound struct {
+	ifIndex int
+	addr    *net.UDPAddr
+}
+
+const (
+	// retryBackoff is the first delay before a failed send or receive is retried, it doubles
+	// on each failure up to maxBackoff (or the transmit interval if that is shorter)
+	retryBackoff = 100 * time.Millisecond
+	maxBackoff   = 5 * time.Second
+	sendAttempts = 3
 )
 
+// transmission is a single transmit and its own broadcast schedule
+type transmission struct {
+	transmit  []byte
+	datagrams [][]byte
+	interval  time.Duration
+	next      time.Time
+	failures  int
+}
+
+// NetworkError is reported to the error handler when the beacon fails to send or receive,
+// Op is either "send" or "receive"
+type NetworkError struct {
+	Op  string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return "beacon " + e.Op + " failed: " + e.Err.Error()
+}
+
+// backoff returns the delay before the next retry after a number of consecutive failures
+func backoff(failures int, max time.Duration) time.Duration {
+	if max > maxBackoff {
+		max = maxBackoff
+	}
+
+	d := retryBackoff
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+	return d
+}
+
 // Signal contains the body of the beacon (Transmit) and the source address
 type Signal struct {
 	Addr     string
@@ -52,20 +113,29 @@ type Signal struct {
 // Beacon defines main structure of the application
 type Beacon struct {
 	signals    chan interface{}
-	ipv4Conn   *ipv4.PacketConn // UDP incoming connection for sending/receiving beacons
-	ipv6Conn   *ipv6.PacketConn // UDP incoming connection for sending/receiving beacons
-	ipv4       bool             // Whether or not connection is in ipv4 mode
-	port       int              // UDP port number we work on
-	interval   time.Duration    // Beacon broadcast interval
-	noecho     bool             // Ignore own (unique) beacons
-	terminated bool             // API shut us down
-	transmit   []byte           // Beacon transmit data
-	filter     []byte           // Beacon filter data
-	addr       string           // Our own address
+	ipv4Conn   *ipv4.PacketConn         // UDP incoming connection for sending/receiving beacons
+	ipv6Conn   *ipv6.PacketConn         // UDP incoming connection for sending/receiving beacons
+	family     string                   // Restricts the beacon to FamilyIPv4 or FamilyIPv6
+	source     net.IP                   // Address to send from, it selects the interface too
+	allIfaces  bool                     // Join and send on every suitable interface
+	outs       []outbound               // Where to send transmits in multicast and broadcast mode
+	onError    func(error)              // Called with a *NetworkError when sending or receiving fails
+	port       int                      // UDP port number we work on
+	interval   time.Duration            // Beacon broadcast interval
+	noecho     bool                     // Ignore own (unique) beacons
+	terminated bool                     // API shut us down
+	transmits  map[string]*transmission // Named transmits that are being broadcast
+	wake       chan struct{}            // Wakes the signal loop when the transmits change
+	fragSize   int                      // Largest datagram to send, transmits above this are fragmented
+	reassembly *reassembler             // Incomplete fragmented transmits from peers
+	filter     []byte                   // Beacon filter data
+	addr       string                   // Our own address
 	iface      string
 	wg         sync.WaitGroup
 	inAddr     *net.UDPAddr
 	outAddr    *net.UDPAddr
+	peers      []*net.UDPAddr // Unicast peers, when set transmits go to each instead of the group
+	broadcast  bool           // Send to the subnet broadcast address instead of the group
 	sync.Mutex
 	listening  bool
 	publishing bool
@@ -76,8 +146,12 @@ type Beacon struct {
 func New() (b *Beacon) {
 
 	b = &Beacon{
-		signals:  make(chan interface{}, 50),
-		interval: defaultInterval,
+		signals:    make(chan interface{}, 50),
+		interval:   defaultInterval,
+		transmits:  make(map[string]*transmission),
+		wake:       make(chan struct{}, 1),
+		fragSize:   defaultFragmentSize,
+		reassembly: newReassembler(defaultReassemblyTimeout),
 	}
 
 	return b
@@ -88,6 +162,17 @@ func (b *Beacon) start() (err error) {
 		return
 	}
 	b.started = true
+
+	// Let a later call try again, rather than leave the beacon half set up
+	defer func() {
+		if err != nil {
+			b.reset()
+		}
+	}()
+	if len(b.peers) > 0 {
+		return b.startUnicast()
+	}
+
 	if b.iface == "" {
 		b.iface = os.Getenv("BEACON_INTERFACE")
 	}
@@ -95,130 +180,248 @@ func (b *Beacon) start() (err error) {
 		b.iface = os.Getenv("ZSYS_INTERFACE")
 	}
 
-	var ifs []net.Interface
+	useIPv4 := b.family != FamilyIPv6
+	if useIPv4 {
+		conn, err := net.ListenPacket("udp4", net.JoinHostPort("224.0.0.0", strconv.Itoa(b.port)))
+		if err != nil && (b.family == FamilyIPv4 || b.source != nil) {
+			return err
+		}
 
-	if b.iface == "" {
-		ifs, err = net.Interfaces()
+		if err == nil {
+			b.ipv4Conn = ipv4.NewPacketConn(conn)
+			b.ipv4Conn.SetMulticastLoopback(true)
+			b.ipv4Conn.SetControlMessage(ipv4.FlagSrc, true)
+		} else {
+			// No IPv4 on this host, try IPv6 instead
+			useIPv4 = false
+		}
+	}
+
+	if !useIPv4 {
+		// Binding to the group address needs a zone for link-local groups, so bind to all addresses
+		conn, err := net.ListenPacket("udp6", net.JoinHostPort("::", strconv.Itoa(b.port)))
 		if err != nil {
 			return err
 		}
 
+		b.ipv6Conn = ipv6.NewPacketConn(conn)
+		b.ipv6Conn.SetMulticastLoopback(true)
+		b.ipv6Conn.SetControlMessage(ipv6.FlagSrc, true)
+	}
+
+	ifs, err := b.interfaces(useIPv4)
+	if err != nil {
+		return err
+	}
+
+	broadcast := b.broadcast || os.Getenv("BEACON_BROADCAST") != ""
+	if useIPv4 {
+		b.inAddr = &net.UDPAddr{IP: ipv4Group}
 	} else {
+		b.inAddr = &net.UDPAddr{IP: net.ParseIP(ipv6Group)}
+	}
+
+	var joinErr error
+	for i := range ifs {
+		iface := ifs[i]
+		ip, ipnet := interfaceAddr(iface, useIPv4, b.source)
+		if ip == nil {
+			continue
+		}
+
+		if useIPv4 {
+			joinErr = b.ipv4Conn.JoinGroup(&iface, b.inAddr)
+		} else {
+			joinErr = b.ipv6Conn.JoinGroup(&iface, b.inAddr)
+		}
+		if joinErr != nil {
+			continue
+		}
+
+		out := outbound{ifIndex: iface.Index}
+		switch {
+		case !useIPv4:
+			// IPv6 has no broadcast, the link-local group already reaches everyone on the link
+			out.addr = &net.UDPAddr{IP: b.inAddr.IP, Port: b.port, Zone: iface.Name}
+
+		case broadcast:
+			out.addr = &net.UDPAddr{IP: broadcastAddr(ipnet), Port: b.port}
+
+		case iface.Flags&net.FlagLoopback != 0:
+			out.addr = &net.UDPAddr{IP: net.IPv4allsys, Port: b.port}
+
+		default:
+			out.addr = &net.UDPAddr{IP: ipv4Group, Port: b.port}
+		}
+
+		if b.addr == "" {
+			zone := ""
+			if ip.IsLinkLocalUnicast() {
+				zone = iface.Name
+			}
+			b.addr = (&net.IPAddr{IP: ip, Zone: zone}).String()
+		}
+		b.outs = append(b.outs, out)
+	}
+
+	if len(b.outs) == 0 {
+		if joinErr != nil {
+			return joinErr
+		}
+		return errors.New("no interfaces to bind to")
+	}
+	b.outAddr = b.outs[0].addr
+
+	//go b.listen()
+	// go b.signal()
+
+	return nil
+}
+
+// interfaces returns the interfaces to join the group on: the one set with SetInterface, the one
+// that owns the source address, or the first up, multicast capable interface with an address of
+// the right family. Loopback is only used if there is nothing else, and every suitable interface
+// is used if SetAllInterfaces is on.
+func (b *Beacon) interfaces(useIPv4 bool) ([]net.Interface, error) {
+	if b.iface != "" {
 		iface, err := net.InterfaceByName(b.iface)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		ifs = append(ifs, *iface)
+		return []net.Interface{*iface}, nil
 	}
 
-	conn, err := net.ListenPacket("udp4", net.JoinHostPort("224.0.0.0", strconv.Itoa(b.port)))
-	if err == nil {
-		b.ipv4Conn = ipv4.NewPacketConn(conn)
-		b.ipv4Conn.SetMulticastLoopback(true)
-		b.ipv4Conn.SetControlMessage(ipv4.FlagSrc, true)
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
 	}
 
-	if !b.ipv4 {
-		conn, err := net.ListenPacket("udp6", net.JoinHostPort(net.IPv6linklocalallnodes.String(), strconv.Itoa(b.port)))
-		if err != nil {
-			return err
+	var suitable, loopback []net.Interface
+	for _, iface := range all {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if ip, _ := interfaceAddr(iface, useIPv4, b.source); ip == nil {
+			continue
 		}
 
-		b.ipv6Conn = ipv6.NewPacketConn(conn)
-		b.ipv6Conn.SetMulticastLoopback(true)
-		b.ipv6Conn.SetControlMessage(ipv6.FlagSrc, true)
+		switch {
+		case iface.Flags&net.FlagLoopback != 0:
+			loopback = append(loopback, iface)
+		case iface.Flags&net.FlagMulticast != 0:
+			suitable = append(suitable, iface)
+		}
 	}
 
-	broadcast := os.Getenv("BEACON_BROADCAST") != ""
+	if len(suitable) == 0 {
+		suitable = loopback
+	}
 
-	for _, iface := range ifs {
-		if b.ipv4Conn != nil {
-			b.inAddr = &net.UDPAddr{
-				IP: ipv4Group,
-			}
-			err := b.ipv4Conn.JoinGroup(&iface, b.inAddr)
-			if err != nil {
-				return err
-			}
+	if len(suitable) == 0 {
+		return nil, errors.New("no interfaces to bind to")
+	}
 
-			// Find IP of the interface
-			// TODO(armen): Let user set the ipaddress which here can be verified to be valid
-			addrs, err := iface.Addrs()
-			if err != nil {
-				return err
-			}
+	if !b.allIfaces {
+		suitable = suitable[:1]
+	}
 
-			if len(addrs) <= 0 {
-				return errors.New("no address to bind to")
-			}
+	return suitable, nil
+}
 
-			ip, ipnet, err := net.ParseCIDR(addrs[0].String())
-			if err != nil {
-				return err
-			}
-			b.addr = ip.String()
+// interfaceAddr returns the first address of iface in the right family, or source if iface owns it
+func interfaceAddr(iface net.Interface, useIPv4 bool, source net.IP) (net.IP, *net.IPNet) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, nil
+	}
 
-			switch {
-			case broadcast:
-				bcast := ipnet.IP
-				for i := 0; i < len(ipnet.Mask); i++ {
-					bcast[i] |= ^ipnet.Mask[i]
-				}
-				b.outAddr = &net.UDPAddr{IP: bcast, Port: b.port}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || (ipnet.IP.To4() != nil) != useIPv4 {
+			continue
+		}
 
-			case iface.Flags&net.FlagLoopback != 0:
-				b.outAddr = &net.UDPAddr{IP: net.IPv4allsys, Port: b.port}
+		if source != nil && !ipnet.IP.Equal(source) {
+			continue
+		}
 
-			default:
-				b.outAddr = &net.UDPAddr{IP: ipv4Group, Port: b.port}
-			}
+		return ipnet.IP, ipnet
+	}
 
-			break
-		} else if b.ipv6Conn != nil {
-			b.inAddr = &net.UDPAddr{
-				IP: net.ParseIP(ipv6Group),
-			}
-			err := b.ipv6Conn.JoinGroup(&iface, b.inAddr)
-			if err != nil {
-				return err
-			}
+	return nil, nil
+}
 
-			// Find IP of the interface
-			// TODO(armen): Let user set the ipaddress which here can be verified to be valid
-			addrs, err := iface.Addrs()
-			if err != nil {
-				return err
-			}
-			ip, ipnet, err := net.ParseCIDR(addrs[0].String())
-			if err != nil {
-				return err
-			}
-			b.addr = ip.String()
+// broadcastAddr returns the subnet broadcast address of an IPv4 network
+func broadcastAddr(ipnet *net.IPNet) net.IP {
+	ip := ipnet.IP.To4()
+	mask := ipnet.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
 
-			switch {
-			case broadcast:
-				bcast := ipnet.IP
-				for i := 0; i < len(ipnet.Mask); i++ {
-					bcast[i] |= ^ipnet.Mask[i]
-				}
-				b.outAddr = &net.UDPAddr{IP: bcast, Port: b.port}
+	bcast := make(net.IP, net.IPv4len)
+	for i := range bcast {
+		bcast[i] = ip[i] | ^mask[i]
+	}
+	return bcast
+}
 
-			case iface.Flags&net.FlagLoopback != 0:
-				b.outAddr = &net.UDPAddr{IP: net.IPv6interfacelocalallnodes, Port: b.port}
+// reset closes anything opened by a failed start, the caller must hold the lock
+func (b *Beacon) reset() {
+	if b.ipv4Conn != nil {
+		b.ipv4Conn.Close()
+	}
+	if b.ipv6Conn != nil {
+		b.ipv6Conn.Close()
+	}
 
-			default:
-				b.outAddr = &net.UDPAddr{IP: net.ParseIP(ipv6Group), Port: b.port}
-			}
-			break
+	b.ipv4Conn = nil
+	b.ipv6Conn = nil
+	b.outs = nil
+	b.outAddr = nil
+	b.addr = ""
+	b.started = false
+}
+
+// startUnicast binds to all addresses on the beacon port so that peers can reach us directly,
+// IPv6 is only used if one of the peers needs it
+func (b *Beacon) startUnicast() error {
+	useIPv4 := true
+	for _, p := range b.peers {
+		if p.IP.To4() == nil {
+			useIPv4 = false
 		}
 	}
 
-	if b.ipv4Conn == nil && b.ipv6Conn == nil {
-		return errors.New("no interfaces to bind to")
+	if useIPv4 {
+		conn, err := net.ListenPacket("udp4", net.JoinHostPort("0.0.0.0", strconv.Itoa(b.port)))
+		if err != nil {
+			return err
+		}
+		b.ipv4Conn = ipv4.NewPacketConn(conn)
+		// Close wakes the listener by sending to itself
+		b.outAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: b.port}
+	} else {
+		conn, err := net.ListenPacket("udp6", net.JoinHostPort("::", strconv.Itoa(b.port)))
+		if err != nil {
+			return err
+		}
+		b.ipv6Conn = ipv6.NewPacketConn(conn)
+		b.outAddr = &net.UDPAddr{IP: net.IPv6loopback, Port: b.port}
 	}
 
-	//go b.listen()
-	// go b.signal()
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if ok && !ipnet.IP.IsLoopback() && (ipnet.IP.To4() != nil) == useIPv4 {
+			b.addr = ipnet.IP.String()
+			break
+		}
+	}
 
 	return nil
 }
@@ -232,6 +435,7 @@ func (b *Beacon) Close() {
 		close(b.signals)
 	}
 	b.Unlock()
+	b.poke()
 
 	// Send a nil udp data to wake up listen()
 	if b.ipv4Conn != nil {
@@ -267,18 +471,108 @@ func (b *Beacon) SetInterface(iface string) *Beacon {
 	return b
 }
 
+// SetSource sets the address to send from, the beacon uses the interface that owns it and its family.
+func (b *Beacon) SetSource(source string) error {
+	ip := net.ParseIP(source)
+	if ip == nil {
+		return errors.New("invalid source address: " + source)
+	}
+
+	b.source = ip
+	return nil
+}
+
+// SetFamily restricts the beacon to FamilyIPv4 or FamilyIPv6, by default IPv4 is used if it is
+// available.
+func (b *Beacon) SetFamily(family string) error {
+	switch family {
+	case "", FamilyIPv4, FamilyIPv6:
+		b.family = family
+		return nil
+	default:
+		return errors.New("unknown IP family: " + family)
+	}
+}
+
+// SetAllInterfaces joins the group and sends transmits on every suitable interface rather than just
+// the first one, peers on any of the host's networks will hear the beacon.
+func (b *Beacon) SetAllInterfaces(all bool) *Beacon {
+	b.allIfaces = all
+	return b
+}
+
 // SetPort sets UDP port.
 func (b *Beacon) SetPort(port int) *Beacon {
 	b.port = port
 	return b
 }
 
+// SetPeers switches the beacon to unicast, transmits are sent to each peer instead of the multicast
+// group, which allows beacons to work on networks that drop multicast. Peers are host or host:port
+// addresses, the beacon port is used when the port is omitted so SetPort must be called first.
+func (b *Beacon) SetPeers(peers []string) error {
+	resolved := make([]*net.UDPAddr, 0, len(peers))
+	for _, p := range peers {
+		if _, _, err := net.SplitHostPort(p); err != nil {
+			p = net.JoinHostPort(p, strconv.Itoa(b.port))
+		}
+
+		addr, err := net.ResolveUDPAddr("udp", p)
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, addr)
+	}
+
+	b.Lock()
+	b.peers = resolved
+	b.Unlock()
+	return nil
+}
+
+// SetBroadcast sends transmits to the subnet broadcast address instead of the multicast group,
+// this is the same as setting the BEACON_BROADCAST environment variable.
+func (b *Beacon) SetBroadcast(broadcast bool) *Beacon {
+	b.broadcast = broadcast
+	return b
+}
+
 // SetInterval sets broadcast interval.
 func (b *Beacon) SetInterval(interval time.Duration) *Beacon {
 	b.interval = interval
 	return b
 }
 
+// SetFragmentSize sets the largest datagram the beacon will send, transmits that are larger are
+// split into fragments and reassembled by the receiving beacons.
+func (b *Beacon) SetFragmentSize(size int) *Beacon {
+	b.Lock()
+	defer b.Unlock()
+
+	if size < minFragmentSize {
+		size = minFragmentSize
+	}
+	if size > beaconMax {
+		size = beaconMax
+	}
+
+	b.fragSize = size
+	for _, t := range b.transmits {
+		t.datagrams = fragment(t.transmit, b.fragSize)
+	}
+	return b
+}
+
+// SetReassemblyTimeout sets how long to wait for the remaining fragments of a transmit before
+// discarding it.
+func (b *Beacon) SetReassemblyTimeout(timeout time.Duration) *Beacon {
+	b.Lock()
+	defer b.Unlock()
+
+	b.reassembly = newReassembler(timeout)
+	return b
+}
+
 // NoEcho filters out any beacon that looks exactly like ours.
 func (b *Beacon) NoEcho() *Beacon {
 	b.noecho = true
@@ -287,38 +581,154 @@ func (b *Beacon) NoEcho() *Beacon {
 
 // Publish starts broadcasting beacon to peers at the specified interval.
 func (b *Beacon) Publish(transmit []byte) error {
+	return b.PublishOn("", transmit, b.interval)
+}
+
+// PublishOn starts broadcasting a named transmit at its own interval, any number of named transmits
+// can be broadcast at the same time. Publishing to a name that is already broadcasting replaces the
+// transmit and interval without resetting its schedule.
+func (b *Beacon) PublishOn(name string, transmit []byte, interval time.Duration) error {
 	b.Lock()
 	defer b.Unlock()
-	b.transmit = transmit
+
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	datagrams := fragment(transmit, b.fragSize)
+	if len(datagrams) > maxFragments {
+		return errTooLarge
+	}
+
+	t, found := b.transmits[name]
+	if !found {
+		t = &transmission{next: time.Now().Add(interval)}
+		b.transmits[name] = t
+	}
+	t.transmit = transmit
+	t.datagrams = datagrams
+	t.interval = interval
+
+	if err := b.start(); err != nil {
+		return err
+	}
+
+	if !b.publishing {
+		b.publishing = true
+		b.wg.Add(1)
+		go b.signal()
+	}
+	b.poke()
+
+	return nil
+}
+
+// Send transmits once, straight away, without scheduling it for broadcast. Peers that miss the
+// datagram will not hear it again. Failed sends are retried a few times with a backoff before
+// the error is returned.
+func (b *Beacon) Send(transmit []byte) error {
+	b.Lock()
+	datagrams := fragment(transmit, b.fragSize)
+	if len(datagrams) > maxFragments {
+		b.Unlock()
+		return errTooLarge
+	}
 
 	err := b.start()
-	go b.signal()
+	b.Unlock()
+	if err != nil {
+		return err
+	}
 
-	return err
+	for attempt := 1; ; attempt++ {
+		b.Lock()
+		err = b.send(datagrams)
+		b.Unlock()
+
+		if err == nil || attempt == sendAttempts {
+			return err
+		}
+
+		time.Sleep(backoff(attempt, maxBackoff))
+	}
 }
 
-// Silence stops broadcasting beacon.
+// Silence stops broadcasting all transmits.
 func (b *Beacon) Silence() *Beacon {
 	b.Lock()
 	defer b.Unlock()
 
-	b.transmit = nil
+	b.transmits = make(map[string]*transmission)
 	return b
 }
 
+// SilenceOn stops broadcasting a named transmit, others are unaffected.
+func (b *Beacon) SilenceOn(name string) *Beacon {
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.transmits, name)
+	return b
+}
+
+// isOwnTransmit reports whether transmit is one that we are broadcasting
+func (b *Beacon) isOwnTransmit(transmit []byte) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, t := range b.transmits {
+		if bytes.Equal(transmit, t.transmit) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// poke wakes the signal loop so that it picks up schedule changes, it doesn't block
+func (b *Beacon) poke() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
 // Subscribe starts listening to other peers; zero-sized filter means get everything.
-func (b *Beacon) Subscribe(filter []byte) *Beacon {
+func (b *Beacon) Subscribe(filter []byte) error {
+	b.Lock()
 	b.filter = filter
 	err := b.start()
+	b.Unlock()
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	go b.listen()
+	return nil
+}
+
+// SetErrorHandler sets a function that is called with a *NetworkError when sending or receiving
+// starts to fail, the beacon keeps retrying in the background. It isn't called again until the
+// beacon has recovered and failed again.
+func (b *Beacon) SetErrorHandler(handler func(error)) *Beacon {
+	b.Lock()
+	b.onError = handler
+	b.Unlock()
 	return b
 }
 
+// report passes an error to the error handler, the caller must not hold the lock
+func (b *Beacon) report(op string, err error) {
+	b.Lock()
+	handler := b.onError
+	b.Unlock()
+
+	if handler != nil {
+		handler(&NetworkError{Op: op, Err: err})
+	}
+}
+
 // Unsubscribe stops listening to other peers.
 func (b *Beacon) Unsubscribe() *Beacon {
 	b.filter = nil
@@ -341,13 +751,16 @@ func (b *Beacon) listen() {
 	defer b.wg.Done()
 
 	var (
-		n    int
-		addr net.IP
-		err  error
+		n        int
+		src      net.Addr
+		err      error
+		failures int
 	)
 
+	// The buffer is reused, the reassembler copies anything it hands back. It has room for one byte
+	// more than the largest datagram, so that truncated ones can be told apart.
+	buff := make([]byte, beaconMax+1)
 	for {
-		buff := make([]byte, beaconMax)
 
 		b.Lock()
 		if b.terminated {
@@ -355,90 +768,178 @@ func (b *Beacon) listen() {
 			b.Unlock()
 			return
 		}
+		reassembly := b.reassembly
 		b.Unlock()
 
+		// The control message only carries the destination on receipt, the sender comes from the socket
 		if b.ipv4Conn != nil {
-			var cm *ipv4.ControlMessage
-			n, cm, _, err = b.ipv4Conn.ReadFrom(buff)
-			if err != nil || n > beaconMax || n == 0 || cm == nil {
-				continue
-			}
-			addr = cm.Src
+			n, _, src, err = b.ipv4Conn.ReadFrom(buff)
 		} else {
-			var cm *ipv6.ControlMessage
-			n, cm, _, err = b.ipv6Conn.ReadFrom(buff)
-			if err != nil || n > beaconMax || n == 0 || cm == nil {
+			n, _, src, err = b.ipv6Conn.ReadFrom(buff)
+		}
+
+		if err != nil {
+			b.Lock()
+			terminated := b.terminated
+			b.Unlock()
+			if terminated {
 				continue
 			}
-			addr = cm.Src
+
+			// Don't spin on a socket that has gone bad, e.g. when an interface goes down
+			metrics.IncrCounter([]string{"beacon", "receive_failures"}, 1)
+			failures++
+			if failures == 1 {
+				b.report("receive", err)
+			}
+			time.Sleep(backoff(failures, maxBackoff))
+			continue
+		}
+		failures = 0
+
+		if n == 0 {
+			continue
+		}
+
+		udpSrc, ok := src.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		// Link-local IPv6 addresses are useless without their zone
+		addr := &net.IPAddr{IP: udpSrc.IP, Zone: udpSrc.Zone}
+
+		// A full buffer means the datagram was truncated
+		if n > beaconMax {
+			metrics.IncrCounter([]string{"beacon", "dropped"}, 1)
+			continue
+		}
+
+		transmit, complete := reassembly.add(addr.String(), buff[:n])
+		if !complete {
+			continue
 		}
 
-		send := bytes.HasPrefix(buff[:n], b.filter)
+		send := bytes.HasPrefix(transmit, b.filter)
 		if send && b.noecho {
-			send = !bytes.Equal(buff[:n], b.transmit)
+			send = !b.isOwnTransmit(transmit)
 		}
 
 		if send && !b.terminated {
 			select {
-			case b.signals <- &Signal{addr.String(), buff[:n]}:
+			case b.signals <- &Signal{addr.String(), transmit}:
+				metrics.IncrCounter([]string{"beacon", "received"}, 1)
 			default:
+				// Nobody is reading fast enough
+				metrics.IncrCounter([]string{"beacon", "dropped"}, 1)
 			}
 		}
 	}
 }
 
+// signal broadcasts each transmit when it is due, it sleeps until the next one is due or
+// until the transmits change
 func (b *Beacon) signal() {
-	if b.publishing {
-		return
-	}
+	defer b.wg.Done()
 
-	b.publishing = true
+	for {
+		b.Lock()
+		if b.terminated {
+			b.publishing = false
+			b.Unlock()
+			return
+		}
 
-	b.wg.Add(1)
-	defer b.wg.Done()
+		var errs []error
+		now := time.Now()
+		next := now.Add(defaultInterval)
+		for _, t := range b.transmits {
+			if !now.Before(t.next) {
+				if err := b.send(t.datagrams); err != nil {
+					// Retry sooner than the interval, backing off while the network is down
+					t.failures++
+					if t.failures == 1 {
+						errs = append(errs, err)
+					}
+					t.next = now.Add(backoff(t.failures, t.interval))
+				} else {
+					t.failures = 0
+					t.next = now.Add(t.interval)
+				}
+			}
 
-	var ticker <-chan time.Time
+			if t.next.Before(next) {
+				next = t.next
+			}
+		}
+		b.Unlock()
 
-	if b.interval == 0 {
-		ticker = time.After(defaultInterval)
-	} else {
-		ticker = time.After(b.interval)
-	}
+		for _, err := range errs {
+			b.report("send", err)
+		}
 
-	for {
 		select {
-		case <-ticker:
-			b.Lock()
-			if b.terminated {
-				b.publishing = false
-				b.Unlock()
-				return
-			}
-			if b.transmit != nil {
-				// Signal other beacons
-				var err error
-				if b.ipv4Conn != nil {
-					_, err = b.ipv4Conn.WriteTo(b.transmit, nil, b.outAddr)
-				} else {
-					_, err = b.ipv6Conn.WriteTo(b.transmit, nil, b.outAddr)
-				}
+		case <-time.After(next.Sub(now)):
+		case <-b.wake:
+		}
+	}
+}
 
-				if err != nil {
-					panic(err)
-				}
+// send writes datagrams to the broadcast address, or to each peer in unicast mode, the caller
+// must hold the lock. The last error is returned, the datagrams are still sent everywhere else.
+func (b *Beacon) send(datagrams [][]byte) error {
+	outs := b.outs
+	if len(b.peers) > 0 {
+		outs = make([]outbound, len(b.peers))
+		for i, peer := range b.peers {
+			outs[i] = outbound{addr: peer}
+		}
+	}
+
+	// Signal other beacons
+	var lastErr error
+	for _, out := range outs {
+		for _, d := range datagrams {
+			// One unreachable peer or interface shouldn't stop the others from hearing us
+			if err := b.writeTo(d, out); err != nil {
+				metrics.IncrCounter([]string{"beacon", "send_failures"}, 1)
+				lastErr = err
+				break
 			}
-			b.Unlock()
+		}
+	}
+
+	return lastErr
+}
 
-			ticker = time.After(b.interval)
+// writeTo sends a datagram out of a specific interface when it has one, so that multicast isn't
+// left to the routing table
+func (b *Beacon) writeTo(datagram []byte, out outbound) error {
+	var err error
+	if b.ipv4Conn != nil {
+		var cm *ipv4.ControlMessage
+		if out.ifIndex > 0 {
+			cm = &ipv4.ControlMessage{IfIndex: out.ifIndex, Src: b.source}
+		}
+		_, err = b.ipv4Conn.WriteTo(datagram, cm, out.addr)
+	} else {
+		var cm *ipv6.ControlMessage
+		if out.ifIndex > 0 {
+			cm = &ipv6.ControlMessage{IfIndex: out.ifIndex, Src: b.source}
 		}
+		_, err = b.ipv6Conn.WriteTo(datagram, cm, out.addr)
 	}
+	return err
 }
 
-// Restart starts broadcasting beacon to peers at the specified interval again
+// Restart replaces the transmit set by Publish without interrupting the broadcast
 func (b *Beacon) Restart(transmit []byte) error {
+	interval := b.interval
+
 	b.Lock()
-	defer b.Unlock()
-	b.transmit = transmit
+	if t, found := b.transmits[""]; found {
+		interval = t.interval
+	}
+	b.Unlock()
 
-	return nil
+	return b.PublishOn("", transmit, interval)
 }
@@ -10,6 +10,7 @@ import (
 	//"runtime"
 	//"fmt"
 	"fmt"
+	"net"
 	"runtime"
 )
 
@@ -116,3 +117,230 @@ func TestBeacon(t *testing.T) {
 		time.Sleep(50 * time.Millisecond)
 	}
 }
+
+func TestBeaconChannels(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		fmt.Println("Beacon tests skipped on windows")
+		return
+	}
+
+	sender := New()
+	defer sender.Close()
+	receiver := New()
+	defer receiver.Close()
+
+	sender.SetPort(5671)
+	receiver.SetPort(5671)
+	receiver.Subscribe([]byte("CH/"))
+
+	if err := sender.PublishOn("leader", []byte("CH/LEADER"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.PublishOn("health", []byte("CH/HEALTH"), 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	received := func(d time.Duration) map[string]int {
+		counts := make(map[string]int)
+		timeout := time.After(d)
+		for {
+			select {
+			case s := <-receiver.Signals():
+				counts[string(s.(*Signal).Transmit)]++
+			case <-timeout:
+				return counts
+			}
+		}
+	}
+
+	counts := received(time.Second)
+	if counts["CH/LEADER"] == 0 || counts["CH/HEALTH"] == 0 {
+		t.Fatalf("expected both channels to broadcast, got %v", counts)
+	}
+
+	if counts["CH/LEADER"] <= counts["CH/HEALTH"] {
+		t.Fatalf("expected the faster channel to broadcast more often, got %v", counts)
+	}
+
+	sender.SilenceOn("leader")
+	time.Sleep(100 * time.Millisecond)
+	for len(receiver.Signals()) > 0 {
+		<-receiver.Signals()
+	}
+
+	counts = received(500 * time.Millisecond)
+	if counts["CH/LEADER"] != 0 {
+		t.Fatalf("expected leader channel to be silenced, got %v", counts)
+	}
+
+	if counts["CH/HEALTH"] == 0 {
+		t.Fatalf("expected health channel to keep broadcasting, got %v", counts)
+	}
+}
+
+func TestBeaconPeers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		fmt.Println("Beacon tests skipped on windows")
+		return
+	}
+
+	sender := New()
+	defer sender.Close()
+	receiver := New()
+	defer receiver.Close()
+
+	sender.SetPort(5672)
+	receiver.SetPort(5673)
+
+	// The receiver is on a different port, so only a unicast transmit can reach it
+	if err := sender.SetPeers([]string{"127.0.0.1:5673"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.SetPeers([]string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	receiver.Subscribe([]byte{})
+
+	if err := sender.PublishOn("", []byte("UNICAST"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case s := <-receiver.Signals():
+		signal := s.(*Signal)
+		if string(signal.Transmit) != "UNICAST" {
+			t.Fatalf("unexpected transmit: %v", string(signal.Transmit))
+		}
+		if signal.Addr != "127.0.0.1" {
+			t.Fatalf("expected the sender's address, got: %v", signal.Addr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no transmit received")
+	}
+}
+
+func TestBeaconInterfaces(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		fmt.Println("Beacon tests skipped on windows")
+		return
+	}
+
+	t.Run("Broadcast address", func(t *testing.T) {
+		_, ipnet, _ := net.ParseCIDR("10.1.2.3/16")
+		if got := broadcastAddr(ipnet).String(); got != "10.1.255.255" {
+			t.Fatalf("expected 10.1.255.255, got %v", got)
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		b := New()
+		if err := b.SetFamily("ipx"); err == nil {
+			t.Fatal("expected unknown family to be rejected")
+		}
+		if err := b.SetSource("not-an-ip"); err == nil {
+			t.Fatal("expected invalid source to be rejected")
+		}
+	})
+
+	t.Run("Source address", func(t *testing.T) {
+		b := New()
+		defer b.Close()
+
+		b.SetPort(5674)
+		if err := b.SetSource("127.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+		b.Subscribe([]byte("SRC"))
+
+		if b.Addr() != "127.0.0.1" {
+			t.Fatalf("expected the beacon to use the source address, got %v", b.Addr())
+		}
+
+		if err := b.PublishOn("", []byte("SRC"), 50*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case s := <-b.Signals():
+			if addr := s.(*Signal).Addr; addr != "127.0.0.1" {
+				t.Fatalf("expected transmit from 127.0.0.1, got %v", addr)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no transmit received on loopback")
+		}
+	})
+}
+
+func TestBeaconErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		fmt.Println("Beacon tests skipped on windows")
+		return
+	}
+
+	t.Run("Subscribe", func(t *testing.T) {
+		b := New()
+		defer b.Close()
+
+		b.SetPort(5676).SetInterface("tcf-missing0")
+		if err := b.Subscribe([]byte{}); err == nil {
+			t.Fatal("expected an error for a missing interface")
+		}
+
+		// A failed start can be retried
+		b.SetInterface("")
+		if err := b.SetSource("127.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Subscribe([]byte{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		errs := make(chan error, 10)
+
+		b := New()
+		defer b.Close()
+		b.SetPort(5677).SetErrorHandler(func(err error) { errs <- err })
+
+		// Sending to port zero is refused
+		if err := b.SetPeers([]string{"127.0.0.1:0"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.Send([]byte("FAIL")); err == nil {
+			t.Fatal("expected send to fail")
+		}
+
+		if err := b.PublishOn("", []byte("FAIL"), 50*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-errs:
+			if netErr, ok := err.(*NetworkError); !ok || netErr.Op != "send" {
+				t.Fatalf("expected a send error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the error handler to be called")
+		}
+
+		// Retries keep failing, but are only reported once
+		time.Sleep(300 * time.Millisecond)
+		if len(errs) != 0 {
+			t.Fatalf("expected a single report, got %v more", len(errs))
+		}
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		if d := backoff(1, time.Second); d != retryBackoff {
+			t.Fatalf("expected the first retry after %v, got %v", retryBackoff, d)
+		}
+		if d := backoff(3, time.Second); d != 4*retryBackoff {
+			t.Fatalf("expected the backoff to double, got %v", d)
+		}
+		if d := backoff(10, 300*time.Millisecond); d != 300*time.Millisecond {
+			t.Fatalf("expected the backoff to be capped, got %v", d)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package beacon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
+)
+
+const (
+	// defaultFragmentSize keeps each datagram inside a standard 1500 byte ethernet MTU
+	defaultFragmentSize = 1400
+	// minFragmentSize has to leave room for the header and at least one byte of data
+	minFragmentSize = fragmentHeaderSize + 1
+
+	defaultReassemblyTimeout = 5 * time.Second
+
+	// Limits on what a receiver will hold in memory for incomplete transmits
+	maxFragments = 1024
+	maxPartials  = 128
+	// maxPartialBytes has room for several of the largest transmits
+	maxPartialBytes = 8 << 20
+
+	fragmentHeaderSize = 16
+)
+
+// fragmentMagic marks a datagram as a fragment, transmits that fit into one datagram are sent
+// as-is so that they can still be read by beacons that do not support fragmentation
+var fragmentMagic = []byte{0x00, 'T', 'C', 'F'}
+
+type fragmentHeader struct {
+	ID    uint64
+	Index uint16
+	Total uint16
+}
+
+// fragment splits transmit into datagrams of at most size bytes
+func fragment(transmit []byte, size int) [][]byte {
+	if transmit == nil {
+		return nil
+	}
+
+	if len(transmit) <= size && !bytes.HasPrefix(transmit, fragmentMagic) {
+		return [][]byte{transmit}
+	}
+
+	// The ID only needs to be unique per sender, using a hash means that repeated
+	// broadcasts of the same transmit can fill in each other's missing fragments
+	h := fnv.New64a()
+	h.Write(transmit)
+	id := h.Sum64()
+
+	chunk := size - fragmentHeaderSize
+	total := (len(transmit) + chunk - 1) / chunk
+
+	datagrams := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * chunk
+		if end > len(transmit) {
+			end = len(transmit)
+		}
+
+		d := make([]byte, fragmentHeaderSize, fragmentHeaderSize+end-i*chunk)
+		copy(d, fragmentMagic)
+		binary.BigEndian.PutUint64(d[4:], id)
+		binary.BigEndian.PutUint16(d[12:], uint16(i))
+		binary.BigEndian.PutUint16(d[14:], uint16(total))
+		datagrams = append(datagrams, append(d, transmit[i*chunk:end]...))
+	}
+
+	return datagrams
+}
+
+// parseFragment returns the header and data of a fragment, ok is false if the datagram
+// is not a fragment
+func parseFragment(d []byte) (h fragmentHeader, data []byte, ok bool) {
+	if len(d) < fragmentHeaderSize || !bytes.HasPrefix(d, fragmentMagic) {
+		return h, nil, false
+	}
+
+	h.ID = binary.BigEndian.Uint64(d[4:])
+	h.Index = binary.BigEndian.Uint16(d[12:])
+	h.Total = binary.BigEndian.Uint16(d[14:])
+
+	return h, d[fragmentHeaderSize:], true
+}
+
+type partialKey struct {
+	addr string
+	id   uint64
+}
+
+type partialTransmit struct {
+	fragments [][]byte
+	received  int
+	size      int
+	started   time.Time
+}
+
+// reassembler collects fragments from each sender until a transmit is complete
+type reassembler struct {
+	mu       sync.Mutex
+	timeout  time.Duration
+	partials map[partialKey]*partialTransmit
+	// held is the size of the fragments in partials, which is kept under maxBytes
+	held     int
+	maxBytes int
+}
+
+func newReassembler(timeout time.Duration) *reassembler {
+	return &reassembler{
+		timeout:  timeout,
+		partials: make(map[partialKey]*partialTransmit),
+		maxBytes: maxPartialBytes,
+	}
+}
+
+// add handles a datagram from addr, it returns the full transmit once all of its fragments
+// have arrived. Datagrams that are not fragments are returned straight away. The returned
+// transmit never shares memory with d.
+func (r *reassembler) add(addr string, d []byte) ([]byte, bool) {
+	h, data, isFragment := parseFragment(d)
+	if !isFragment {
+		return append([]byte{}, d...), true
+	}
+
+	if h.Total == 0 || h.Total > maxFragments || h.Index >= h.Total {
+		metrics.IncrCounter([]string{"beacon", "fragments", "invalid"}, 1)
+		return nil, false
+	}
+
+	metrics.IncrCounter([]string{"beacon", "fragments", "received"}, 1)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+
+	key := partialKey{addr: addr, id: h.ID}
+	p, found := r.partials[key]
+	if !found {
+		if len(r.partials) >= maxPartials {
+			metrics.IncrCounter([]string{"beacon", "fragments", "dropped"}, 1)
+			return nil, false
+		}
+
+		p = &partialTransmit{
+			fragments: make([][]byte, h.Total),
+			started:   now,
+		}
+		r.partials[key] = p
+	}
+
+	if int(h.Total) != len(p.fragments) {
+		metrics.IncrCounter([]string{"beacon", "fragments", "invalid"}, 1)
+		return nil, false
+	}
+
+	if p.fragments[h.Index] == nil {
+		if r.held+len(data) > r.maxBytes {
+			if !found {
+				delete(r.partials, key)
+			}
+			metrics.IncrCounter([]string{"beacon", "fragments", "dropped"}, 1)
+			return nil, false
+		}
+
+		p.fragments[h.Index] = append([]byte{}, data...)
+		p.received++
+		p.size += len(data)
+		r.held += len(data)
+	}
+
+	if p.received < len(p.fragments) {
+		return nil, false
+	}
+
+	delete(r.partials, key)
+	r.held -= p.size
+	metrics.IncrCounter([]string{"beacon", "fragments", "reassembled"}, 1)
+
+	return bytes.Join(p.fragments, nil), true
+}
+
+// expire drops incomplete transmits that have waited longer than the timeout
+func (r *reassembler) expire(now time.Time) {
+	for k, p := range r.partials {
+		if now.Sub(p.started) > r.timeout {
+			delete(r.partials, k)
+			r.held -= p.size
+			metrics.IncrCounter([]string{"beacon", "fragments", "expired"}, 1)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package beacon
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFragment(t *testing.T) {
+	transmit := bytes.Repeat([]byte("CAPABILITY-DESCRIPTOR "), 200)
+
+	t.Run("Small transmits are not fragmented", func(t *testing.T) {
+		d := fragment([]byte("SAMPLE-BEACON"), defaultFragmentSize)
+		if len(d) != 1 || string(d[0]) != "SAMPLE-BEACON" {
+			t.Fatalf("Unexpected datagrams: %q", d)
+		}
+	})
+
+	t.Run("Reassembly", func(t *testing.T) {
+		datagrams := fragment(transmit, 512)
+		if len(datagrams) < 2 {
+			t.Fatalf("Expected transmit to be fragmented, got %v datagrams", len(datagrams))
+		}
+
+		for _, d := range datagrams {
+			if len(d) > 512 {
+				t.Fatalf("Datagram exceeds fragment size: %v", len(d))
+			}
+		}
+
+		r := newReassembler(time.Second)
+
+		// Deliver out of order with a duplicate
+		datagrams = append([][]byte{datagrams[1]}, datagrams...)
+		for i, d := range datagrams {
+			out, complete := r.add("10.0.0.1", d)
+			if complete != (i == len(datagrams)-1) {
+				t.Fatalf("Unexpected completion on datagram %v", i)
+			}
+
+			if complete && !bytes.Equal(out, transmit) {
+				t.Fatal("Reassembled transmit is wrong")
+			}
+		}
+
+		if len(r.partials) != 0 {
+			t.Fatal("Complete transmits should not be retained")
+		}
+	})
+
+	t.Run("Senders are kept apart", func(t *testing.T) {
+		datagrams := fragment(transmit, 512)
+		r := newReassembler(time.Second)
+
+		r.add("10.0.0.1", datagrams[0])
+		for _, d := range datagrams[1:] {
+			if _, complete := r.add("10.0.0.2", d); complete {
+				t.Fatal("Fragments from different senders should not be combined")
+			}
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		datagrams := fragment(transmit, 512)
+		r := newReassembler(10 * time.Millisecond)
+
+		r.add("10.0.0.1", datagrams[0])
+		time.Sleep(20 * time.Millisecond)
+
+		for _, d := range datagrams[1:] {
+			if _, complete := r.add("10.0.0.1", d); complete {
+				t.Fatal("Expired fragments should have been discarded")
+			}
+		}
+	})
+
+	t.Run("Memory budget", func(t *testing.T) {
+		datagrams := fragment(transmit, 512)
+		r := newReassembler(10 * time.Millisecond)
+		r.maxBytes = 1000
+
+		// Only the first two fragments fit, the third is dropped
+		r.add("10.0.0.1", datagrams[0])
+		r.add("10.0.0.1", datagrams[1])
+		r.add("10.0.0.2", datagrams[2])
+		if r.held != 2*(512-fragmentHeaderSize) || len(r.partials) != 1 {
+			t.Fatalf("Expected two fragments to be held, got %v bytes in %v transmits", r.held, len(r.partials))
+		}
+
+		// Expired transmits give their bytes back
+		time.Sleep(20 * time.Millisecond)
+		r.add("10.0.0.2", datagrams[2])
+		if r.held != 512-fragmentHeaderSize || len(r.partials) != 1 {
+			t.Fatalf("Expected expired fragments to be released, got %v bytes in %v transmits", r.held, len(r.partials))
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		d := fragment(transmit, 512)[0]
+		d[14], d[15] = 0, 0 // total = 0
+
+		if _, complete := newReassembler(time.Second).add("10.0.0.1", d); complete {
+			t.Fatal("Invalid fragment should be rejected")
+		}
+	})
+}
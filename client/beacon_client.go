@@ -5,7 +5,11 @@ import (
 	"github.com/TykTechnologies/logrus"
 	"github.com/TykTechnologies/tyk-cluster-framework/client/beacon"
 	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
 	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	"github.com/TykTechnologies/tyk-cluster-framework/tracing"
+	"github.com/hashicorp/golang-lru"
+	"github.com/satori/go.uuid"
 	"gopkg.in/vmihailenco/msgpack.v2"
 	"runtime"
 	"sync"
@@ -40,33 +44,55 @@ func (p *payloadMap) Get(filter string) (PayloadHandler, bool) {
 // internalised here so that some modifications could be made.
 //
 // The BeaconClient will transmit a payload over UDP at a pre-defined interval, and can
-// support multiple filters and payload handlers, Beacon will only Subscribe and Broadcast,
-// the "Publish" method is not implemented because it would not make sense with regards to how
-// Beacon is implemented.
+// support multiple filters and payload handlers. Publish sends a payload once (or PublishRepeat
+// times, receivers drop the repeats), it is meant for low-volume signalling on a LAN, as
+// delivery is not guaranteed.
 //
 // BeaconClient is not compatible with Windows hosts (yet).
 //
 // For a usage example see the `examples/beacon_broadcast/beacon_example.go` file.
 type BeaconClient struct {
 	ClientHandler
-	Interval      int
-	Port          int
-	SubscribeChan chan string
+	Interval       int
+	Port           int
+	SubscribeChan  chan string
 	UseMiniPayload bool
+	// Peers switches the beacon to unicast, transmits are sent to each peer address instead of the
+	// multicast group
+	Peers []string
+	// UseBroadcast sends to the subnet broadcast address instead of the multicast group
+	UseBroadcast bool
+	// Interface, Source and Family pick where the beacon listens and sends from, by default it
+	// uses the first multicast capable interface with an IPv4 address
+	Interface     string
+	Source        string
+	Family        string
+	AllInterfaces bool
+	// PublishRepeat is how many times Publish sends each payload, to make up for dropped datagrams
+	PublishRepeat int
 
 	beacon          *beacon.Beacon
-	publishing      bool
-	hasStarted      bool
 	listening       bool
 	Encoding        encoding.Encoding
 	payloadHandlers payloadMap
+	dupeCache       *lru.Cache
+	hookMu          sync.Mutex
+	onDisconnect    func() error
 	id              string
 }
 
+// publishRepeatDelay spaces out repeated publishes, as UDP loss tends to come in bursts
+const publishRepeatDelay = 20 * time.Millisecond
+
+// SourceAddressHeader is set on received payloads to the IP address of the node that sent them
+const SourceAddressHeader = "tcf-source-addr"
+
 // The default Beacon payload format, because we need to handle channel subscriptions manually.
+// MsgID is only set by Publish, so that repeats can be dropped, broadcasts are expected to repeat.
 type BeaconTransmit struct {
 	Channel  string
 	Transmit []byte
+	MsgID    string `msgpack:",omitempty"`
 }
 
 // Stop will stop the client
@@ -85,10 +111,79 @@ func (b *BeaconClient) GetID() string {
 	return b.id
 }
 
-// Publish is not implemented because the underlying beacon
-// library is designed for broadcasting periodically. Use the `Broadcast` method instead.
+// Publish will send a payload to the group once, or `PublishRepeat` times for reliability,
+// subscribers only handle it once. Repeats are recognised by the payload's ID, so publishing the
+// same payload again is dropped too while receivers still remember it.
 func (b *BeaconClient) Publish(filter string, p payloads.Payload) error {
-	return errors.New("Beacon only broadcasts and subscribes")
+	if TCFConfig.SetEncodingForPayloadsGlobally {
+		p.SetEncoding(b.Encoding)
+	}
+
+	p = p.Copy()
+	span := tracing.StartProducer(p, "publish "+filter)
+	defer span.End()
+
+	msgID := p.GetID()
+	if msgID == "" {
+		// Payloads made without an ID still need one to drop the repeats of this publish
+		msgID = uuid.NewV4().String()
+	}
+
+	wrappedSend, encErr := b.encodeTransmit(filter, p, msgID)
+	if encErr != nil {
+		return encErr
+	}
+
+	if len(wrappedSend) == 0 {
+		log.WithFields(logrus.Fields{
+			"prefix": "tcf.beaconclient",
+		}).Error("No data to send, not sending")
+		return nil
+	}
+
+	repeat := b.PublishRepeat
+	if repeat < 1 {
+		repeat = 1
+	}
+
+	for i := 0; i < repeat; i++ {
+		if i > 0 {
+			time.Sleep(publishRepeatDelay)
+		}
+
+		if err := b.beacon.Send(wrappedSend); err != nil {
+			return err
+		}
+	}
+
+	countPublished("beacon", len(wrappedSend))
+	return nil
+}
+
+// encodeTransmit wraps an encoded payload with its channel for sending over the beacon
+func (b *BeaconClient) encodeTransmit(filter string, payload payloads.Payload, msgID string) ([]byte, error) {
+	data, encErr := payloads.Marshal(payload, b.Encoding)
+	if encErr != nil {
+		return nil, encErr
+	}
+
+	var encodedPayload []byte
+	switch data.(type) {
+	case []byte:
+		encodedPayload = data.([]byte)
+		break
+	case string:
+		encodedPayload = []byte(data.(string))
+		break
+	default:
+		return nil, errors.New("Encoded data is not supported")
+	}
+
+	return msgpack.Marshal(BeaconTransmit{
+		Channel:  filter,
+		Transmit: encodedPayload,
+		MsgID:    msgID,
+	})
 }
 
 func (b *BeaconClient) registerHandlerForChannel(filter string, handler PayloadHandler) {
@@ -112,11 +207,25 @@ func (b *BeaconClient) handleBeaconMessage(s *beacon.Signal) {
 		return
 	}
 
-	handler, found := b.payloadHandlers.Get(beaconMsg.Channel)
+	channelHandler, found := b.payloadHandlers.Get(beaconMsg.Channel)
 
 	if !found {
 		return
 	}
+
+	if beaconMsg.MsgID != "" {
+		if seen, _ := b.dupeCache.ContainsOrAdd(beaconMsg.MsgID, true); seen {
+			metrics.IncrCounter([]string{"client", "beacon", "duplicates"}, 1)
+			return
+		}
+	}
+
+	// The source address isn't part of the signed payload, so it is added once it has been verified
+	handler := func(payload payloads.Payload) {
+		payload.SetHeader(SourceAddressHeader, s.Addr)
+		channelHandler(payload)
+	}
+
 	if b.UseMiniPayload {
 		b.HandleMiniRawMessage(beaconMsg.Transmit, handler, b.Encoding)
 		return
@@ -125,9 +234,6 @@ func (b *BeaconClient) handleBeaconMessage(s *beacon.Signal) {
 }
 
 func (b *BeaconClient) startListening(filter string) {
-	b.beacon.Subscribe([]byte{})
-	b.listening = true
-
 	select {
 	case b.SubscribeChan <- filter:
 		log.WithFields(logrus.Fields{
@@ -144,7 +250,12 @@ func (b *BeaconClient) startListening(filter string) {
 	}).Debug("Listening")
 
 	for {
-		s := <-b.beacon.Signals()
+		s, ok := <-b.beacon.Signals()
+		if !ok {
+			// The beacon has been closed
+			return
+		}
+
 		if s != nil {
 			log.WithFields(logrus.Fields{
 				"prefix": "tcf.beaconclient",
@@ -164,6 +275,11 @@ func (b *BeaconClient) Subscribe(filter string, handler PayloadHandler) (chan st
 		return b.SubscribeChan, nil
 	}
 
+	if err := b.beacon.Subscribe([]byte{}); err != nil {
+		return nil, err
+	}
+	b.listening = true
+
 	go b.startListening(filter)
 	return b.SubscribeChan, nil
 }
@@ -183,52 +299,66 @@ func (b *BeaconClient) Init(config interface{}) error {
 
 	b.beacon = beacon.New()
 	b.beacon.NoEcho()
+	b.beacon.SetErrorHandler(b.handleBeaconError)
 	b.beacon.SetPort(b.Port).SetInterval(time.Duration(b.Interval) * time.Second)
+	b.beacon.SetBroadcast(b.UseBroadcast).SetAllInterfaces(b.AllInterfaces)
+
+	if b.Interface != "" {
+		b.beacon.SetInterface(b.Interface)
+	}
+
+	if b.Source != "" {
+		if err := b.beacon.SetSource(b.Source); err != nil {
+			return err
+		}
+	}
+
+	if err := b.beacon.SetFamily(b.Family); err != nil {
+		return err
+	}
+
+	if len(b.Peers) > 0 {
+		if err := b.beacon.SetPeers(b.Peers); err != nil {
+			return err
+		}
+	}
 	b.SubscribeChan = make(chan string)
 
 	b.payloadHandlers = payloadMap{
 		payloadHandlers: make(map[string]PayloadHandler),
 	}
 
+	cache, err := lru.New(1000)
+	if err != nil {
+		return err
+	}
+	b.dupeCache = cache
+
 	return nil
 }
 
-// Broadcast will send the set payload via UDP every interval to the specified channel.
+// Broadcast will send the set payload via UDP every interval (in seconds) to the specified channel,
+// an interval of 0 uses the client's `Interval`. Each channel is broadcast independently, calling
+// Broadcast again on the same channel replaces its payload.
 func (b *BeaconClient) Broadcast(filter string, payload payloads.Payload, interval int) error {
 
 	if payload == nil {
-		b.beacon.Silence()
-		b.publishing = false
-		return nil
+		return b.StopBroadcast(filter)
 	}
 
-	if TCFConfig.SetEncodingForPayloadsGlobally {
-		b.SetEncoding(b.Encoding)
+	if interval <= 0 {
+		interval = b.Interval
 	}
 
-	data, encErr := payloads.Marshal(payload, b.Encoding)
-	if encErr != nil {
-		return encErr
-	}
-
-	var encodedPayload []byte
-	switch data.(type) {
-	case []byte:
-		encodedPayload = data.([]byte)
-		break
-	case string:
-		encodedPayload = []byte(data.(string))
-		break
-	default:
-		return errors.New("Encoded data is not supported")
+	if TCFConfig.SetEncodingForPayloadsGlobally {
+		b.SetEncoding(b.Encoding)
 	}
 
-	asPayload := BeaconTransmit{
-		Channel:  filter,
-		Transmit: encodedPayload,
-	}
+	payload = payload.Copy()
+	span := tracing.StartProducer(payload, "broadcast "+filter)
+	defer span.End()
 
-	wrappedSend, encErr := msgpack.Marshal(asPayload)
+	wrappedSend, encErr := b.encodeTransmit(filter, payload, "")
 	if encErr != nil {
 		return encErr
 	}
@@ -240,32 +370,48 @@ func (b *BeaconClient) Broadcast(filter string, payload payloads.Payload, interv
 		return nil
 	}
 
-	// We're just changing the payload, so don't start another publish.
-	if b.hasStarted {
-		b.beacon.Restart(wrappedSend)
-		return nil
-	}
-
-	log.Info("BEACON: Starting Publish")
-	pubErr := b.beacon.Publish(wrappedSend)
+	pubErr := b.beacon.PublishOn(filter, wrappedSend, time.Duration(interval)*time.Second)
 	if pubErr != nil {
 		return pubErr
 	}
 
-	b.publishing = true
-	b.hasStarted = true
+	countPublished("beacon", len(wrappedSend))
 	return nil
 
 }
 
-// StopBroadcast will stop the beacon broadcast.
+// StopBroadcast will stop the beacon broadcast on a channel, other channels keep broadcasting.
 func (b *BeaconClient) StopBroadcast(f string) error {
-	b.beacon.Silence()
-	b.publishing = false
+	b.beacon.SilenceOn(f)
 	return nil
 }
 
+// SetConnectionDropHook sets a callback for when the beacon starts failing to send or receive,
+// e.g. because an interface went down. The beacon keeps retrying, the callback is called again
+// if it recovers and then fails again.
 func (c *BeaconClient) SetConnectionDropHook(callback func() error) error {
-	// no-op
+	c.hookMu.Lock()
+	defer c.hookMu.Unlock()
+
+	c.onDisconnect = callback
 	return nil
 }
+
+func (c *BeaconClient) handleBeaconError(err error) {
+	log.WithFields(logrus.Fields{
+		"prefix": "tcf.beaconclient",
+	}).Warning(err)
+
+	// The beacon reports errors from its own goroutines
+	c.hookMu.Lock()
+	onDisconnect := c.onDisconnect
+	c.hookMu.Unlock()
+
+	if onDisconnect != nil {
+		if err := onDisconnect(); err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "tcf.beaconclient",
+			}).Error("Disconnect callback returned error: ", err)
+		}
+	}
+}
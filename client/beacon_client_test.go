@@ -65,3 +65,60 @@ func TestBeaconClient(t *testing.T) {
 	b.Stop()
 
 }
+
+func TestBeaconClientPublish(t *testing.T) {
+	var pub, sub Client
+	var err error
+	resultChan := make(chan testPayloadData, 10)
+
+	if pub, err = NewClient("beacon://0.0.0.0:9997?publish_repeat=3", encoding.JSON); err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Stop()
+
+	if sub, err = NewClient("beacon://0.0.0.0:9997", encoding.JSON); err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Stop()
+
+	ch := "tcftestbeaconpublish"
+	if _, err = sub.Subscribe(ch, func(payload payloads.Payload) {
+		var d testPayloadData
+		if err := payload.DecodeMessage(&d); err != nil {
+			t.Errorf("Decode payload failed: %v", err)
+			return
+		}
+
+		resultChan <- d
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Give the listener time to start
+	time.Sleep(100 * time.Millisecond)
+
+	var pl payloads.Payload
+	if pl, err = payloads.NewMicroPayload(testPayloadData{"One shot"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pub.Publish(ch, pl); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case v := <-resultChan:
+		if v.FullName != "One shot" {
+			t.Fatalf("Unexpected return value: %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Received no messages")
+	}
+
+	// The repeats should have been dropped
+	select {
+	case v := <-resultChan:
+		t.Fatalf("Expected a single message, got another: %v", v)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -27,10 +27,16 @@ type Client interface {
 
 // NewClient will create a new client object based on the enum provided, the object will be pre-configured
 // with the defaults needed and any custom configurations passed in for the type.
-// For `beacon`, it is possible to set an `?interval=time_in_ms` option to set the broadcast interval.
+// For `beacon`, it is possible to set an `?interval=time_in_ms` option to set the broadcast interval,
+// `?peers=host,host:port` to send to a list of peers over unicast instead of multicast, and `?broadcast=true`
+// to send to the subnet broadcast address. On hosts with several interfaces, `?interface=eth0`, `?source=ip` and
+// `?family=ipv4|ipv6` select where the beacon runs, and `?all_interfaces=true` uses every suitable interface.
+// `?publish_repeat=n` sends each published payload n times to make up for dropped datagrams.
 // For `mangos`, it is possible to set an `?disable_publisher` boolean that stops the client from creating
 // a publishing channel, this is useful for servers that run their own clients to subscribe to themselves.
 // Should be used in conjunction with the `disable_loopback` option in the server.
+// For `gossip`, the host is the UDP address to bind to, `?seeds=host:port,host:port` sets the nodes to
+// join through and `?advertise=host:port` sets the address other nodes should use to reach this one.
 func NewClient(connectionString string, baselineEncoding encoding.Encoding) (Client, error) {
 	parts := strings.Split(connectionString, "://")
 	if len(parts) < 2 {
@@ -89,14 +95,72 @@ func NewClient(connectionString string, baselineEncoding encoding.Encoding) (Cli
 			"prefix": "tcf",
 		}).Debugf("Interval is: %v\n", asInt)
 
+		var peers []string
+		if p := URL.Query().Get("peers"); p != "" {
+			peers = strings.Split(p, ",")
+		}
+
+		broadcast, _ := strconv.ParseBool(URL.Query().Get("broadcast"))
+		allInterfaces, _ := strconv.ParseBool(URL.Query().Get("all_interfaces"))
+
+		var publishRepeat int
+		if r := URL.Query().Get("publish_repeat"); r != "" {
+			if publishRepeat, err = strconv.Atoi(r); err != nil {
+				return nil, err
+			}
+		}
+
 		c := &BeaconClient{
-			Port:     portAsInt,
-			Interval: asInt,
-			id:       id,
+			Port:           portAsInt,
+			Interval:       asInt,
+			id:             id,
 			UseMiniPayload: true,
+			Peers:          peers,
+			UseBroadcast:   broadcast,
+			Interface:      URL.Query().Get("interface"),
+			Source:         URL.Query().Get("source"),
+			Family:         URL.Query().Get("family"),
+			AllInterfaces:  allInterfaces,
+			PublishRepeat:  publishRepeat,
 		}
 		c.SetEncoding(baselineEncoding)
-		c.Init(nil)
+		if initErr := c.Init(nil); initErr != nil {
+			return nil, initErr
+		}
+		return c, nil
+
+	case "gossip":
+		log.WithFields(logrus.Fields{
+			"prefix": "tcf",
+		}).Info("Using Gossip back-end")
+
+		URL, err := url.Parse(connectionString)
+		if err != nil {
+			return nil, err
+		}
+
+		if URL.Port() == "" {
+			return nil, errors.New("No port specified")
+		}
+
+		var seeds []string
+		if s := URL.Query().Get("seeds"); s != "" {
+			seeds = strings.Split(s, ",")
+		}
+
+		c := &GossipClient{
+			BindAddr:       URL.Host,
+			AdvertiseAddr:  URL.Query().Get("advertise"),
+			Seeds:          seeds,
+			id:             id,
+			UseMiniPayload: true,
+		}
+
+		c.SetEncoding(baselineEncoding)
+		if initErr := c.Init(nil); initErr != nil {
+			return nil, initErr
+		}
+
 		return c, nil
 
 	case "mangos":
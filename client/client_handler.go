@@ -3,7 +3,10 @@ package client
 import (
 	"fmt"
 	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
 	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	"github.com/TykTechnologies/tyk-cluster-framework/tracing"
+	"time"
 )
 
 // ClientHandler provides helper functions and wrappers to decode a raw message into a payload object
@@ -20,7 +23,7 @@ func (c ClientHandler) HandleRawMessage(rawMessage interface{}, payloadHandler P
 	}
 
 	// Call the registered handler
-	payloadHandler(asPayload)
+	c.Dispatch(payloadHandler, asPayload)
 	return nil
 }
 
@@ -34,19 +37,32 @@ func (c ClientHandler) HandleMiniRawMessage(rawMessage interface{}, payloadHandl
 	}
 
 	// Call the registered handler
-	payloadHandler(asPayload)
+	c.Dispatch(payloadHandler, asPayload)
 	return nil
 }
 
+// Dispatch will call the payload handler inside a consumer span, the handler can continue the
+// trace with tracing.Extract(ctx, payload)
+func (c ClientHandler) Dispatch(payloadHandler PayloadHandler, payload payloads.Payload) {
+	span := tracing.StartConsumer(payload, "process "+payload.GetTopic())
+	defer span.End()
+	defer metrics.MeasureSince([]string{"client", "handler", "latency"}, time.Now())
+
+	payloadHandler(payload)
+}
+
 // GetPayload will extract the payload object from the message
 func (c ClientHandler) GetPayload(rawMessage interface{}, enc encoding.Encoding) (payloads.Payload, error) {
 	msgHandler := NewMessageHandler()
+	countReceived(rawMessage)
 	asPayload, err := msgHandler.HandleRawMessage(rawMessage, enc)
 	if err != nil {
+		metrics.IncrCounter([]string{"client", "decode_failures"}, 1)
 		return nil, err
 	}
 
 	if err = asPayload.Verify(); err != nil {
+		metrics.IncrCounter([]string{"client", "verify_failures"}, 1)
 		return nil, fmt.Errorf("Payload verification failed: %v", err)
 	}
 
@@ -56,14 +72,29 @@ func (c ClientHandler) GetPayload(rawMessage interface{}, enc encoding.Encoding)
 // GetMiniPayload will extract the payload object from the message into a smaller object
 func (c ClientHandler) GetMiniPayload(rawMessage interface{}, enc encoding.Encoding) (payloads.Payload, error) {
 	msgHandler := &MiniMessageHandler{}
+	countReceived(rawMessage)
 	asPayload, err := msgHandler.HandleRawMessage(rawMessage, enc)
 	if err != nil {
+		metrics.IncrCounter([]string{"client", "decode_failures"}, 1)
 		return nil, err
 	}
 
 	if err = asPayload.Verify(); err != nil {
+		metrics.IncrCounter([]string{"client", "verify_failures"}, 1)
 		return nil, fmt.Errorf("Payload verification failed: %v", err)
 	}
 
 	return asPayload, nil
-}
\ No newline at end of file
+}
+
+func countPublished(transport string, size int) {
+	metrics.IncrCounter([]string{"client", transport, "published"}, 1)
+	metrics.IncrCounter([]string{"client", transport, "published_bytes"}, float32(size))
+}
+
+func countReceived(rawMessage interface{}) {
+	metrics.IncrCounter([]string{"client", "received"}, 1)
+	if asBytes, ok := rawMessage.([]byte); ok {
+		metrics.IncrCounter([]string{"client", "received_bytes"}, float32(len(asBytes)))
+	}
+}
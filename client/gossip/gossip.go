@@ -0,0 +1,751 @@
+// Package gossip implements SWIM-style cluster membership over UDP unicast, so that nodes can find
+// each other on networks where multicast is not available (e.g. cloud VPCs and Kubernetes).
+//
+// Each node periodically probes a random member. If the member does not acknowledge in time,
+// other members are asked to probe it indirectly, and only if that fails too is it suspected.
+// Suspected members that do not refute the suspicion (by gossiping a higher incarnation number)
+// are declared dead. Membership changes are piggy-backed on the probe traffic.
+//
+// See "SWIM: Scalable Weakly-consistent Infection-style Process Group Membership Protocol"
+// by Das, Gupta and Motivala.
+package gossip
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
+	logger "github.com/TykTechnologies/tykcommon-logger"
+)
+
+var log = logger.GetLogger()
+
+const (
+	// maxDatagram is the largest UDP payload
+	maxDatagram = 65507
+
+	defaultProbeInterval  = 1 * time.Second
+	defaultProbeTimeout   = 500 * time.Millisecond
+	defaultIndirectChecks = 3
+	defaultSuspicionMult  = 4
+	defaultRetransmitMult = 4
+	defaultMaxPiggyback   = 8
+	defaultDeadReclaim    = 30 * time.Second
+
+	// maxIndirectProbes is how many probes a node runs at once on behalf of others, requests beyond
+	// it are dropped and the requester counts the member as unreachable through this node
+	maxIndirectProbes = 64
+)
+
+// ErrTooLarge is returned when a user message does not fit into a single datagram
+var ErrTooLarge = errors.New("message is too large to send over gossip")
+
+// Config configures a gossip node, only ID and BindAddr are required
+type Config struct {
+	ID string
+	// BindAddr is the UDP host:port to listen on
+	BindAddr string
+	// AdvertiseAddr is the host:port that other nodes should use to reach this one, it defaults
+	// to BindAddr, or the first private address of this host if BindAddr is unspecified
+	AdvertiseAddr string
+	// Seeds are the host:port addresses of nodes to join through
+	Seeds []string
+
+	ProbeInterval  time.Duration
+	ProbeTimeout   time.Duration
+	IndirectChecks int
+	// SuspicionMult is the number of probe intervals a suspected member has to refute the suspicion
+	SuspicionMult int
+	// RetransmitMult scales how many times each update is piggy-backed
+	RetransmitMult int
+	MaxPiggyback   int
+	// DeadReclaim is how long dead members are remembered (so that stale alive messages are ignored)
+	DeadReclaim time.Duration
+}
+
+// EventType describes a membership change
+type EventType int
+
+const (
+	EventJoin EventType = iota
+	EventSuspect
+	EventLeave
+)
+
+// Event is emitted when the state of a member changes
+type Event struct {
+	Type   EventType
+	Member Member
+}
+
+// MessageHandler is called for every user message received
+type MessageHandler func(channel string, data []byte, from Member)
+
+// Node is a member of a gossip cluster
+type Node struct {
+	conf Config
+	conn *net.UDPConn
+
+	mu      sync.RWMutex
+	self    *Member
+	members map[string]*Member
+	timers  map[string]*time.Timer
+	order   []string
+	// next is the position in order of the next member to probe
+	next int
+
+	seq     uint32
+	ackMu   sync.Mutex
+	acks    map[uint32]chan struct{}
+	queue   *updateQueue
+	handler MessageHandler
+	events  chan Event
+
+	indirect chan struct{}
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a node, call Start to bind and join the cluster
+func New(conf Config) (*Node, error) {
+	if conf.ID == "" {
+		return nil, errors.New("Node ID is required")
+	}
+	if conf.BindAddr == "" {
+		return nil, errors.New("Bind address is required")
+	}
+	if conf.ProbeInterval <= 0 {
+		conf.ProbeInterval = defaultProbeInterval
+	}
+	if conf.ProbeTimeout <= 0 || conf.ProbeTimeout >= conf.ProbeInterval {
+		conf.ProbeTimeout = conf.ProbeInterval / 2
+	}
+	if conf.IndirectChecks <= 0 {
+		conf.IndirectChecks = defaultIndirectChecks
+	}
+	if conf.SuspicionMult <= 0 {
+		conf.SuspicionMult = defaultSuspicionMult
+	}
+	if conf.RetransmitMult <= 0 {
+		conf.RetransmitMult = defaultRetransmitMult
+	}
+	if conf.MaxPiggyback <= 0 {
+		conf.MaxPiggyback = defaultMaxPiggyback
+	}
+	if conf.DeadReclaim <= 0 {
+		conf.DeadReclaim = defaultDeadReclaim
+	}
+
+	return &Node{
+		conf:    conf,
+		members: make(map[string]*Member),
+		timers:  make(map[string]*time.Timer),
+		acks:    make(map[uint32]chan struct{}),
+		queue:   newUpdateQueue(conf.RetransmitMult),
+		events:  make(chan Event, 64),
+
+		indirect: make(chan struct{}, maxIndirectProbes),
+	}, nil
+}
+
+// SetMessageHandler sets the function that receives user messages
+func (n *Node) SetMessageHandler(h MessageHandler) {
+	n.mu.Lock()
+	n.handler = h
+	n.mu.Unlock()
+}
+
+// Events returns the channel that membership events are sent on, events are dropped if it is
+// not read fast enough
+func (n *Node) Events() <-chan Event {
+	return n.events
+}
+
+// Start binds the UDP socket and starts joining the cluster through the seeds, it does not
+// wait for the join to complete
+func (n *Node) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", n.conf.BindAddr)
+	if err != nil {
+		return err
+	}
+
+	if n.conn, err = net.ListenUDP("udp", addr); err != nil {
+		return err
+	}
+
+	advertise := n.conf.AdvertiseAddr
+	if advertise == "" {
+		if advertise, err = defaultAdvertiseAddr(n.conn.LocalAddr().(*net.UDPAddr)); err != nil {
+			n.conn.Close()
+			return err
+		}
+	}
+
+	// Incarnations start from the clock so that a restarted node supersedes its old self
+	n.self = &Member{
+		ID:          n.conf.ID,
+		Addr:        advertise,
+		State:       StateAlive,
+		Incarnation: uint64(time.Now().UnixNano()),
+		StateChange: time.Now(),
+	}
+
+	n.stop = make(chan struct{})
+	n.wg.Add(2)
+	go n.receive()
+	go n.probeLoop()
+
+	n.join()
+	return nil
+}
+
+// Addr returns the address this node advertises
+func (n *Node) Addr() string {
+	return n.self.Addr
+}
+
+// Leave tells the cluster that this node is leaving and stops it
+func (n *Node) Leave() error {
+	n.mu.Lock()
+	n.self.Incarnation++
+	n.self.State = StateLeft
+	leaving := n.self.update()
+	targets := n.aliveMembers("")
+	n.mu.Unlock()
+
+	for _, m := range targets {
+		n.send(m.Addr, &message{Type: msgGossip, Updates: []update{leaving}})
+	}
+
+	return n.Stop()
+}
+
+// Stop shuts the node down without telling the cluster, it will be detected as failed
+func (n *Node) Stop() error {
+	if n.stop == nil {
+		return nil
+	}
+
+	close(n.stop)
+	err := n.conn.Close()
+	n.wg.Wait()
+	n.stop = nil
+
+	n.mu.Lock()
+	for id, t := range n.timers {
+		t.Stop()
+		delete(n.timers, id)
+	}
+	n.mu.Unlock()
+
+	return err
+}
+
+// Members returns a snapshot of the alive and suspected members, not including this node
+func (n *Node) Members() []Member {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	members := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		if m.State == StateAlive || m.State == StateSuspect {
+			members = append(members, *m)
+		}
+	}
+
+	return members
+}
+
+// SendToAll sends a user message to every alive member
+func (n *Node) SendToAll(channel string, data []byte) error {
+	n.mu.RLock()
+	targets := n.aliveMembers("")
+	n.mu.RUnlock()
+
+	var lastErr error
+	for _, m := range targets {
+		if err := n.send(m.Addr, &message{Type: msgUser, Channel: channel, Data: data}); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// join asks each seed for its member list, it is repeated by the probe loop until we know of
+// at least one other member
+func (n *Node) join() {
+	n.mu.RLock()
+	self := n.self.update()
+	n.mu.RUnlock()
+
+	for _, seed := range n.conf.Seeds {
+		if seed == n.self.Addr || seed == n.conf.BindAddr {
+			continue
+		}
+		n.send(seed, &message{Type: msgSync, Updates: []update{self}})
+	}
+}
+
+func (n *Node) receive() {
+	defer n.wg.Done()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-n.stop:
+				return
+			default:
+			}
+
+			log.WithFields(logrus.Fields{
+				"prefix": "tcf.gossip",
+			}).Error("Failed to read: ", err)
+			continue
+		}
+
+		msg, err := decodeMessage(buf[:size])
+		if err != nil {
+			metrics.IncrCounter([]string{"gossip", "decode_failures"}, 1)
+			continue
+		}
+
+		n.handleMessage(msg, from)
+	}
+}
+
+func (n *Node) handleMessage(msg *message, from *net.UDPAddr) {
+	for _, u := range msg.Updates {
+		n.apply(u)
+	}
+
+	switch msg.Type {
+	case msgPing:
+		if msg.Target != "" && msg.Target != n.conf.ID {
+			// Meant for a node that used to have our address
+			return
+		}
+		n.send(from.String(), &message{Type: msgAck, Seq: msg.Seq})
+
+	case msgPingReq:
+		select {
+		case n.indirect <- struct{}{}:
+			go func() {
+				defer func() { <-n.indirect }()
+				n.probeFor(msg, from.String())
+			}()
+		default:
+			metrics.IncrCounter([]string{"gossip", "probes", "refused"}, 1)
+		}
+
+	case msgAck:
+		n.ackMu.Lock()
+		ch, found := n.acks[msg.Seq]
+		n.ackMu.Unlock()
+
+		if found {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+
+	case msgSync:
+		n.mu.RLock()
+		state := make([]update, 0, len(n.members)+1)
+		state = append(state, n.self.update())
+		for _, m := range n.members {
+			state = append(state, m.update())
+		}
+		n.mu.RUnlock()
+
+		n.sendRaw(from.String(), &message{Type: msgSyncAck, From: n.conf.ID, Updates: state})
+
+	case msgUser:
+		n.mu.RLock()
+		sender, found := n.members[msg.From]
+		var m Member
+		if found {
+			m = *sender
+		}
+		handler := n.handler
+		n.mu.RUnlock()
+
+		if !found {
+			m = Member{ID: msg.From, Addr: from.String()}
+		}
+
+		metrics.IncrCounter([]string{"gossip", "messages", "received"}, 1)
+		if handler != nil {
+			handler(msg.Channel, msg.Data, m)
+		}
+	}
+}
+
+// apply merges an update into the member table
+func (n *Node) apply(u update) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if u.ID == n.conf.ID {
+		n.refute(u)
+		return
+	}
+
+	m := n.members[u.ID]
+	if !u.supersedes(m) {
+		return
+	}
+
+	isNew := m == nil || m.State == StateDead || m.State == StateLeft
+	if m == nil {
+		m = &Member{ID: u.ID}
+		n.members[u.ID] = m
+		n.order = append(n.order, u.ID)
+	}
+
+	m.Addr = firstNonEmpty(u.Addr, m.Addr)
+	m.State = u.State
+	m.Incarnation = u.Incarnation
+	m.StateChange = time.Now()
+	n.queue.push(m.update())
+
+	if t, found := n.timers[m.ID]; found {
+		t.Stop()
+		delete(n.timers, m.ID)
+	}
+
+	switch m.State {
+	case StateAlive:
+		if isNew {
+			n.emit(EventJoin, m)
+		}
+	case StateSuspect:
+		n.emit(EventSuspect, m)
+		n.startSuspicion(m.ID, m.Incarnation)
+	case StateDead, StateLeft:
+		n.emit(EventLeave, m)
+		n.scheduleReclaim(m.ID, m.Incarnation)
+	}
+
+	n.reportMembers()
+}
+
+// refute handles gossip about this node, if anyone thinks we are not alive we raise our
+// incarnation so that the alive message supersedes theirs. The lock must be held.
+func (n *Node) refute(u update) {
+	if u.State == StateAlive || n.self.State == StateLeft || u.Incarnation < n.self.Incarnation {
+		return
+	}
+
+	n.self.Incarnation = u.Incarnation + 1
+	n.queue.push(n.self.update())
+	metrics.IncrCounter([]string{"gossip", "refutes"}, 1)
+}
+
+// startSuspicion declares a member dead if it does not refute the suspicion in time. The lock
+// must be held.
+func (n *Node) startSuspicion(id string, incarnation uint64) {
+	timeout := time.Duration(n.conf.SuspicionMult) * n.conf.ProbeInterval
+	n.timers[id] = time.AfterFunc(timeout, func() {
+		n.mu.RLock()
+		m, found := n.members[id]
+		stillSuspect := found && m.State == StateSuspect && m.Incarnation == incarnation
+		n.mu.RUnlock()
+
+		if stillSuspect {
+			n.apply(update{ID: id, State: StateDead, Incarnation: incarnation})
+		}
+	})
+}
+
+// scheduleReclaim forgets a dead member once stale messages about it can no longer arrive. The
+// lock must be held.
+func (n *Node) scheduleReclaim(id string, incarnation uint64) {
+	n.timers[id] = time.AfterFunc(n.conf.DeadReclaim, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+
+		m, found := n.members[id]
+		if !found || m.Incarnation != incarnation || (m.State != StateDead && m.State != StateLeft) {
+			return
+		}
+
+		delete(n.members, id)
+		delete(n.timers, id)
+		for i, oid := range n.order {
+			if oid == id {
+				n.order = append(n.order[:i], n.order[i+1:]...)
+				if i < n.next {
+					n.next--
+				}
+				break
+			}
+		}
+	})
+}
+
+func (n *Node) probeLoop() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.conf.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+
+		n.mu.RLock()
+		alone := len(n.aliveMembers("")) == 0
+		n.mu.RUnlock()
+
+		if alone {
+			n.join()
+			continue
+		}
+
+		n.probe()
+		n.gossip()
+	}
+}
+
+// probe checks the next member in the round-robin order, first directly, then through others
+func (n *Node) probe() {
+	target, found := n.nextTarget()
+	if !found {
+		return
+	}
+
+	seq, ackCh := n.registerAck()
+	defer n.deregisterAck(seq)
+
+	n.send(target.Addr, &message{Type: msgPing, Seq: seq, Target: target.ID})
+
+	select {
+	case <-ackCh:
+		return
+	case <-time.After(n.conf.ProbeTimeout):
+	case <-n.stop:
+		return
+	}
+
+	metrics.IncrCounter([]string{"gossip", "probes", "indirect"}, 1)
+
+	n.mu.RLock()
+	helpers := n.aliveMembers(target.ID)
+	n.mu.RUnlock()
+
+	shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	if len(helpers) > n.conf.IndirectChecks {
+		helpers = helpers[:n.conf.IndirectChecks]
+	}
+
+	for _, h := range helpers {
+		n.send(h.Addr, &message{Type: msgPingReq, Seq: seq, Target: target.ID, TargetAddr: target.Addr})
+	}
+
+	select {
+	case <-ackCh:
+		return
+	case <-time.After(n.conf.ProbeInterval - n.conf.ProbeTimeout):
+	case <-n.stop:
+		return
+	}
+
+	metrics.IncrCounter([]string{"gossip", "probes", "failed"}, 1)
+	n.apply(update{ID: target.ID, State: StateSuspect, Incarnation: target.Incarnation})
+}
+
+// probeFor probes a member on behalf of another node and forwards the ack if there is one
+func (n *Node) probeFor(req *message, requester string) {
+	seq, ackCh := n.registerAck()
+	defer n.deregisterAck(seq)
+
+	n.send(req.TargetAddr, &message{Type: msgPing, Seq: seq, Target: req.Target})
+
+	select {
+	case <-ackCh:
+		n.send(requester, &message{Type: msgAck, Seq: req.Seq})
+	case <-time.After(n.conf.ProbeTimeout):
+	case <-n.stop:
+	}
+}
+
+// gossip pushes pending updates to a few random members so that they spread faster than they
+// would on probe traffic alone
+func (n *Node) gossip() {
+	if n.queue.len() == 0 {
+		return
+	}
+
+	n.mu.RLock()
+	targets := n.aliveMembers("")
+	n.mu.RUnlock()
+
+	shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	if len(targets) > n.conf.IndirectChecks {
+		targets = targets[:n.conf.IndirectChecks]
+	}
+
+	for _, m := range targets {
+		n.send(m.Addr, &message{Type: msgGossip})
+	}
+}
+
+// nextTarget returns the next alive or suspected member to probe, the order is reshuffled after
+// each round so that every member is probed once per round
+func (n *Node) nextTarget() (Member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i := 0; i < len(n.order); i++ {
+		if n.next >= len(n.order) {
+			shuffle(len(n.order), func(i, j int) { n.order[i], n.order[j] = n.order[j], n.order[i] })
+			n.next = 0
+		}
+
+		id := n.order[n.next]
+		n.next++
+
+		m := n.members[id]
+		if m != nil && (m.State == StateAlive || m.State == StateSuspect) {
+			return *m, true
+		}
+	}
+
+	return Member{}, false
+}
+
+// aliveMembers returns the alive members except the one with the ID exclude. The lock must be held.
+func (n *Node) aliveMembers(exclude string) []Member {
+	members := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		if m.State == StateAlive && m.ID != exclude {
+			members = append(members, *m)
+		}
+	}
+
+	return members
+}
+
+// shuffle randomises the order of n elements, rand.Shuffle needs a newer Go than the vendored x/net
+// builds with
+func shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, rand.Intn(i+1))
+	}
+}
+
+func (n *Node) registerAck() (uint32, chan struct{}) {
+	seq := atomic.AddUint32(&n.seq, 1)
+	ch := make(chan struct{}, 1)
+
+	n.ackMu.Lock()
+	n.acks[seq] = ch
+	n.ackMu.Unlock()
+
+	return seq, ch
+}
+
+func (n *Node) deregisterAck(seq uint32) {
+	n.ackMu.Lock()
+	delete(n.acks, seq)
+	n.ackMu.Unlock()
+}
+
+// send piggy-backs pending updates onto msg and sends it to addr
+func (n *Node) send(addr string, msg *message) error {
+	n.mu.RLock()
+	size := len(n.members) + 1
+	n.mu.RUnlock()
+
+	msg.Updates = append(msg.Updates, n.queue.next(n.conf.MaxPiggyback, size)...)
+	return n.sendRaw(addr, msg)
+}
+
+func (n *Node) sendRaw(addr string, msg *message) error {
+	msg.From = n.conf.ID
+
+	b, err := encodeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(b) > maxDatagram {
+		return ErrTooLarge
+	}
+
+	to, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	if _, err = n.conn.WriteToUDP(b, to); err != nil {
+		metrics.IncrCounter([]string{"gossip", "send_failures"}, 1)
+		return err
+	}
+
+	return nil
+}
+
+// emit sends an event without blocking. The lock must be held.
+func (n *Node) emit(t EventType, m *Member) {
+	log.WithFields(logrus.Fields{
+		"prefix": "tcf.gossip",
+	}).Debugf("Member %v (%v) is %v", m.ID, m.Addr, m.State)
+
+	select {
+	case n.events <- Event{Type: t, Member: *m}:
+	default:
+		metrics.IncrCounter([]string{"gossip", "events", "dropped"}, 1)
+	}
+}
+
+// reportMembers updates the member gauge. The lock must be held.
+func (n *Node) reportMembers() {
+	metrics.SetGauge([]string{"gossip", "members"}, float32(len(n.aliveMembers(""))))
+}
+
+// defaultAdvertiseAddr uses the bound address, or the first non-loopback address if the node is
+// bound to all interfaces
+func defaultAdvertiseAddr(bound *net.UDPAddr) (string, error) {
+	port := strconv.Itoa(bound.Port)
+	if !bound.IP.IsUnspecified() {
+		return net.JoinHostPort(bound.IP.String(), port), nil
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			return net.JoinHostPort(ipnet.IP.String(), port), nil
+		}
+	}
+
+	return "", errors.New("No address to advertise, set an advertise address")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package gossip
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func startNode(t *testing.T, id string, seeds ...string) *Node {
+	n, err := New(Config{
+		ID:            id,
+		BindAddr:      "127.0.0.1:0",
+		Seeds:         seeds,
+		ProbeInterval: 50 * time.Millisecond,
+		ProbeTimeout:  20 * time.Millisecond,
+		SuspicionMult: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %v", what)
+}
+
+func hasMembers(n *Node, count int) func() bool {
+	return func() bool {
+		alive := 0
+		for _, m := range n.Members() {
+			if m.State == StateAlive {
+				alive++
+			}
+		}
+		return alive == count
+	}
+}
+
+func TestSupersedes(t *testing.T) {
+	alive := &Member{ID: "a", State: StateAlive, Incarnation: 2}
+	suspect := &Member{ID: "a", State: StateSuspect, Incarnation: 2}
+	dead := &Member{ID: "a", State: StateDead, Incarnation: 2}
+
+	tests := []struct {
+		u      update
+		m      *Member
+		expect bool
+	}{
+		{update{State: StateAlive, Incarnation: 1}, nil, true},
+		{update{State: StateSuspect, Incarnation: 1}, nil, false},
+		{update{State: StateAlive, Incarnation: 2}, alive, false},
+		{update{State: StateAlive, Incarnation: 3}, alive, true},
+		{update{State: StateSuspect, Incarnation: 2}, alive, true},
+		{update{State: StateSuspect, Incarnation: 1}, alive, false},
+		{update{State: StateSuspect, Incarnation: 2}, suspect, false},
+		{update{State: StateAlive, Incarnation: 3}, suspect, true},
+		{update{State: StateDead, Incarnation: 2}, suspect, true},
+		{update{State: StateSuspect, Incarnation: 3}, dead, false},
+		{update{State: StateDead, Incarnation: 3}, dead, false},
+		{update{State: StateAlive, Incarnation: 3}, dead, true},
+	}
+
+	for _, tc := range tests {
+		if got := tc.u.supersedes(tc.m); got != tc.expect {
+			var state string
+			if tc.m != nil {
+				state = fmt.Sprintf("%v/%v", tc.m.State, tc.m.Incarnation)
+			}
+			t.Errorf("%v/%v over %v: expected %v, got %v", tc.u.State, tc.u.Incarnation, state, tc.expect, got)
+		}
+	}
+}
+
+func TestUpdateQueue(t *testing.T) {
+	q := newUpdateQueue(2)
+	q.push(update{ID: "a", Incarnation: 1})
+	q.push(update{ID: "a", Incarnation: 2})
+	q.push(update{ID: "b"})
+
+	if q.len() != 2 {
+		t.Fatalf("Expected newer updates to replace older ones, got %v queued", q.len())
+	}
+
+	if got := q.next(1, 9); len(got) != 1 {
+		t.Fatalf("Expected max to be respected, got: %v", got)
+	}
+
+	// A cluster of 9 gives a limit of 2 transmits, so after three more rounds everything is sent
+	sent := 0
+	for i := 0; i < 3; i++ {
+		for _, u := range q.next(8, 9) {
+			if u.ID == "a" && u.Incarnation != 2 {
+				t.Fatalf("Expected latest update, got: %v", u)
+			}
+			sent++
+		}
+	}
+
+	if sent != 3 || q.len() != 0 {
+		t.Fatalf("Expected 3 more transmits and an empty queue, got %v and %v", sent, q.len())
+	}
+}
+
+func TestNextTarget(t *testing.T) {
+	n, err := New(Config{ID: "self", BindAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		n.apply(update{ID: fmt.Sprint(i), Addr: fmt.Sprintf("127.0.0.1:%d", 9000+i), State: StateAlive})
+	}
+
+	// Every member is probed once per round, in a new order each round
+	orders := make(map[string]bool)
+	for round := 0; round < 10; round++ {
+		seen := make(map[string]bool)
+		order := ""
+		for i := 0; i < 8; i++ {
+			m, found := n.nextTarget()
+			if !found || seen[m.ID] {
+				t.Fatalf("Expected each member once in round %v, got %v after %v", round, m.ID, order)
+			}
+			seen[m.ID] = true
+			order += m.ID
+		}
+		orders[order] = true
+	}
+
+	if len(orders) == 1 {
+		t.Fatal("Expected the order to be reshuffled between rounds")
+	}
+}
+
+func TestGossip(t *testing.T) {
+	n1 := startNode(t, "n1")
+	defer n1.Stop()
+
+	n2 := startNode(t, "n2", n1.Addr())
+	defer n2.Stop()
+
+	n3 := startNode(t, "n3", n1.Addr())
+
+	t.Run("Join", func(t *testing.T) {
+		waitFor(t, "n1 to see both members", hasMembers(n1, 2))
+		// n2 and n3 only know about each other through gossip
+		waitFor(t, "n2 to see both members", hasMembers(n2, 2))
+		waitFor(t, "n3 to see both members", hasMembers(n3, 2))
+	})
+
+	t.Run("Messages", func(t *testing.T) {
+		received := make(chan string, 2)
+		n2.SetMessageHandler(func(channel string, data []byte, from Member) {
+			received <- channel + ":" + string(data) + ":" + from.ID
+		})
+
+		if err := n1.SendToAll("test", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case got := <-received:
+			if got != "test:hello:n1" {
+				t.Fatalf("Unexpected message: %v", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Message not received")
+		}
+	})
+
+	t.Run("Failure detection", func(t *testing.T) {
+		n3.Stop()
+
+		waitFor(t, "n3 to be declared dead", func() bool {
+			for _, m := range n1.Members() {
+				if m.ID == "n3" {
+					return false
+				}
+			}
+			return len(n1.Members()) == 1
+		})
+
+		waitFor(t, "n2 to hear n3 is dead", hasMembers(n2, 1))
+	})
+
+	t.Run("Leave", func(t *testing.T) {
+		if err := n2.Leave(); err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, "n1 to see n2 leave", hasMembers(n1, 0))
+
+		var left bool
+		for len(n1.Events()) > 0 && !left {
+			e := <-n1.Events()
+			left = e.Type == EventLeave && e.Member.ID == "n2" && e.Member.State == StateLeft
+		}
+
+		if !left {
+			t.Fatal("Expected a leave event for n2")
+		}
+	})
+}
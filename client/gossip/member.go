@@ -0,0 +1,80 @@
+package gossip
+
+import (
+	"time"
+)
+
+// State is the state of a member as seen by this node
+type State uint8
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+	StateLeft
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	default:
+		return "unknown"
+	}
+}
+
+// Member is a node in the gossip cluster
+type Member struct {
+	ID          string
+	Addr        string
+	State       State
+	Incarnation uint64
+	StateChange time.Time
+}
+
+// update is a change to a member's state, updates are piggy-backed on protocol messages
+type update struct {
+	ID          string `msgpack:"i"`
+	Addr        string `msgpack:"a,omitempty"`
+	State       State  `msgpack:"s"`
+	Incarnation uint64 `msgpack:"n"`
+}
+
+func (m *Member) update() update {
+	return update{ID: m.ID, Addr: m.Addr, State: m.State, Incarnation: m.Incarnation}
+}
+
+// supersedes reports whether u should replace the current state of m, this follows the
+// precedence rules from the SWIM paper: a higher incarnation always wins for alive, suspicion
+// overrides alive at the same incarnation, and death overrides everything at the same incarnation.
+func (u update) supersedes(m *Member) bool {
+	if m == nil {
+		// We only learn about new members from alive messages
+		return u.State == StateAlive
+	}
+
+	isDown := m.State == StateDead || m.State == StateLeft
+
+	switch u.State {
+	case StateAlive:
+		return u.Incarnation > m.Incarnation
+	case StateSuspect:
+		if isDown {
+			return false
+		}
+		if m.State == StateAlive {
+			return u.Incarnation >= m.Incarnation
+		}
+		return u.Incarnation > m.Incarnation
+	case StateDead, StateLeft:
+		return !isDown && u.Incarnation >= m.Incarnation
+	default:
+		return false
+	}
+}
@@ -0,0 +1,42 @@
+package gossip
+
+import (
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+type messageType uint8
+
+const (
+	msgPing messageType = iota
+	msgPingReq
+	msgAck
+	msgSync
+	msgSyncAck
+	msgGossip
+	msgUser
+)
+
+// message is the envelope for every datagram sent between nodes
+type message struct {
+	Type       messageType `msgpack:"t"`
+	Seq        uint32      `msgpack:"q,omitempty"`
+	From       string      `msgpack:"f"`
+	Target     string      `msgpack:"g,omitempty"`
+	TargetAddr string      `msgpack:"ga,omitempty"`
+	Updates    []update    `msgpack:"u,omitempty"`
+	Channel    string      `msgpack:"c,omitempty"`
+	Data       []byte      `msgpack:"d,omitempty"`
+}
+
+func encodeMessage(m *message) ([]byte, error) {
+	return msgpack.Marshal(m)
+}
+
+func decodeMessage(b []byte) (*message, error) {
+	m := &message{}
+	if err := msgpack.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,77 @@
+package gossip
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+type queuedUpdate struct {
+	update    update
+	transmits int
+}
+
+// updateQueue holds the updates that still need to be piggy-backed onto outgoing messages, each
+// update is retransmitted a number of times that grows with the log of the cluster size
+type updateQueue struct {
+	mu      sync.Mutex
+	mult    int
+	updates map[string]*queuedUpdate
+}
+
+func newUpdateQueue(mult int) *updateQueue {
+	return &updateQueue{
+		mult:    mult,
+		updates: make(map[string]*queuedUpdate),
+	}
+}
+
+// push queues an update, replacing any older update about the same member
+func (q *updateQueue) push(u update) {
+	q.mu.Lock()
+	q.updates[u.ID] = &queuedUpdate{update: u}
+	q.mu.Unlock()
+}
+
+func (q *updateQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.updates)
+}
+
+// next returns up to max updates to send, favouring the least transmitted ones. clusterSize is
+// used to work out how many times each update is retransmitted.
+func (q *updateQueue) next(max int, clusterSize int) []update {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.updates) == 0 {
+		return nil
+	}
+
+	limit := q.mult * int(math.Ceil(math.Log10(float64(clusterSize+1))))
+	if limit < 1 {
+		limit = 1
+	}
+
+	queued := make([]*queuedUpdate, 0, len(q.updates))
+	for _, qu := range q.updates {
+		queued = append(queued, qu)
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].transmits < queued[j].transmits })
+
+	if len(queued) > max {
+		queued = queued[:max]
+	}
+
+	out := make([]update, len(queued))
+	for i, qu := range queued {
+		out[i] = qu.update
+		qu.transmits++
+		if qu.transmits >= limit {
+			delete(q.updates, qu.update.ID)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk-cluster-framework/client/gossip"
+	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
+	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	"github.com/TykTechnologies/tyk-cluster-framework/tracing"
+)
+
+// GossipClient sends messages over UDP unicast to the members of a SWIM gossip cluster, it is an
+// alternative to the BeaconClient for networks that do not support multicast. Nodes join the
+// cluster through a list of seed addresses, only one seed needs to be reachable.
+//
+// Publish sends a payload to every member that is currently alive, Broadcast repeats this at
+// an interval. Payloads must fit into a single UDP datagram.
+type GossipClient struct {
+	ClientHandler
+	BindAddr       string
+	AdvertiseAddr  string
+	Seeds          []string
+	SubscribeChan  chan string
+	UseMiniPayload bool
+	Encoding       encoding.Encoding
+
+	node               *gossip.Node
+	payloadHandlers    payloadMap
+	broadcastMu        sync.Mutex
+	broadcastKillChans map[string]chan struct{}
+	id                 string
+}
+
+// Init initialises the `GossipClient`, it is called automatically by `NewClient()`
+// if the prefix of the connection string is `gossip://`
+func (c *GossipClient) Init(config interface{}) error {
+	node, err := gossip.New(gossip.Config{
+		ID:            c.id,
+		BindAddr:      c.BindAddr,
+		AdvertiseAddr: c.AdvertiseAddr,
+		Seeds:         c.Seeds,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.node = node
+	c.node.SetMessageHandler(c.handleGossipMessage)
+	c.SubscribeChan = make(chan string)
+	c.broadcastKillChans = make(map[string]chan struct{})
+	c.payloadHandlers = payloadMap{
+		payloadHandlers: make(map[string]PayloadHandler),
+	}
+
+	return nil
+}
+
+// Connect binds the UDP socket and starts joining the cluster through the seeds
+func (c *GossipClient) Connect() error {
+	if err := c.node.Start(); err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "tcf.gossipclient",
+	}).Info("Gossip started on: ", c.node.Addr())
+	return nil
+}
+
+// Stop will stop all broadcasts and leave the cluster
+func (c *GossipClient) Stop() error {
+	c.broadcastMu.Lock()
+	for f, killChan := range c.broadcastKillChans {
+		close(killChan)
+		delete(c.broadcastKillChans, f)
+	}
+	c.broadcastMu.Unlock()
+
+	return c.node.Leave()
+}
+
+func (c *GossipClient) GetID() string {
+	return c.id
+}
+
+// Node returns the underlying gossip node, it can be used to list the members of the cluster
+// or to watch for membership changes
+func (c *GossipClient) Node() *gossip.Node {
+	return c.node
+}
+
+// Publish will send a payload to every alive member of the cluster
+func (c *GossipClient) Publish(filter string, p payloads.Payload) error {
+	if TCFConfig.SetEncodingForPayloadsGlobally {
+		p.SetEncoding(c.Encoding)
+	}
+
+	p = p.Copy()
+	span := tracing.StartProducer(p, "publish "+filter)
+	defer span.End()
+
+	data, encErr := payloads.Marshal(p, c.Encoding)
+	if encErr != nil {
+		return encErr
+	}
+
+	var toSend []byte
+	switch data.(type) {
+	case []byte:
+		toSend = data.([]byte)
+	case string:
+		toSend = []byte(data.(string))
+	default:
+		return errors.New("Encoded data is not supported")
+	}
+
+	if len(toSend) == 0 {
+		log.WithFields(logrus.Fields{
+			"prefix": "tcf.gossipclient",
+		}).Error("No data to send, not sending")
+		return nil
+	}
+
+	if err := c.node.SendToAll(filter, toSend); err != nil {
+		return err
+	}
+
+	countPublished("gossip", len(toSend))
+	return nil
+}
+
+func (c *GossipClient) handleGossipMessage(channel string, data []byte, from gossip.Member) {
+	channelHandler, found := c.payloadHandlers.Get(channel)
+	if !found {
+		return
+	}
+
+	handler := func(payload payloads.Payload) {
+		payload.SetHeader(SourceAddressHeader, from.Addr)
+		channelHandler(payload)
+	}
+
+	if c.UseMiniPayload {
+		c.HandleMiniRawMessage(data, handler, c.Encoding)
+		return
+	}
+	c.HandleRawMessage(data, handler, c.Encoding)
+}
+
+// Subscribe will attach a payload handler to a channel, wildcards are not supported
+func (c *GossipClient) Subscribe(filter string, handler PayloadHandler) (chan string, error) {
+	c.payloadHandlers.Add(filter, handler)
+
+	select {
+	case c.SubscribeChan <- filter:
+	default:
+	}
+
+	return c.SubscribeChan, nil
+}
+
+// SetEncoding sets the payload encoding to use when moving messages around
+func (c *GossipClient) SetEncoding(enc encoding.Encoding) error {
+	c.Encoding = enc
+	return nil
+}
+
+// Broadcast will publish a payload to all members every interval (in seconds)
+func (c *GossipClient) Broadcast(filter string, payload payloads.Payload, interval int) error {
+	if payload == nil {
+		return c.StopBroadcast(filter)
+	}
+
+	if interval <= 0 {
+		return errors.New("Broadcast interval must be greater than zero")
+	}
+
+	c.broadcastMu.Lock()
+	defer c.broadcastMu.Unlock()
+
+	if _, found := c.broadcastKillChans[filter]; found {
+		return errors.New("Filter already broadcasting, stop first")
+	}
+
+	killChan := make(chan struct{})
+	go func(f string, p payloads.Payload, i int, k chan struct{}) {
+		ticker := time.NewTicker(time.Duration(i) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			if pErr := c.Publish(f, p); pErr != nil {
+				log.WithFields(logrus.Fields{
+					"prefix": "tcf.gossipclient",
+				}).Error("Failed to broadcast: ", pErr)
+			}
+
+			select {
+			case <-k:
+				log.WithFields(logrus.Fields{
+					"prefix": "tcf.gossipclient",
+				}).Info("Stopping broadcast on: ", f)
+				return
+			case <-ticker.C:
+			}
+		}
+	}(filter, payload, interval, killChan)
+
+	c.broadcastKillChans[filter] = killChan
+	return nil
+}
+
+// StopBroadcast will stop a broadcast
+func (c *GossipClient) StopBroadcast(f string) error {
+	c.broadcastMu.Lock()
+	defer c.broadcastMu.Unlock()
+
+	killChan, found := c.broadcastKillChans[f]
+	if !found {
+		return errors.New("Filter not broadcasting")
+	}
+
+	close(killChan)
+	delete(c.broadcastKillChans, f)
+	return nil
+}
+
+func (c *GossipClient) SetConnectionDropHook(callback func() error) error {
+	// no-op, members come and go but the client itself is never disconnected
+	return nil
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
+	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	"testing"
+	"time"
+)
+
+func TestGossipClient(t *testing.T) {
+	var c1, c2 Client
+	var err error
+	resultChan := make(chan testPayloadData, 10)
+
+	if c1, err = NewClient("gossip://127.0.0.1:9988", encoding.JSON); err != nil {
+		t.Fatal(err)
+	}
+	if err = c1.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Stop()
+
+	if c2, err = NewClient("gossip://127.0.0.1:9989?seeds=127.0.0.1:9988", encoding.JSON); err != nil {
+		t.Fatal(err)
+	}
+	if err = c2.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Stop()
+
+	ch := "tcftestgossip"
+	chMsg := "Channel 1"
+	if _, err = c2.Subscribe(ch, func(payload payloads.Payload) {
+		var d testPayloadData
+		if err := payload.DecodeMessage(&d); err != nil {
+			t.Errorf("Decode payload failed: %v", err)
+			return
+		}
+
+		if payload.GetHeader(SourceAddressHeader) != "127.0.0.1:9988" {
+			t.Errorf("Expected source address header, got: %v", payload.GetHeader(SourceAddressHeader))
+		}
+
+		resultChan <- d
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var pl payloads.Payload
+	if pl, err = payloads.NewMicroPayload(testPayloadData{chMsg}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first broadcast may go out before the nodes have found each other
+	if err := c1.Broadcast(ch, pl, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case v := <-resultChan:
+		if v.FullName != chMsg {
+			t.Fatalf("Unexpected return value: %v", v)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Received no messages")
+	}
+
+	if err := c1.StopBroadcast(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c1.StopBroadcast(ch); err == nil {
+		t.Fatal("Expected an error stopping a broadcast that is not running")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
 	"github.com/TykTechnologies/tyk-cluster-framework/helpers"
 	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	"github.com/TykTechnologies/tyk-cluster-framework/tracing"
 	"github.com/go-mangos/mangos"
 	"github.com/go-mangos/mangos/protocol/pub"
 	"github.com/go-mangos/mangos/protocol/sub"
@@ -112,6 +113,10 @@ func (m *MangosClient) Publish(filter string, payload payloads.Payload) error {
 		payload.SetFrom(m.GetID())
 	}
 
+	payload = payload.Copy()
+	span := tracing.StartProducer(payload, "publish "+filter)
+	defer span.End()
+
 	data, encErr := payloads.Marshal(payload, m.Encoding)
 	if encErr != nil {
 		return encErr
@@ -146,6 +151,7 @@ func (m *MangosClient) Publish(filter string, payload payloads.Payload) error {
 		return fmt.Errorf("Failed publishing: %s", pubErr.Error())
 	}
 
+	countPublished("mangos", len(asPayload))
 	return nil
 }
 
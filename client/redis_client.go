@@ -5,6 +5,7 @@ import (
 	"github.com/TykTechnologies/logrus"
 	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
 	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	"github.com/TykTechnologies/tyk-cluster-framework/tracing"
 	"github.com/garyburd/redigo/redis"
 	"net/url"
 	"strings"
@@ -63,6 +64,11 @@ func (c *RedisClient) Publish(filter string, p payloads.Payload) error {
 	if TCFConfig.SetEncodingForPayloadsGlobally {
 		p.SetEncoding(c.Encoding)
 	}
+
+	p = p.Copy()
+	span := tracing.StartProducer(p, "publish "+filter)
+	defer span.End()
+
 	data, encErr := payloads.Marshal(p, c.Encoding)
 	if encErr != nil {
 		return encErr
@@ -99,6 +105,7 @@ func (c *RedisClient) Publish(filter string, p payloads.Payload) error {
 
 	//fmt.Printf("REDIS PUBLISHING: %v\n", string(toSend))
 	conn.Do("PUBLISH", filter, string(toSend))
+	countPublished("redis", len(toSend))
 	return nil
 }
 
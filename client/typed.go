@@ -0,0 +1,51 @@
+//go:build go1.18
+// +build go1.18
+
+package client
+
+import (
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
+	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+)
+
+// PublishTyped will wrap msg in a payload that declares its schema type and publish it to topic. If a
+// different type is registered for the topic the payload is not sent.
+func PublishTyped[T any](c Client, topic string, msg T) error {
+	p, err := payloads.New(msg)
+	if err != nil {
+		return err
+	}
+
+	if err = payloads.CheckSchemaType(topic, p); err != nil {
+		return err
+	}
+
+	return c.Publish(topic, p)
+}
+
+// SubscribeTyped will subscribe to topic and decode each payload into a T before calling handler.
+// Payloads that fail the schema check or can't be decoded are dropped.
+func SubscribeTyped[T any](c Client, topic string, handler func(T, payloads.Payload)) (chan string, error) {
+	return c.Subscribe(topic, func(p payloads.Payload) {
+		if err := payloads.CheckSchemaType(topic, p); err != nil {
+			rejectTyped(topic, err)
+			return
+		}
+
+		msg, err := payloads.Decode[T](p)
+		if err != nil {
+			rejectTyped(topic, err)
+			return
+		}
+
+		handler(msg, p)
+	})
+}
+
+func rejectTyped(topic string, err error) {
+	metrics.IncrCounter([]string{"client", "schema_rejections"}, 1)
+	log.WithFields(logrus.Fields{
+		"prefix": "tcf.client",
+	}).Warningf("Rejected payload on %v: %v", topic, err)
+}
@@ -0,0 +1,56 @@
+//go:build go1.18
+// +build go1.18
+
+package client_test
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/client"
+	"github.com/TykTechnologies/tyk-cluster-framework/internal/clienttest"
+	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+)
+
+type testPayloadData struct {
+	FullName string
+}
+
+type otherPayloadData struct {
+	Count int
+}
+
+func TestTyped(t *testing.T) {
+	c := clienttest.NewHub().Client("1")
+
+	var received []testPayloadData
+	client.SubscribeTyped(c, "test.typed", func(d testPayloadData, p payloads.Payload) {
+		received = append(received, d)
+	})
+
+	t.Run("Publish and subscribe", func(t *testing.T) {
+		if err := client.PublishTyped(c, "test.typed", testPayloadData{FullName: "foo"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(received) != 1 || received[0].FullName != "foo" {
+			t.Fatalf("Unexpected messages: %v", received)
+		}
+	})
+
+	t.Run("Mismatched payloads are dropped", func(t *testing.T) {
+		client.PublishTyped(c, "test.typed", otherPayloadData{Count: 1})
+
+		if len(received) != 1 {
+			t.Fatalf("Mismatched payload should not reach the handler: %v", received)
+		}
+	})
+
+	t.Run("Registered topics reject other types", func(t *testing.T) {
+		payloads.RegisterTopic[testPayloadData]("test.typed")
+		defer payloads.UnregisterTopicType("test.typed")
+
+		if err := client.PublishTyped(c, "test.typed", otherPayloadData{Count: 1}); err == nil {
+			t.Fatal("Publishing the wrong type to a registered topic should fail")
+		}
+	})
+}
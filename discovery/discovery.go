@@ -0,0 +1,396 @@
+// Package discovery maintains a live table of the nodes in a cluster on top of any TCF client that
+// supports Broadcast (e.g. beacon). Each node periodically announces itself, peers that stay
+// silent for too long are expired, and joins, updates and departures are emitted as events.
+package discovery
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk-cluster-framework/client"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
+	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	logger "github.com/TykTechnologies/tykcommon-logger"
+)
+
+var log = logger.GetLogger()
+
+const (
+	DefaultChannel         = "tcf.discovery"
+	DefaultInterval        = 1
+	DefaultMissedIntervals = 3
+
+	// maxPeerInterval caps the interval a peer announces, so that one can't keep itself in the table
+	// long after it has gone quiet
+	maxPeerInterval = 60
+)
+
+// EventType describes a change in membership
+type EventType int
+
+const (
+	MemberJoined EventType = iota
+	MemberUpdated
+	MemberLeft
+)
+
+func (e EventType) String() string {
+	switch e {
+	case MemberJoined:
+		return "joined"
+	case MemberUpdated:
+		return "updated"
+	case MemberLeft:
+		return "left"
+	default:
+		return "unknown"
+	}
+}
+
+// Member is a node that has been seen in the cluster
+type Member struct {
+	ID       string
+	Address  string
+	Meta     map[string]string
+	LastSeen time.Time
+
+	interval int
+}
+
+// Event is emitted whenever a member joins, changes its address or metadata, or leaves
+type Event struct {
+	Type   EventType
+	Member Member
+}
+
+// Config configures a Registry
+type Config struct {
+	// ID of this node, defaults to the client ID
+	ID string
+	// Address to advertise, when empty peers use the address the announcement came from
+	Address string
+	// Meta is arbitrary metadata to advertise (e.g. capabilities, API port)
+	Meta map[string]string
+	// Channel to announce on, defaults to DefaultChannel
+	Channel string
+	// Interval in seconds between announcements, defaults to DefaultInterval. Peers expire nodes
+	// as if it were at most a minute.
+	Interval int
+	// MissedIntervals is how many announcements a peer may miss before it is expired
+	MissedIntervals int
+}
+
+// announcement is the message each node broadcasts
+type announcement struct {
+	ID       string
+	Address  string
+	Meta     map[string]string
+	Interval int
+}
+
+// Registry is the membership table for a cluster
+type Registry struct {
+	conf    Config
+	client  client.Client
+	mu      sync.RWMutex
+	members map[string]*Member
+	events  chan Event
+	now     func() time.Time
+
+	// stop is set while the registry is running, clients can't unsubscribe so announcements that
+	// arrive while it isn't are ignored instead
+	stop       chan struct{}
+	subscribed bool
+}
+
+// NewRegistry creates a registry that announces this node and listens for others using c, the
+// client should already be initialised.
+func NewRegistry(c client.Client, conf Config) *Registry {
+	if conf.ID == "" {
+		conf.ID = c.GetID()
+	}
+	if conf.Channel == "" {
+		conf.Channel = DefaultChannel
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultInterval
+	}
+	if conf.MissedIntervals <= 0 {
+		conf.MissedIntervals = DefaultMissedIntervals
+	}
+
+	return &Registry{
+		conf:    conf,
+		client:  c,
+		members: make(map[string]*Member),
+		events:  make(chan Event, 64),
+		now:     time.Now,
+	}
+}
+
+// Start will begin announcing this node and tracking peers
+func (r *Registry) Start() error {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.mu.Unlock()
+		return errors.New("Registry already started")
+	}
+
+	stop := make(chan struct{})
+	r.stop = stop
+	subscribe := !r.subscribed
+	r.subscribed = true
+	r.mu.Unlock()
+
+	if subscribe {
+		if _, err := r.client.Subscribe(r.conf.Channel, r.handleAnnouncement); err != nil {
+			r.mu.Lock()
+			r.stop = nil
+			r.subscribed = false
+			r.mu.Unlock()
+			return err
+		}
+	}
+
+	if err := r.announce(); err != nil {
+		r.mu.Lock()
+		r.stop = nil
+		r.mu.Unlock()
+		return err
+	}
+
+	go r.expireMembers(stop)
+
+	return nil
+}
+
+// Stop will stop announcing this node and listening to others, peers will expire it once it has
+// missed enough intervals. The table can't be kept up to date while stopped, so every member is
+// removed and a MemberLeft event is emitted for each.
+func (r *Registry) Stop() error {
+	r.mu.Lock()
+	stop := r.stop
+	r.stop = nil
+
+	var left []Member
+	if stop != nil {
+		for _, m := range r.members {
+			left = append(left, m.copy())
+		}
+		r.members = make(map[string]*Member)
+	}
+	r.mu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+
+	close(stop)
+	metrics.SetGauge([]string{"discovery", "members"}, 0)
+	for _, m := range left {
+		r.emit(Event{Type: MemberLeft, Member: m})
+	}
+
+	return r.client.StopBroadcast(r.conf.Channel)
+}
+
+// SetMeta replaces the metadata advertised for this node
+func (r *Registry) SetMeta(meta map[string]string) error {
+	r.mu.Lock()
+	r.conf.Meta = meta
+	running := r.stop != nil
+	r.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	return r.announce()
+}
+
+// Events returns the channel that membership events are sent on, events are dropped if it is
+// not read fast enough
+func (r *Registry) Events() <-chan Event {
+	return r.events
+}
+
+// Members returns a snapshot of all live members (not including this node), ordered by ID
+func (r *Registry) Members() []Member {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := make([]Member, 0, len(r.members))
+	for _, m := range r.members {
+		members = append(members, m.copy())
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+// Member returns a single live member by ID
+func (r *Registry) Member(id string) (Member, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, found := r.members[id]
+	if !found {
+		return Member{}, false
+	}
+
+	return m.copy(), true
+}
+
+func (r *Registry) announce() error {
+	r.mu.RLock()
+	a := announcement{
+		ID:       r.conf.ID,
+		Address:  r.conf.Address,
+		Meta:     r.conf.Meta,
+		Interval: r.conf.Interval,
+	}
+	r.mu.RUnlock()
+
+	p, err := payloads.NewPayloadNoID(a)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Broadcast(r.conf.Channel, p, r.conf.Interval)
+}
+
+func (r *Registry) handleAnnouncement(p payloads.Payload) {
+	var a announcement
+	if err := p.DecodeMessage(&a); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "tcf.discovery",
+		}).Error("Failed to decode announcement: ", err)
+		return
+	}
+
+	if a.ID == "" || a.ID == r.conf.ID {
+		return
+	}
+
+	if a.Address == "" {
+		a.Address = p.GetHeader(client.SourceAddressHeader)
+	}
+
+	if a.Interval <= 0 {
+		a.Interval = DefaultInterval
+	}
+	if a.Interval > maxPeerInterval {
+		a.Interval = maxPeerInterval
+	}
+
+	r.mu.Lock()
+	if r.stop == nil {
+		r.mu.Unlock()
+		return
+	}
+
+	m, found := r.members[a.ID]
+	if !found {
+		m = &Member{ID: a.ID}
+		r.members[a.ID] = m
+	}
+
+	changed := found && (m.Address != a.Address || !sameMeta(m.Meta, a.Meta))
+	m.Address = a.Address
+	m.Meta = a.Meta
+	m.LastSeen = r.now()
+	m.interval = a.Interval
+	member := m.copy()
+	count := len(r.members)
+	r.mu.Unlock()
+
+	switch {
+	case !found:
+		metrics.SetGauge([]string{"discovery", "members"}, float32(count))
+		r.emit(Event{Type: MemberJoined, Member: member})
+	case changed:
+		r.emit(Event{Type: MemberUpdated, Member: member})
+	}
+}
+
+func (r *Registry) expireMembers(stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(r.conf.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.expire()
+		}
+	}
+}
+
+// expire removes members that have missed too many announcements, each member's own interval is
+// used so that nodes with different settings can share a channel
+func (r *Registry) expire() {
+	now := r.now()
+	var left []Member
+
+	r.mu.Lock()
+	for id, m := range r.members {
+		deadline := m.LastSeen.Add(time.Duration(m.interval*r.conf.MissedIntervals) * time.Second)
+		if now.After(deadline) {
+			delete(r.members, id)
+			left = append(left, m.copy())
+		}
+	}
+	count := len(r.members)
+	r.mu.Unlock()
+
+	if len(left) == 0 {
+		return
+	}
+
+	metrics.SetGauge([]string{"discovery", "members"}, float32(count))
+	for _, m := range left {
+		r.emit(Event{Type: MemberLeft, Member: m})
+	}
+}
+
+func (r *Registry) emit(e Event) {
+	log.WithFields(logrus.Fields{
+		"prefix": "tcf.discovery",
+	}).Debugf("Member %v %v (%v)", e.Member.ID, e.Type, e.Member.Address)
+
+	select {
+	case r.events <- e:
+	default:
+		metrics.IncrCounter([]string{"discovery", "events", "dropped"}, 1)
+	}
+}
+
+func (m *Member) copy() Member {
+	c := *m
+	if m.Meta != nil {
+		c.Meta = make(map[string]string, len(m.Meta))
+		for k, v := range m.Meta {
+			c.Meta[k] = v
+		}
+	}
+
+	return c
+}
+
+func sameMeta(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if bv, found := b[k]; !found || bv != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,136 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/internal/clienttest"
+)
+
+func expectEvent(t *testing.T, r *Registry, typ EventType, id string) Event {
+	select {
+	case e := <-r.Events():
+		if e.Type != typ || e.Member.ID != id {
+			t.Fatalf("Expected %v %v, got: %v %v", id, typ, e.Member.ID, e.Type)
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("Expected %v %v, got nothing", id, typ)
+	}
+	return Event{}
+}
+
+func TestRegistry(t *testing.T) {
+	h := clienttest.NewHub()
+
+	r1 := NewRegistry(h.Client("1"), Config{Meta: map[string]string{"role": "gateway"}})
+	r2 := NewRegistry(h.Client("2"), Config{Address: "node2:8080"})
+
+	if err := r1.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Stop()
+
+	if err := r2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Stop()
+
+	t.Run("Join", func(t *testing.T) {
+		e := expectEvent(t, r1, MemberJoined, "2")
+		if e.Member.Address != "node2:8080" {
+			t.Fatalf("Expected advertised address, got: %v", e.Member.Address)
+		}
+
+		// r2 only hears r1 once r1 announces again
+		r1.announce()
+		e = expectEvent(t, r2, MemberJoined, "1")
+		if e.Member.Address != "10.0.0.1" {
+			t.Fatalf("Expected source address, got: %v", e.Member.Address)
+		}
+
+		if e.Member.Meta["role"] != "gateway" {
+			t.Fatalf("Expected metadata, got: %v", e.Member.Meta)
+		}
+	})
+
+	t.Run("Members", func(t *testing.T) {
+		members := r2.Members()
+		if len(members) != 1 || members[0].ID != "1" {
+			t.Fatalf("Unexpected members: %v", members)
+		}
+
+		if _, found := r2.Member("2"); found {
+			t.Fatal("Registry should not include its own node")
+		}
+	})
+
+	t.Run("Repeat announcements", func(t *testing.T) {
+		r1.announce()
+		select {
+		case e := <-r2.Events():
+			t.Fatalf("Unchanged announcement should not emit an event, got: %v", e)
+		default:
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		r1.SetMeta(map[string]string{"role": "dashboard"})
+		e := expectEvent(t, r2, MemberUpdated, "1")
+		if e.Member.Meta["role"] != "dashboard" {
+			t.Fatalf("Expected updated metadata, got: %v", e.Member.Meta)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		r2.now = func() time.Time { return time.Now().Add(2 * time.Second) }
+		r2.expire()
+		if len(r2.Members()) != 1 {
+			t.Fatal("Member should not expire before missing enough intervals")
+		}
+
+		r2.now = func() time.Time { return time.Now().Add(4 * time.Second) }
+		r2.expire()
+		expectEvent(t, r2, MemberLeft, "1")
+
+		if len(r2.Members()) != 0 {
+			t.Fatalf("Expected no members, got: %v", r2.Members())
+		}
+	})
+
+	t.Run("Long intervals are capped", func(t *testing.T) {
+		r3 := NewRegistry(h.Client("3"), Config{Interval: 3600})
+		if err := r3.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer r3.Stop()
+		expectEvent(t, r2, MemberJoined, "3")
+
+		missed := 4 + maxPeerInterval*DefaultMissedIntervals + 1
+		r2.now = func() time.Time { return time.Now().Add(time.Duration(missed) * time.Second) }
+		r2.expire()
+		expectEvent(t, r2, MemberLeft, "3")
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		r1.announce()
+		expectEvent(t, r2, MemberJoined, "1")
+
+		// Members can't be tracked while stopped, so they leave
+		if err := r2.Stop(); err != nil {
+			t.Fatal(err)
+		}
+		expectEvent(t, r2, MemberLeft, "1")
+
+		r1.announce()
+		if len(r2.Members()) != 0 {
+			t.Fatalf("Stopped registry should ignore announcements, got: %v", r2.Members())
+		}
+
+		if err := r2.Start(); err != nil {
+			t.Fatal(err)
+		}
+		r1.announce()
+		expectEvent(t, r2, MemberJoined, "1")
+	})
+}
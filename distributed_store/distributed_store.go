@@ -6,6 +6,7 @@ import (
 	"github.com/TykTechnologies/tyk-cluster-framework/client"
 	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty"
 	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/http"
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
 	logger "github.com/TykTechnologies/tykcommon-logger"
 	"github.com/nu7hatch/gouuid"
 	"net"
@@ -89,3 +90,34 @@ func (d *DistributedStore) Stop() error {
 
 	return nil
 }
+
+// OnLeaderChange calls fn whenever raft leadership of the store moves, use it to start and stop
+// work that should only run on the leader. The store must have been started. The returned function
+// removes the callback.
+func (d *DistributedStore) OnLeaderChange(fn func(store.LeaderChange)) func() {
+	return d.StorageAPI.OnLeaderChange(fn)
+}
+
+// LeaderCh is OnLeaderChange as a channel. If the reader falls behind older changes are dropped in
+// favour of newer ones, so the last value received is always current. Call the returned function
+// to stop receiving changes.
+func (d *DistributedStore) LeaderCh() (<-chan store.LeaderChange, func()) {
+	ch := make(chan store.LeaderChange, 8)
+	cancel := d.OnLeaderChange(func(c store.LeaderChange) {
+		for {
+			select {
+			case ch <- c:
+				return
+			default:
+			}
+
+			// Full, make room by dropping the oldest change
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	})
+
+	return ch, cancel
+}
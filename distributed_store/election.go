@@ -0,0 +1,170 @@
+package tcf
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/http"
+)
+
+// Election is a named leader election for application code, so that different jobs can each have
+// their own leader independently of which node leads the raft cluster. It is built on a store lock:
+// the winner holds the lock and keeps renewing its lease, if it goes away the lease runs out and
+// another candidate takes over.
+type Election struct {
+	Name        string
+	CandidateID string
+	// TTL is the lease in seconds, the leader renews it three times per TTL
+	TTL int
+
+	service *httpd.EmbeddedService
+
+	mu      sync.Mutex
+	elected bool
+	token   uint64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewElection creates an election called name that this process takes part in as candidateID,
+// candidate IDs must be unique across the cluster. Call Campaign to start running for leadership.
+func (d *DistributedStore) NewElection(name, candidateID string, ttl int) *Election {
+	return &Election{
+		Name:        name,
+		CandidateID: candidateID,
+		TTL:         ttl,
+		service:     d.StorageAPI,
+	}
+}
+
+// Campaign runs for leadership in the background until Resign is called. onElected is called with
+// the lock's fencing token when this candidate wins, and onDemoted when it stops being the leader.
+// A leader that can't renew its lease is demoted straight away, as it can no longer be sure it
+// holds it. Either callback may be nil.
+func (e *Election) Campaign(onElected func(token uint64), onDemoted func()) error {
+	if e.TTL <= 0 {
+		return errors.New("Election TTL must be greater than zero")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stop != nil {
+		return errors.New("Already campaigning in election: " + e.Name)
+	}
+
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.run(onElected, onDemoted, e.stop, e.done)
+
+	return nil
+}
+
+// Resign stops campaigning, giving up the leadership if this candidate holds it.
+func (e *Election) Resign() error {
+	e.mu.Lock()
+	stop, done := e.stop, e.done
+	e.stop = nil
+	e.mu.Unlock()
+
+	if stop == nil {
+		return errors.New("Not campaigning in election: " + e.Name)
+	}
+
+	close(stop)
+	<-done
+	return nil
+}
+
+// IsLeader returns whether this candidate currently leads the election, and its fencing token.
+func (e *Election) IsLeader() (bool, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.elected, e.token
+}
+
+// Leader returns the candidate ID of the current leader, or an empty string if there is none.
+func (e *Election) Leader() (string, error) {
+	resp, err := e.service.GetLock(e.Name)
+	if err != nil {
+		if errResp, ok := err.(*httpd.ErrorResponse); ok && errResp.ErrorCode == httpd.RAFTErrorNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return resp.Lock.Owner, nil
+}
+
+func (e *Election) run(onElected func(uint64), onDemoted func(), stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(time.Duration(e.TTL) * time.Second / 3)
+	defer ticker.Stop()
+
+	for {
+		e.check(onElected, onDemoted)
+
+		select {
+		case <-stop:
+			if elected, _ := e.IsLeader(); elected {
+				if _, err := e.service.ReleaseLock(e.Name, e.CandidateID); err != nil {
+					log.WithFields(logrus.Fields{
+						"prefix": "distributed_store",
+					}).Warning("Failed to release election lock: ", err)
+				}
+				e.demote(onDemoted)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check renews the lease if we are the leader, or tries to take it if we are not
+func (e *Election) check(onElected func(uint64), onDemoted func()) {
+	if elected, _ := e.IsLeader(); elected {
+		if _, err := e.service.RenewLease(e.Name, e.CandidateID, e.TTL); err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "distributed_store",
+			}).Warning("Lost leadership of election ", e.Name, ": ", err)
+			e.demote(onDemoted)
+		}
+		return
+	}
+
+	resp, err := e.service.AcquireLock(e.Name, e.CandidateID, e.TTL)
+	if err != nil {
+		if errResp, ok := err.(*httpd.ErrorResponse); !ok || errResp.ErrorCode != httpd.RAFTErrorLockHeld {
+			log.WithFields(logrus.Fields{
+				"prefix": "distributed_store",
+			}).Warning("Failed to campaign in election ", e.Name, ": ", err)
+		}
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "distributed_store",
+	}).Info("Won election: ", e.Name)
+	e.mu.Lock()
+	e.elected = true
+	e.token = resp.Lock.Token
+	e.mu.Unlock()
+
+	if onElected != nil {
+		onElected(resp.Lock.Token)
+	}
+}
+
+func (e *Election) demote(onDemoted func()) {
+	e.mu.Lock()
+	e.elected = false
+	e.token = 0
+	e.mu.Unlock()
+
+	if onDemoted != nil {
+		onDemoted()
+	}
+}
@@ -0,0 +1,437 @@
+package httpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Service) handleRPush(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for PUT"), http.StatusBadRequest)
+		return
+	}
+
+	// Read the parameters from the PUT body as form params
+	err := r.ParseForm()
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not parse form data: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	value := r.Form.Get("value")
+	if value == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	values := make([]interface{}, 0)
+	if err := json.Unmarshal([]byte(value), &values); err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value must be array of objects, err: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if errResp := s.StorageAPI.RPush(k, values...); errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListPush)
+	returnData.Node.Key = k
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+// handlePop serves lpop and rpop, a timeout in seconds makes the pop wait for an item if the list
+// is empty
+func (s *Service) handlePop(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for PUT"), http.StatusBadRequest)
+		return
+	}
+
+	// Read the parameters from the PUT body as form params
+	err := r.ParseForm()
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not parse form data: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	var timeout int
+	if t := r.Form.Get("timeout"); t != "" {
+		if timeout, err = strconv.Atoi(t); err != nil {
+			s.writeToClient(w, r, NewErrorResponse("/"+k, "Timeout must be number: "+err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	pop := s.StorageAPI.LPop
+	if strings.HasPrefix(r.URL.Path, "/key/rpop/") {
+		pop = s.StorageAPI.RPop
+	}
+
+	value, errResp := pop(k, time.Duration(timeout)*time.Second)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListPop)
+	returnData.Node.Key = k
+	returnData.Meta = value
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleLTrim(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for PUT"), http.StatusBadRequest)
+		return
+	}
+
+	// Read the parameters from the PUT body as form params
+	err := r.ParseForm()
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not parse form data: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	start, startErr := strconv.Atoi(r.Form.Get("start"))
+	stop, stopErr := strconv.Atoi(r.Form.Get("stop"))
+	if startErr != nil || stopErr != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Start and stop must be numbers"), http.StatusBadRequest)
+		return
+	}
+
+	if errResp := s.StorageAPI.LTrim(k, start, stop); errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListTrim)
+	returnData.Node.Key = k
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleLIndex(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	i, err := strconv.Atoi(r.URL.Query().Get("index"))
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Index must be number: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	value, errResp := s.StorageAPI.LIndex(k, i)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListIndex)
+	returnData.Node.Key = k
+	returnData.Meta = value
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleLSet(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for PUT"), http.StatusBadRequest)
+		return
+	}
+
+	// Read the parameters from the PUT body as form params
+	err := r.ParseForm()
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not parse form data: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	index, err := strconv.Atoi(r.Form.Get("index"))
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Index must be number: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	value := r.Form.Get("value")
+	if value == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	var val interface{}
+	if err := json.Unmarshal([]byte(value), &val); err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value must be object, err: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if errResp := s.StorageAPI.LSet(k, index, val); errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListSet)
+	returnData.Node.Key = k
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleSRem(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for DELETE"), http.StatusBadRequest)
+		return
+	}
+
+	// DELETE bodies aren't parsed, so the value is read from the query string
+	value := r.URL.Query().Get("value")
+	if value == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	if errResp := s.StorageAPI.SRem(k, []byte(value)); errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeySetRemove)
+	returnData.Node.Key = k
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleSIsMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	value := r.URL.Query().Get("value")
+	if k == "" || value == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "key and value cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	isMember, errResp := s.StorageAPI.SIsMember(k, []byte(value))
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusInternalServerError)
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeySetIsMember)
+	returnData.Node.Key = k
+	returnData.Meta = isMember
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleSCard(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	n, errResp := s.StorageAPI.SCard(k)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusInternalServerError)
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeySetCard)
+	returnData.Node.Key = k
+	returnData.Meta = n
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleZRem(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for DELETE"), http.StatusBadRequest)
+		return
+	}
+
+	// DELETE bodies aren't parsed, so the value is read from the query string
+	val, ok := s.readZSetMember(w, r, k)
+	if !ok {
+		return
+	}
+
+	if errResp := s.StorageAPI.ZRem(k, val); errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetRemove)
+	returnData.Node.Key = k
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleZScore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	val, ok := s.readZSetMember(w, r, k)
+	if !ok {
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	score, errResp := s.StorageAPI.ZScore(k, val)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetScore)
+	returnData.Node.Key = k
+	returnData.Meta = score
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleZCard(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	n, errResp := s.StorageAPI.ZCard(k)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusInternalServerError)
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetCard)
+	returnData.Node.Key = k
+	returnData.Meta = n
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleZRange(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	start, startErr := strconv.Atoi(q.Get("start"))
+	stop, stopErr := strconv.Atoi(q.Get("stop"))
+	if startErr != nil || stopErr != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Start and stop must be numbers"), http.StatusBadRequest)
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	vals, errResp := s.StorageAPI.ZRange(k, start, stop)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusInternalServerError)
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetRange)
+	returnData.Node.Key = k
+	returnData.Meta = vals
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+// readZSetMember decodes the JSON value query param, writing an error to the client if it fails
+func (s *Service) readZSetMember(w http.ResponseWriter, r *http.Request, k string) (interface{}, bool) {
+	value := r.URL.Query().Get("value")
+	if value == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value cannot be empty"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	var val interface{}
+	if err := json.Unmarshal([]byte(value), &val); err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value must be object, err: "+err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return val, true
+}
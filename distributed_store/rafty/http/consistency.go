@@ -0,0 +1,148 @@
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
+)
+
+// readIndexTimeout is how long a follower waits to catch up with the index the leader verified
+const readIndexTimeout = 5 * time.Second
+
+// readConsistency reads the consistency query parameter of a read request, without one the read is
+// served from this node's copy of the store like the embedded service's
+func readConsistency(r *http.Request) (store.Consistency, *ErrorResponse) {
+	level, err := store.ParseConsistency(r.URL.Query().Get("consistency"))
+	if err != nil {
+		return "", NewErrorResponse(r.URL.Path, err.Error())
+	}
+
+	return level, nil
+}
+
+// verifyRead checks that a read request can be served from this node at the consistency it asks
+// for, and returns the index the read is at least as new as. Reads that have to be made on the
+// leader are forwarded to it, in which case, or if the read can't be verified, the response has
+// been written and false is returned.
+func (s *Service) verifyRead(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	level, errResp := readConsistency(r)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusBadRequest)
+		return 0, false
+	}
+
+	if level != store.ConsistencyStale && !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return 0, false
+	}
+
+	index, err := s.store.VerifyRead(level)
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse(r.URL.Path, "Could not verify read: "+err.Error()), http.StatusServiceUnavailable)
+		return 0, false
+	}
+
+	return index, true
+}
+
+func (s *Service) handleReadIndex(w http.ResponseWriter, r *http.Request) {
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionReadIndex)
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+// WithConsistency returns a copy of the service whose reads are made at level. Otherwise reads are
+// served from this node's copy of the store, as at store.ConsistencyStale, so that followers don't
+// go to the leader for every read.
+func (e *EmbeddedService) WithConsistency(level store.Consistency) *EmbeddedService {
+	withLevel := *e
+	withLevel.consistency = level
+	return &withLevel
+}
+
+// verifyRead makes sure a read from this node's copy of the store meets the service's consistency
+// level. A follower asks the leader to verify the read and then waits to catch up with it, so that
+// any kind of read can be served locally.
+func (e *EmbeddedService) verifyRead(key string) (uint64, error) {
+	level, err := store.ParseConsistency(string(e.consistency))
+	if err != nil {
+		return 0, NewErrorResponse("/"+key, err.Error())
+	}
+
+	if level == store.ConsistencyStale || e.storageAPI.store.IsLeader() {
+		index, err := e.storageAPI.store.VerifyRead(level)
+		if err != nil {
+			return 0, NewErrorResponse("/"+key, "Could not verify read: "+err.Error())
+		}
+		return index, nil
+	}
+
+	c, err := e.leaderClient(key)
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := c.ReadIndex(level)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := e.storageAPI.store.WaitForIndex(index, readIndexTimeout); err != nil {
+		return 0, NewErrorResponse("/"+key, "Could not verify read: "+err.Error())
+	}
+
+	return index, nil
+}
+
+// ReadIndex asks the target node for an index that a read at level has to be at least as new as
+func (c *APIClient) ReadIndex(level store.Consistency) (uint64, error) {
+	vals := url.Values{}
+	vals.Add("consistency", string(level))
+
+	u := strings.TrimSuffix(c.targetURL, "/key") + "/index?" + vals.Encode()
+	thisHttpRequest, rErr := http.NewRequest("GET", u, nil)
+	if rErr != nil {
+		return 0, rErr
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	resp, respErr := client.Do(thisHttpRequest)
+	if respErr != nil {
+		return 0, respErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, c.processErrorResponse(resp)
+	}
+
+	body, bErr := ioutil.ReadAll(resp.Body)
+	if bErr != nil {
+		return 0, bErr
+	}
+
+	newAPIReturnObject := NewKeyValueAPIObject()
+	if mErr := json.Unmarshal(body, newAPIReturnObject); mErr != nil {
+		return 0, mErr
+	}
+
+	if newAPIReturnObject.Index == 0 {
+		return 0, errors.New("leader did not return an index")
+	}
+
+	return newAPIReturnObject.Index, nil
+}
@@ -0,0 +1,25 @@
+package httpd
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
+)
+
+func TestReadConsistency(t *testing.T) {
+	// Without a level reads stay local, like the embedded service's
+	level, errResp := readConsistency(httptest.NewRequest("GET", "/key/a", nil))
+	if errResp != nil || level != store.ConsistencyStale {
+		t.Fatalf("Expected stale reads by default, got: %v %+v", level, errResp)
+	}
+
+	level, errResp = readConsistency(httptest.NewRequest("GET", "/key/a?consistency=linearizable", nil))
+	if errResp != nil || level != store.ConsistencyLinearizable {
+		t.Fatalf("Expected linearizable reads, got: %v %+v", level, errResp)
+	}
+
+	if _, errResp = readConsistency(httptest.NewRequest("GET", "/key/a?consistency=eventual", nil)); errResp == nil {
+		t.Fatal("Expected unknown levels to be rejected")
+	}
+}
@@ -5,8 +5,10 @@ import (
 	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
 	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
 	"gopkg.in/vmihailenco/msgpack.v2"
+	"math"
 	"net/url"
 	"strconv"
+	"time"
 )
 
 type forwardingCommand string
@@ -21,11 +23,30 @@ const (
 	forward_lrem             forwardingCommand = "lrem"
 	forward_zadd             forwardingCommand = "zadd"
 	forward_zremrangebyscore forwardingCommand = "zremrangebyscore"
+	forward_acquire_lock     forwardingCommand = "acquire_lock"
+	forward_renew_lease      forwardingCommand = "renew_lease"
+	forward_release_lock     forwardingCommand = "release_lock"
+	forward_update_if        forwardingCommand = "update_if"
+	forward_delete_if        forwardingCommand = "delete_if"
+	forward_txn              forwardingCommand = "txn"
+	forward_hset             forwardingCommand = "hset"
+	forward_hdel             forwardingCommand = "hdel"
+	forward_hincrby          forwardingCommand = "hincrby"
+	forward_incrby           forwardingCommand = "incrby"
+	forward_incrbyfloat      forwardingCommand = "incrbyfloat"
+	forward_rpush            forwardingCommand = "rpush"
+	forward_lpop             forwardingCommand = "lpop"
+	forward_rpop             forwardingCommand = "rpop"
+	forward_ltrim            forwardingCommand = "ltrim"
+	forward_lset             forwardingCommand = "lset"
+	forward_srem             forwardingCommand = "srem"
+	forward_zrem             forwardingCommand = "zrem"
 )
 
 type EmbeddedService struct {
-	storageAPI *StorageAPI
-	TLS        bool
+	storageAPI  *StorageAPI
+	TLS         bool
+	consistency store.Consistency
 }
 
 type ForwardNodeValue struct {
@@ -45,6 +66,36 @@ type ForwardNodeValue struct {
 		Min int64
 		Max int64
 	}
+	LOCK struct {
+		Owner string
+	}
+	CAS struct {
+		Cond *store.Condition
+	}
+	TXN struct {
+		Request *TxnRequest
+	}
+	HASH struct {
+		Field  string
+		Fields []string
+		Value  interface{}
+		By     int64
+	}
+	COUNTER struct {
+		By      int64
+		ByFloat float64
+	}
+	LIST struct {
+		Values  []interface{}
+		Value   interface{}
+		Start   int
+		Stop    int
+		Index   int
+		Timeout time.Duration
+	}
+	ZREM struct {
+		Value interface{}
+	}
 }
 
 func NewEmbeddedService(useTLS bool, storageAPI *StorageAPI) *EmbeddedService {
@@ -62,6 +113,12 @@ func (e *EmbeddedService) IsLeader() bool {
 	return e.storageAPI.store.IsLeader()
 }
 
+// OnLeaderChange calls fn whenever raft leadership moves, see store.Store.OnLeaderChange. The
+// returned function removes the callback.
+func (e *EmbeddedService) OnLeaderChange(fn func(store.LeaderChange)) func() {
+	return e.storageAPI.store.OnLeaderChange(fn)
+}
+
 func (e *EmbeddedService) AddToSet(key string, value []byte) (*KeyValueAPIObject, error) {
 	nodeData := &rafty_objects.NodeValue{
 		TTL:   0,
@@ -90,6 +147,11 @@ func (e *EmbeddedService) GetSet(k string) (*KeyValueAPIObject, error) {
 		Key:   k,
 	}
 
+	index, readErr := e.verifyRead(k)
+	if readErr != nil {
+		return nil, readErr
+	}
+
 	var err *ErrorResponse
 	var value map[interface{}]interface{}
 	if value, err = e.storageAPI.GetSet(k); err != nil {
@@ -99,6 +161,7 @@ func (e *EmbeddedService) GetSet(k string) (*KeyValueAPIObject, error) {
 	returnData := NewKeyValueAPIObjectWithAction(ActionKeySetRequested)
 	returnData.Node = nodeData
 	returnData.Meta = value
+	returnData.Index = index
 	return returnData, nil
 }
 
@@ -132,6 +195,11 @@ func (e *EmbeddedService) LLen(key string) (*KeyValueAPIObject, error) {
 		Key:   key,
 	}
 
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
 	var err *ErrorResponse
 	var val int64
 	if val, err = e.storageAPI.LLen(key); err != nil {
@@ -141,6 +209,7 @@ func (e *EmbeddedService) LLen(key string) (*KeyValueAPIObject, error) {
 	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListLength)
 	returnData.Node = nodeData
 	returnData.Meta = val
+	returnData.Index = index
 
 	return returnData, nil
 }
@@ -177,6 +246,11 @@ func (e *EmbeddedService) LRange(key string, from, to int) (*KeyValueAPIObject,
 		Key:   key,
 	}
 
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
 	var err *ErrorResponse
 	var val []interface{}
 	if val, err = e.storageAPI.LRange(key, from, to); err != nil {
@@ -186,6 +260,7 @@ func (e *EmbeddedService) LRange(key string, from, to int) (*KeyValueAPIObject,
 	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListRange)
 	returnData.Node = nodeData
 	returnData.Meta = val
+	returnData.Index = index
 
 	return returnData, nil
 }
@@ -222,6 +297,11 @@ func (e *EmbeddedService) ZRangeByScore(key string, min, max int64) (*KeyValueAP
 		Key:   key,
 	}
 
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
 	var err *ErrorResponse
 	var val []interface{}
 	if val, err = e.storageAPI.ZRangeByScore(key, min, max); err != nil {
@@ -231,6 +311,7 @@ func (e *EmbeddedService) ZRangeByScore(key string, min, max int64) (*KeyValueAP
 	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetRangeByScore)
 	returnData.Node = nodeData
 	returnData.Meta = val
+	returnData.Index = index
 
 	return returnData, nil
 }
@@ -260,6 +341,402 @@ func (e *EmbeddedService) ZRemRangeByScore(key string, min int64, max int64) (*K
 	return returnData, nil
 }
 
+// RPush appends values to the list stored at key.
+func (e *EmbeddedService) RPush(key string, values ...interface{}) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.LIST.Values = values
+		return e.forwardCommand(key, forward_rpush, &f)
+	}
+
+	if err := e.storageAPI.RPush(key, values...); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListPush)
+	returnData.Node.Key = key
+	return returnData, nil
+}
+
+// LPop removes the first item of the list stored at key and returns it in Meta, it fails with
+// RAFTErrorNotFound if the list is empty.
+func (e *EmbeddedService) LPop(key string) (*KeyValueAPIObject, error) {
+	return e.BLPop(key, 0)
+}
+
+// RPop is LPop for the last item of the list.
+func (e *EmbeddedService) RPop(key string) (*KeyValueAPIObject, error) {
+	return e.BRPop(key, 0)
+}
+
+// BLPop is LPop that waits up to timeout for an item if the list is empty.
+func (e *EmbeddedService) BLPop(key string, timeout time.Duration) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.LIST.Timeout = timeout
+		return e.forwardCommand(key, forward_lpop, &f)
+	}
+
+	value, err := e.storageAPI.LPop(key, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListPop)
+	returnData.Node.Key = key
+	returnData.Meta = value
+	return returnData, nil
+}
+
+// BRPop is BLPop for the last item of the list.
+func (e *EmbeddedService) BRPop(key string, timeout time.Duration) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.LIST.Timeout = timeout
+		return e.forwardCommand(key, forward_rpop, &f)
+	}
+
+	value, err := e.storageAPI.RPop(key, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListPop)
+	returnData.Node.Key = key
+	returnData.Meta = value
+	return returnData, nil
+}
+
+// LTrim trims the list stored at key to the items from start to stop inclusive, negative indexes
+// count from the end.
+func (e *EmbeddedService) LTrim(key string, start, stop int) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.LIST.Start = start
+		f.LIST.Stop = stop
+		return e.forwardCommand(key, forward_ltrim, &f)
+	}
+
+	if err := e.storageAPI.LTrim(key, start, stop); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListTrim)
+	returnData.Node.Key = key
+	return returnData, nil
+}
+
+// LIndex returns the item at index of the list stored at key in Meta, it fails with
+// RAFTErrorNotFound if there is none.
+func (e *EmbeddedService) LIndex(key string, index int) (*KeyValueAPIObject, error) {
+	readIndex, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	value, err := e.storageAPI.LIndex(key, index)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListIndex)
+	returnData.Node.Key = key
+	returnData.Meta = value
+	returnData.Index = readIndex
+	return returnData, nil
+}
+
+// LSet replaces the item at index of the list stored at key, it fails with RAFTErrorOutOfRange if
+// there is none.
+func (e *EmbeddedService) LSet(key string, index int, value interface{}) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.LIST.Index = index
+		f.LIST.Value = value
+		return e.forwardCommand(key, forward_lset, &f)
+	}
+
+	if err := e.storageAPI.LSet(key, index, value); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyListSet)
+	returnData.Node.Key = key
+	return returnData, nil
+}
+
+// SRem removes value from the set stored at key.
+func (e *EmbeddedService) SRem(key string, value []byte) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key, Value: string(value)}}
+		return e.forwardCommand(key, forward_srem, &f)
+	}
+
+	if err := e.storageAPI.SRem(key, value); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeySetRemove)
+	returnData.Node.Key = key
+	return returnData, nil
+}
+
+// SIsMember returns in Meta whether value is in the set stored at key.
+func (e *EmbeddedService) SIsMember(key string, value []byte) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	isMember, err := e.storageAPI.SIsMember(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeySetIsMember)
+	returnData.Node.Key = key
+	returnData.Meta = isMember
+	returnData.Index = index
+	return returnData, nil
+}
+
+// SCard returns the number of members of the set stored at key in Meta.
+func (e *EmbeddedService) SCard(key string) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	n, err := e.storageAPI.SCard(key)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeySetCard)
+	returnData.Node.Key = key
+	returnData.Meta = n
+	returnData.Index = index
+	return returnData, nil
+}
+
+// ZRem removes value from the sorted set stored at key.
+func (e *EmbeddedService) ZRem(key string, value interface{}) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.ZREM.Value = value
+		return e.forwardCommand(key, forward_zrem, &f)
+	}
+
+	if err := e.storageAPI.ZRem(key, value); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetRemove)
+	returnData.Node.Key = key
+	return returnData, nil
+}
+
+// ZScore returns the score of value in the sorted set stored at key in Meta, it fails with
+// RAFTErrorNotFound if value isn't a member.
+func (e *EmbeddedService) ZScore(key string, value interface{}) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	score, err := e.storageAPI.ZScore(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetScore)
+	returnData.Node.Key = key
+	returnData.Meta = score
+	returnData.Index = index
+	return returnData, nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key in Meta.
+func (e *EmbeddedService) ZCard(key string) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	n, err := e.storageAPI.ZCard(key)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetCard)
+	returnData.Node.Key = key
+	returnData.Meta = n
+	returnData.Index = index
+	return returnData, nil
+}
+
+// ZRange returns the members of the sorted set stored at key from rank start to stop inclusive in
+// Meta, in score order. Negative ranks count from the end.
+func (e *EmbeddedService) ZRange(key string, start, stop int) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	vals, err := e.storageAPI.ZRange(key, start, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetRange)
+	returnData.Node.Key = key
+	returnData.Meta = vals
+	returnData.Index = index
+	return returnData, nil
+}
+
+// HSet sets a field of the hash stored at key.
+func (e *EmbeddedService) HSet(key, field string, value interface{}) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.HASH.Field = field
+		f.HASH.Value = value
+		return e.forwardCommand(key, forward_hset, &f)
+	}
+
+	if err := e.storageAPI.HSet(key, field, value); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashSet)
+	returnData.Node.Key = key
+	return returnData, nil
+}
+
+// HGet returns a field of the hash stored at key in Meta, it fails with RAFTErrorNotFound if the
+// field isn't set.
+func (e *EmbeddedService) HGet(key, field string) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	value, err := e.storageAPI.HGet(key, field)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashGet)
+	returnData.Node.Key = key
+	returnData.Meta = value
+	returnData.Index = index
+	return returnData, nil
+}
+
+// HGetAll returns every field of the hash stored at key in Meta.
+func (e *EmbeddedService) HGetAll(key string) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	h, err := e.storageAPI.HGetAll(key)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashGetAll)
+	returnData.Node.Key = key
+	returnData.Meta = h
+	returnData.Index = index
+	return returnData, nil
+}
+
+// HDel removes fields from the hash stored at key.
+func (e *EmbeddedService) HDel(key string, fields ...string) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.HASH.Fields = fields
+		return e.forwardCommand(key, forward_hdel, &f)
+	}
+
+	if err := e.storageAPI.HDel(key, fields...); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashDelete)
+	returnData.Node.Key = key
+	return returnData, nil
+}
+
+// HIncrBy adds by to an integer field of the hash stored at key, the result is returned in Meta.
+func (e *EmbeddedService) HIncrBy(key, field string, by int64) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.HASH.Field = field
+		f.HASH.By = by
+		return e.forwardCommand(key, forward_hincrby, &f)
+	}
+
+	value, err := e.storageAPI.HIncrBy(key, field, by)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashIncrBy)
+	returnData.Node.Key = key
+	returnData.Meta = value
+	return returnData, nil
+}
+
+// IncrBy atomically adds by to the integer counter at key, the node is returned with the result in
+// Meta. A counter that doesn't exist starts at 0, and expires after ttl seconds if ttl is above 0.
+func (e *EmbeddedService) IncrBy(key string, by int64, ttl int) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key, TTL: ttl}}
+		f.COUNTER.By = by
+		return e.forwardCommand(key, forward_incrby, &f)
+	}
+
+	node, value, err := e.storageAPI.IncrBy(key, by, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyIncrBy)
+	returnData.Node = node
+	returnData.Meta = value
+	return returnData, nil
+}
+
+// DecrBy atomically subtracts by from the integer counter at key, see IncrBy.
+func (e *EmbeddedService) DecrBy(key string, by int64, ttl int) (*KeyValueAPIObject, error) {
+	if by == math.MinInt64 {
+		return nil, NewErrorResponse("/"+key, "by is out of range")
+	}
+
+	return e.IncrBy(key, -by, ttl)
+}
+
+// IncrByFloat is IncrBy for floating point counters.
+func (e *EmbeddedService) IncrByFloat(key string, by float64, ttl int) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key, TTL: ttl}}
+		f.COUNTER.ByFloat = by
+		return e.forwardCommand(key, forward_incrbyfloat, &f)
+	}
+
+	node, value, err := e.storageAPI.IncrByFloat(key, by, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyIncrBy)
+	returnData.Node = node
+	returnData.Meta = value
+	return returnData, nil
+}
+
 func (e *EmbeddedService) CreateKey(key string, value string, ttl int) (*KeyValueAPIObject, error) {
 	nodeData := &rafty_objects.NodeValue{
 		TTL:   ttl,
@@ -322,16 +799,111 @@ func (e *EmbeddedService) UpdateKey(key, value string, ttl int) (*KeyValueAPIObj
 	return returnData, nil
 }
 
+// UpdateKeyIf updates a key only if it hasn't changed since prevIndex, the ModifiedIndex of the
+// node the caller last read. It fails with RAFTErrorCompareFailed if the key has been changed since.
+func (e *EmbeddedService) UpdateKeyIf(key, value string, ttl int, prevIndex uint64) (*KeyValueAPIObject, error) {
+	return e.updateKeyIf(key, value, ttl, &store.Condition{PrevIndex: prevIndex})
+}
+
+// UpdateKeyIfValue updates a key only if its current value is prevValue.
+func (e *EmbeddedService) UpdateKeyIfValue(key, value string, ttl int, prevValue string) (*KeyValueAPIObject, error) {
+	return e.updateKeyIf(key, value, ttl, &store.Condition{PrevValue: &prevValue})
+}
+
+func (e *EmbeddedService) updateKeyIf(key, value string, ttl int, cond *store.Condition) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key, Value: value, TTL: ttl}}
+		f.CAS.Cond = cond
+		return e.forwardCommand(key, forward_update_if, &f)
+	}
+
+	// Get the existing value
+	v, errResp := e.storageAPI.getKeyFromStore(key)
+	if errResp != nil {
+		return nil, errResp
+	}
+
+	nodeValue := &rafty_objects.NodeValue{}
+	if err := msgpack.Unmarshal(v, nodeValue); err != nil {
+		return nil, NewErrorResponse("/"+key, "Key marshalling failed: "+err.Error())
+	}
+
+	nodeValue.Value = value
+	nodeValue.TTL = ttl
+
+	// The condition is checked again as the write is applied, so a change in between is caught
+	var err *ErrorResponse
+	if nodeValue, err = e.storageAPI.SetKeyIf(key, nodeValue, cond); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyModified)
+	returnData.Node = nodeValue
+	return returnData, nil
+}
+
+// DeleteKeyIf deletes a key only if it hasn't changed since prevIndex.
+func (e *EmbeddedService) DeleteKeyIf(key string, prevIndex uint64) (*KeyValueAPIObject, error) {
+	return e.deleteKeyIf(key, &store.Condition{PrevIndex: prevIndex})
+}
+
+// DeleteKeyIfValue deletes a key only if its current value is prevValue.
+func (e *EmbeddedService) DeleteKeyIfValue(key, prevValue string) (*KeyValueAPIObject, error) {
+	return e.deleteKeyIf(key, &store.Condition{PrevValue: &prevValue})
+}
+
+func (e *EmbeddedService) deleteKeyIf(key string, cond *store.Condition) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: key}}
+		f.CAS.Cond = cond
+		return e.forwardCommand(key, forward_delete_if, &f)
+	}
+
+	if err := e.storageAPI.DeleteKeyIf(key, cond); err != nil {
+		return nil, err
+	}
+
+	delResp := NewKeyValueAPIObjectWithAction(ActionKeyDeleted)
+	delResp.Node.Key = "/" + key
+
+	return delResp, nil
+}
+
 func (e *EmbeddedService) GetKey(key string) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(key)
+	if readErr != nil {
+		return nil, readErr
+	}
+
 	// Get the existing value
 	returnValue, errResp := e.storageAPI.GetKey(key, false)
 	if errResp != nil {
 		return nil, errResp
 	}
 
+	returnValue.Index = index
 	return returnValue, nil
 }
 
+// ListKeys returns a page of the keys starting with prefix that sort after cursor, pass the Next
+// cursor of the returned page to get the page after it.
+func (e *EmbeddedService) ListKeys(prefix, cursor string, limit int) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(prefix)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	page, err := e.storageAPI.ListKeys(prefix, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeysListed)
+	returnData.Page = page
+	returnData.Index = index
+	return returnData, nil
+}
+
 func (e *EmbeddedService) DeleteKey(key string) (*KeyValueAPIObject, error) {
 
 	if !e.storageAPI.store.IsLeader() {
@@ -347,7 +919,125 @@ func (e *EmbeddedService) DeleteKey(key string) (*KeyValueAPIObject, error) {
 	return delResp, nil
 }
 
-func (e *EmbeddedService) forwardCommand(key string, command forwardingCommand, value *ForwardNodeValue) (*KeyValueAPIObject, error) {
+// AcquireLock takes the named lock for owner with a lease of ttl seconds, the lock's token can be
+// used to fence off holders whose lease has expired.
+func (e *EmbeddedService) AcquireLock(name, owner string, ttl int) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: name, TTL: ttl}}
+		f.LOCK.Owner = owner
+		return e.forwardCommand(name, forward_acquire_lock, &f)
+	}
+
+	lock, err := e.storageAPI.AcquireLock(name, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionLockAcquired)
+	returnData.Node.Key = name
+	returnData.Lock = lock
+	return returnData, nil
+}
+
+// RenewLease extends the lease on a lock held by owner by ttl seconds.
+func (e *EmbeddedService) RenewLease(name, owner string, ttl int) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: name, TTL: ttl}}
+		f.LOCK.Owner = owner
+		return e.forwardCommand(name, forward_renew_lease, &f)
+	}
+
+	lock, err := e.storageAPI.RenewLease(name, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionLockRenewed)
+	returnData.Node.Key = name
+	returnData.Lock = lock
+	return returnData, nil
+}
+
+// ReleaseLock releases a lock held by owner.
+func (e *EmbeddedService) ReleaseLock(name, owner string) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{NodeValue: rafty_objects.NodeValue{Key: name}}
+		f.LOCK.Owner = owner
+		return e.forwardCommand(name, forward_release_lock, &f)
+	}
+
+	if err := e.storageAPI.ReleaseLock(name, owner); err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionLockReleased)
+	returnData.Node.Key = name
+	return returnData, nil
+}
+
+// GetLock returns the current holder of the named lock.
+func (e *EmbeddedService) GetLock(name string) (*KeyValueAPIObject, error) {
+	index, readErr := e.verifyRead(name)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	lock, err := e.storageAPI.GetLock(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionLockRequested)
+	returnData.Node.Key = name
+	returnData.Lock = lock
+	returnData.Index = index
+	return returnData, nil
+}
+
+// Txn applies the checks and operations in req as a single change to the store, either all of the
+// operations are applied or none are. A transaction whose checks don't hold is not an error, the
+// Txn field of the returned object says whether it succeeded.
+func (e *EmbeddedService) Txn(req *TxnRequest) (*KeyValueAPIObject, error) {
+	if !e.storageAPI.store.IsLeader() {
+		f := ForwardNodeValue{}
+		f.TXN.Request = req
+		return e.forwardCommand("txn", forward_txn, &f)
+	}
+
+	result, err := e.storageAPI.Txn(req)
+	if err != nil {
+		return nil, err
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionTxn)
+	returnData.Txn = result
+	returnData.Index = result.Index
+	return returnData, nil
+}
+
+// WatchKey follows changes to a key on this node's copy of the store. If afterIndex is set the changes
+// after that index are delivered first, so a caller can resume from the last change it saw.
+func (e *EmbeddedService) WatchKey(key string, afterIndex uint64) (*Watcher, error) {
+	w, err := e.storageAPI.store.Watch(key, false, afterIndex)
+	if err != nil {
+		return nil, watchError(err)
+	}
+
+	return newWatcher(w), nil
+}
+
+// WatchPrefix is WatchKey for every key starting with prefix.
+func (e *EmbeddedService) WatchPrefix(prefix string, afterIndex uint64) (*Watcher, error) {
+	w, err := e.storageAPI.store.Watch(prefix, true, afterIndex)
+	if err != nil {
+		return nil, watchError(err)
+	}
+
+	return newWatcher(w), nil
+}
+
+// leaderClient returns a client for the leader's HTTP API
+func (e *EmbeddedService) leaderClient(key string) (*APIClient, error) {
 	trans := "http"
 	if e.TLS {
 		trans = "https"
@@ -366,7 +1056,14 @@ func (e *EmbeddedService) forwardCommand(key string, command forwardingCommand,
 		return nil, NewErrorResponse("/"+key, "Failed to forward to leader")
 	}
 
-	c := NewRaftyClient(targetAddr)
+	return NewRaftyClient(targetAddr), nil
+}
+
+func (e *EmbeddedService) forwardCommand(key string, command forwardingCommand, value *ForwardNodeValue) (*KeyValueAPIObject, error) {
+	c, err := e.leaderClient(key)
+	if err != nil {
+		return nil, err
+	}
 
 	switch command {
 	case forward_get:
@@ -387,6 +1084,42 @@ func (e *EmbeddedService) forwardCommand(key string, command forwardingCommand,
 		return c.ZAdd(key, value.ZADD.Score, value.ZADD.Value)
 	case forward_zremrangebyscore:
 		return c.ZRemRangeByScore(key, value.ZREMRANGEBYSCORE.Min, value.ZREMRANGEBYSCORE.Max)
+	case forward_acquire_lock:
+		return c.AcquireLock(key, value.LOCK.Owner, value.TTL)
+	case forward_renew_lease:
+		return c.RenewLease(key, value.LOCK.Owner, value.TTL)
+	case forward_release_lock:
+		return c.ReleaseLock(key, value.LOCK.Owner)
+	case forward_update_if:
+		return c.UpdateKeyIf(key, value.Value, strconv.Itoa(value.TTL), value.CAS.Cond)
+	case forward_delete_if:
+		return c.DeleteKeyIf(key, value.CAS.Cond)
+	case forward_txn:
+		return c.Txn(value.TXN.Request)
+	case forward_hset:
+		return c.HSet(key, value.HASH.Field, value.HASH.Value)
+	case forward_hdel:
+		return c.HDel(key, value.HASH.Fields...)
+	case forward_hincrby:
+		return c.HIncrBy(key, value.HASH.Field, value.HASH.By)
+	case forward_incrby:
+		return c.IncrBy(key, value.COUNTER.By, value.TTL)
+	case forward_incrbyfloat:
+		return c.IncrByFloat(key, value.COUNTER.ByFloat, value.TTL)
+	case forward_rpush:
+		return c.RPush(key, value.LIST.Values...)
+	case forward_lpop:
+		return c.BLPop(key, value.LIST.Timeout)
+	case forward_rpop:
+		return c.BRPop(key, value.LIST.Timeout)
+	case forward_ltrim:
+		return c.LTrim(key, value.LIST.Start, value.LIST.Stop)
+	case forward_lset:
+		return c.LSet(key, value.LIST.Index, value.LIST.Value)
+	case forward_srem:
+		return c.SRem(key, []byte(value.Value))
+	case forward_zrem:
+		return c.ZRem(key, value.ZREM.Value)
 	}
 
 	return nil, errors.New("Command not recognised")
@@ -2,16 +2,18 @@ package httpd
 
 import (
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
 
 	"bytes"
-	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
 	"time"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
 )
 
 type APIClient struct {
@@ -43,7 +45,7 @@ func (c *APIClient) processErrorResponse(resp *http.Response) error {
 		return nmErr
 	}
 
-	return errors.New(apiErrObject.String())
+	return apiErrObject
 }
 
 func (c *APIClient) GetKey(key string) (*KeyValueAPIObject, error) {
@@ -83,8 +85,59 @@ func (c *APIClient) GetKey(key string) (*KeyValueAPIObject, error) {
 	return newAPIReturnObject, nil
 }
 
+// ListKeys returns a page of the keys starting with prefix that sort after cursor
+func (c *APIClient) ListKeys(prefix, cursor string, limit int) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("prefix", prefix)
+	if cursor != "" {
+		vals.Add("cursor", cursor)
+	}
+	if limit > 0 {
+		vals.Add("limit", strconv.Itoa(limit))
+	}
+
+	u := strings.TrimSuffix(c.targetURL, "/key") + "/keys?" + vals.Encode()
+	thisHttpRequest, rErr := http.NewRequest("GET", u, nil)
+	if rErr != nil {
+		return nil, rErr
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	resp, respErr := client.Do(thisHttpRequest)
+	if respErr != nil {
+		return nil, respErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.processErrorResponse(resp)
+	}
+
+	body, bErr := ioutil.ReadAll(resp.Body)
+	if bErr != nil {
+		return nil, bErr
+	}
+
+	newAPIReturnObject := NewKeyValueAPIObject()
+
+	mErr := json.Unmarshal(body, newAPIReturnObject)
+	if mErr != nil {
+		return nil, mErr
+	}
+
+	return newAPIReturnObject, nil
+}
+
 func (c *APIClient) DeleteKey(key string) (*KeyValueAPIObject, error) {
-	u := c.targetURL + "/" + key
+	return c.DeleteKeyIf(key, nil)
+}
+
+// DeleteKeyIf deletes a key if cond holds, a nil cond always deletes
+func (c *APIClient) DeleteKeyIf(key string, cond *store.Condition) (*KeyValueAPIObject, error) {
+	u := c.targetURL + "/" + key + conditionQuery(cond)
 	thisHttpRequest, rErr := http.NewRequest("DELETE", u, nil)
 	if rErr != nil {
 		return nil, rErr
@@ -165,6 +218,11 @@ func (c *APIClient) CreateKey(key string, value string, ttl string) (*KeyValueAP
 }
 
 func (c *APIClient) UpdateKey(key string, value string, ttl string) (*KeyValueAPIObject, error) {
+	return c.UpdateKeyIf(key, value, ttl, nil)
+}
+
+// UpdateKeyIf updates a key if cond holds, a nil cond always updates
+func (c *APIClient) UpdateKeyIf(key string, value string, ttl string, cond *store.Condition) (*KeyValueAPIObject, error) {
 	valueToSend := value
 
 	vals := url.Values{}
@@ -174,7 +232,7 @@ func (c *APIClient) UpdateKey(key string, value string, ttl string) (*KeyValueAP
 
 	vals.Add("value", valueToSend)
 
-	u := c.targetURL + "/" + key
+	u := c.targetURL + "/" + key + conditionQuery(cond)
 	thisHttpRequest, rErr := http.NewRequest("PUT", u, bytes.NewBufferString(vals.Encode()))
 	thisHttpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
@@ -430,4 +488,365 @@ func (c *APIClient) ZRemRangeByScore(key string, min int64, max int64) (*KeyValu
 	return newAPIReturnObject, nil
 }
 
+func (c *APIClient) RPush(key string, values ...interface{}) (*KeyValueAPIObject, error) {
+	valueAsJSON, encErr := json.Marshal(values)
+	if encErr != nil {
+		return nil, encErr
+	}
+
+	vals := url.Values{}
+	vals.Add("value", string(valueAsJSON))
+	return c.doKeyOpRequest("PUT", "rpush", key, vals)
+}
+
+func (c *APIClient) LPop(key string) (*KeyValueAPIObject, error) {
+	return c.BLPop(key, 0)
+}
+
+func (c *APIClient) RPop(key string) (*KeyValueAPIObject, error) {
+	return c.BRPop(key, 0)
+}
+
+// BLPop waits up to timeout, rounded up to the second, for an item to pop
+func (c *APIClient) BLPop(key string, timeout time.Duration) (*KeyValueAPIObject, error) {
+	return c.doPopRequest("lpop", key, timeout)
+}
+
+func (c *APIClient) BRPop(key string, timeout time.Duration) (*KeyValueAPIObject, error) {
+	return c.doPopRequest("rpop", key, timeout)
+}
+
+func (c *APIClient) doPopRequest(op, key string, timeout time.Duration) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	if timeout > 0 {
+		seconds := (timeout + time.Second - 1) / time.Second
+		vals.Add("timeout", strconv.Itoa(int(seconds)))
+		timeout = seconds * time.Second
+	}
+
+	return c.doKeyOpRequestWithTimeout("PUT", op, key, vals, time.Second*10+timeout)
+}
+
+func (c *APIClient) LTrim(key string, start, stop int) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("start", strconv.Itoa(start))
+	vals.Add("stop", strconv.Itoa(stop))
+	return c.doKeyOpRequest("PUT", "ltrim", key, vals)
+}
+
+func (c *APIClient) LIndex(key string, index int) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("index", strconv.Itoa(index))
+	return c.doKeyOpRequest("GET", "lindex", key, vals)
+}
+
+func (c *APIClient) LSet(key string, index int, value interface{}) (*KeyValueAPIObject, error) {
+	valueAsJSON, encErr := json.Marshal(value)
+	if encErr != nil {
+		return nil, encErr
+	}
+
+	vals := url.Values{}
+	vals.Add("index", strconv.Itoa(index))
+	vals.Add("value", string(valueAsJSON))
+	return c.doKeyOpRequest("PUT", "lset", key, vals)
+}
+
+func (c *APIClient) SRem(key string, value []byte) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("value", string(value))
+	return c.doKeyOpRequest("DELETE", "srem", key, vals)
+}
+
+func (c *APIClient) SIsMember(key string, value []byte) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("value", string(value))
+	return c.doKeyOpRequest("GET", "sismember", key, vals)
+}
+
+func (c *APIClient) SCard(key string) (*KeyValueAPIObject, error) {
+	return c.doKeyOpRequest("GET", "scard", key, nil)
+}
+
+func (c *APIClient) ZRem(key string, value interface{}) (*KeyValueAPIObject, error) {
+	valueAsJSON, encErr := json.Marshal(value)
+	if encErr != nil {
+		return nil, encErr
+	}
+
+	vals := url.Values{}
+	vals.Add("value", string(valueAsJSON))
+	return c.doKeyOpRequest("DELETE", "zrem", key, vals)
+}
+
+func (c *APIClient) ZScore(key string, value interface{}) (*KeyValueAPIObject, error) {
+	valueAsJSON, encErr := json.Marshal(value)
+	if encErr != nil {
+		return nil, encErr
+	}
+
+	vals := url.Values{}
+	vals.Add("value", string(valueAsJSON))
+	return c.doKeyOpRequest("GET", "zscore", key, vals)
+}
+
+func (c *APIClient) ZCard(key string) (*KeyValueAPIObject, error) {
+	return c.doKeyOpRequest("GET", "zcard", key, nil)
+}
+
+func (c *APIClient) ZRange(key string, start, stop int) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("start", strconv.Itoa(start))
+	vals.Add("stop", strconv.Itoa(stop))
+	return c.doKeyOpRequest("GET", "zrange", key, vals)
+}
+
+func (c *APIClient) HSet(key, field string, value interface{}) (*KeyValueAPIObject, error) {
+	valueAsJSON, encErr := json.Marshal(value)
+	if encErr != nil {
+		return nil, encErr
+	}
+
+	vals := url.Values{}
+	vals.Add("field", field)
+	vals.Add("value", string(valueAsJSON))
+	return c.doKeyOpRequest("PUT", "hset", key, vals)
+}
+
+func (c *APIClient) HGet(key, field string) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("field", field)
+	return c.doKeyOpRequest("GET", "hget", key, vals)
+}
+
+func (c *APIClient) HGetAll(key string) (*KeyValueAPIObject, error) {
+	return c.doKeyOpRequest("GET", "hgetall", key, nil)
+}
+
+func (c *APIClient) HDel(key string, fields ...string) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	for _, field := range fields {
+		vals.Add("field", field)
+	}
+	return c.doKeyOpRequest("DELETE", "hdel", key, vals)
+}
+
+func (c *APIClient) HIncrBy(key, field string, by int64) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("field", field)
+	vals.Add("by", strconv.FormatInt(by, 10))
+	return c.doKeyOpRequest("PUT", "hincrby", key, vals)
+}
+
+func (c *APIClient) IncrBy(key string, by int64, ttl int) (*KeyValueAPIObject, error) {
+	return c.doKeyOpRequest("PUT", "incrby", key, counterValues(strconv.FormatInt(by, 10), ttl))
+}
+
+func (c *APIClient) DecrBy(key string, by int64, ttl int) (*KeyValueAPIObject, error) {
+	return c.doKeyOpRequest("PUT", "decrby", key, counterValues(strconv.FormatInt(by, 10), ttl))
+}
+
+func (c *APIClient) IncrByFloat(key string, by float64, ttl int) (*KeyValueAPIObject, error) {
+	return c.doKeyOpRequest("PUT", "incrbyfloat", key, counterValues(strconv.FormatFloat(by, 'f', -1, 64), ttl))
+}
+
+func counterValues(by string, ttl int) url.Values {
+	vals := url.Values{}
+	vals.Add("by", by)
+	if ttl > 0 {
+		vals.Add("ttl", strconv.Itoa(ttl))
+	}
+	return vals
+}
+
+// doKeyOpRequest sends a request to a /key/{op}/{key} endpoint, vals are sent as a form for PUTs
+// and in the query string otherwise
+func (c *APIClient) doKeyOpRequest(method, op, key string, vals url.Values) (*KeyValueAPIObject, error) {
+	return c.doKeyOpRequestWithTimeout(method, op, key, vals, time.Second*10)
+}
+
+// doKeyOpRequestWithTimeout is doKeyOpRequest for requests that may be held open by the server
+func (c *APIClient) doKeyOpRequestWithTimeout(method, op, key string, vals url.Values, timeout time.Duration) (*KeyValueAPIObject, error) {
+	u := c.targetURL + "/" + op + "/" + key
+
+	var body io.Reader
+	if method == "PUT" {
+		body = bytes.NewBufferString(vals.Encode())
+	} else if len(vals) > 0 {
+		u += "?" + vals.Encode()
+	}
+
+	thisHttpRequest, rErr := http.NewRequest(method, u, body)
+	if rErr != nil {
+		return nil, rErr
+	}
+	if body != nil {
+		thisHttpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+	}
+
+	resp, respErr := client.Do(thisHttpRequest)
+	if respErr != nil {
+		return nil, respErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.processErrorResponse(resp)
+	}
+
+	respBody, bErr := ioutil.ReadAll(resp.Body)
+	if bErr != nil {
+		return nil, bErr
+	}
+
+	newAPIReturnObject := NewKeyValueAPIObject()
+
+	mErr := json.Unmarshal(respBody, newAPIReturnObject)
+	if mErr != nil {
+		return nil, mErr
+	}
+
+	return newAPIReturnObject, nil
+}
+
+func (c *APIClient) AcquireLock(name, owner string, ttl int) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("owner", owner)
+	vals.Add("ttl", strconv.Itoa(ttl))
+
+	return c.doLockRequest("POST", name, vals, 201)
+}
+
+func (c *APIClient) RenewLease(name, owner string, ttl int) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("owner", owner)
+	vals.Add("ttl", strconv.Itoa(ttl))
+
+	return c.doLockRequest("PUT", name, vals, 200)
+}
+
+func (c *APIClient) ReleaseLock(name, owner string) (*KeyValueAPIObject, error) {
+	vals := url.Values{}
+	vals.Add("owner", owner)
+
+	return c.doLockRequest("DELETE", name, vals, 200)
+}
+
+func (c *APIClient) GetLock(name string) (*KeyValueAPIObject, error) {
+	return c.doLockRequest("GET", name, url.Values{}, 200)
+}
+
+// doLockRequest sends the lock parameters in the query string, the server doesn't read a form body
+// for DELETE requests
+func (c *APIClient) doLockRequest(method, name string, vals url.Values, expectStatus int) (*KeyValueAPIObject, error) {
+	u := c.targetURL + "/lock/" + name
+	if len(vals) > 0 {
+		u += "?" + vals.Encode()
+	}
+
+	thisHttpRequest, rErr := http.NewRequest(method, u, nil)
+	if rErr != nil {
+		return nil, rErr
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	resp, respErr := client.Do(thisHttpRequest)
+	if respErr != nil {
+		return nil, respErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectStatus {
+		return nil, c.processErrorResponse(resp)
+	}
+
+	body, bErr := ioutil.ReadAll(resp.Body)
+	if bErr != nil {
+		return nil, bErr
+	}
+
+	newAPIReturnObject := NewKeyValueAPIObject()
+
+	mErr := json.Unmarshal(body, newAPIReturnObject)
+	if mErr != nil {
+		return nil, mErr
+	}
+
+	return newAPIReturnObject, nil
+}
+
+// Txn applies a transaction on the target node
+func (c *APIClient) Txn(req *TxnRequest) (*KeyValueAPIObject, error) {
+	asJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	u := strings.TrimSuffix(c.targetURL, "/key") + "/txn"
+	thisHttpRequest, rErr := http.NewRequest("POST", u, bytes.NewBuffer(asJSON))
+	if rErr != nil {
+		return nil, rErr
+	}
+	thisHttpRequest.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	resp, respErr := client.Do(thisHttpRequest)
+	if respErr != nil {
+		return nil, respErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.processErrorResponse(resp)
+	}
+
+	body, bErr := ioutil.ReadAll(resp.Body)
+	if bErr != nil {
+		return nil, bErr
+	}
+
+	newAPIReturnObject := NewKeyValueAPIObject()
+
+	mErr := json.Unmarshal(body, newAPIReturnObject)
+	if mErr != nil {
+		return nil, mErr
+	}
+
+	return newAPIReturnObject, nil
+}
+
+// conditionQuery encodes a compare-and-swap condition as a query string
+func conditionQuery(cond *store.Condition) string {
+	if cond == nil {
+		return ""
+	}
+
+	vals := url.Values{}
+	if cond.PrevIndex != 0 {
+		vals.Add("prevIndex", strconv.FormatUint(cond.PrevIndex, 10))
+	}
+	if cond.PrevValue != nil {
+		vals.Add("prevValue", *cond.PrevValue)
+	}
+	if cond.PrevExist != nil {
+		vals.Add("prevExist", strconv.FormatBool(*cond.PrevExist))
+	}
+
+	if len(vals) == 0 {
+		return ""
+	}
+
+	return "?" + vals.Encode()
+}
+
 // TODO: Read commands for advanced objects
@@ -3,6 +3,7 @@ package httpd
 import (
 	"fmt"
 	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
 	"gopkg.in/vmihailenco/msgpack.v2"
 )
 
@@ -19,15 +20,43 @@ const (
 	ActionKeyListRemove          ActionType = "list_remove"
 	ActionKeyListLength          ActionType = "list_length"
 	ActionKeyListRange           ActionType = "list_range"
+	ActionKeyListPop             ActionType = "list_pop"
+	ActionKeyListTrim            ActionType = "list_trim"
+	ActionKeyListIndex           ActionType = "list_index"
+	ActionKeyListSet             ActionType = "list_set"
+	ActionKeySetRemove           ActionType = "set_remove"
+	ActionKeySetIsMember         ActionType = "set_is_member"
+	ActionKeySetCard             ActionType = "set_card"
 	ActionKeyZSetAdd             ActionType = "zset_add"
 	ActionKeyZSetRangeByScore    ActionType = "zset_range_score"
 	ActionKeyZSetRemRangeByScore ActionType = "zset_remrange_score"
+	ActionKeyZSetRemove          ActionType = "zset_remove"
+	ActionKeyZSetScore           ActionType = "zset_score"
+	ActionKeyZSetCard            ActionType = "zset_card"
+	ActionKeyZSetRange           ActionType = "zset_range"
+	ActionKeyHashSet             ActionType = "hash_set"
+	ActionKeyHashGet             ActionType = "hash_get"
+	ActionKeyHashGetAll          ActionType = "hash_get_all"
+	ActionKeyHashDelete          ActionType = "hash_delete"
+	ActionKeyHashIncrBy          ActionType = "hash_incrby"
+	ActionKeyIncrBy              ActionType = "incrby"
+	ActionLockAcquired           ActionType = "lock_acquired"
+	ActionLockRenewed            ActionType = "lock_renewed"
+	ActionLockReleased           ActionType = "lock_released"
+	ActionLockRequested          ActionType = "lock_requested"
+	ActionTxn                    ActionType = "txn"
+	ActionReadIndex              ActionType = "read_index"
+	ActionKeysListed             ActionType = "keys_listed"
 )
 
 type KeyValueAPIObject struct {
 	Action ActionType               `json:"action"`
 	Node   *rafty_objects.NodeValue `json:"node"`
 	Meta   interface{}              `json:"meta"`
+	Lock   *rafty_objects.Lock      `json:"lock,omitempty"`
+	Index  uint64                   `json:"index,omitempty"`
+	Txn    *store.TxnResult         `json:"txn,omitempty"`
+	Page   *store.KeyPage           `json:"page,omitempty"`
 }
 
 // NewKeyValueAPIObject creates a new object for use in the APi
@@ -53,6 +82,21 @@ func NewKeyValueAPIObjectFromMsgPack(payload []byte) (*KeyValueAPIObject, error)
 	return thisKV, err
 }
 
+// NewKeyValueAPIObjectFromEvent generates an API object for a change to a key from a watch, the node
+// is only filled in for plain key/value entries
+func NewKeyValueAPIObjectFromEvent(e store.Event) *KeyValueAPIObject {
+	thisKV := NewKeyValueAPIObjectWithAction(ActionType(e.Type))
+	if e.Value != nil {
+		if err := msgpack.Unmarshal(e.Value, thisKV.Node); err != nil {
+			thisKV.Node = &rafty_objects.NodeValue{}
+		}
+	}
+
+	thisKV.Node.Key = e.Key
+	thisKV.Index = e.Index
+	return thisKV
+}
+
 type ErrorCode struct {
 	Code   int    `json:"code"`
 	Reason string `json:"reason"`
@@ -62,6 +106,17 @@ var (
 	RAFTErrorNotFound        ErrorCode = ErrorCode{100, "Key not found"}
 	RAFTErrorWithApplication ErrorCode = ErrorCode{101, "Application error"}
 	RAFTErrorKeyExists       ErrorCode = ErrorCode{102, "Key Exists"}
+	RAFTErrorLockHeld        ErrorCode = ErrorCode{103, "Lock held by another owner"}
+	RAFTErrorLockNotHeld     ErrorCode = ErrorCode{104, "Lock not held"}
+	RAFTErrorIndexCleared    ErrorCode = ErrorCode{105, "Event index cleared"}
+	RAFTErrorCompareFailed   ErrorCode = ErrorCode{106, "Compare failed"}
+	RAFTErrorInvalidTxn      ErrorCode = ErrorCode{107, "Invalid transaction"}
+	RAFTErrorNotInteger      ErrorCode = ErrorCode{108, "Value is not an integer"}
+	RAFTErrorNotNumber       ErrorCode = ErrorCode{109, "Value is not a number"}
+	RAFTErrorOverflow        ErrorCode = ErrorCode{110, "Increment would overflow"}
+	RAFTErrorOutOfRange      ErrorCode = ErrorCode{111, "Index out of range"}
+	RAFTErrorWatchOverflow   ErrorCode = ErrorCode{112, "Watch fell behind"}
+	RAFTErrorReservedKey     ErrorCode = ErrorCode{113, "Key is reserved for locks"}
 )
 
 type ErrorResponse struct {
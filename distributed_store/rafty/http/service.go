@@ -7,12 +7,17 @@ import (
 	"fmt"
 	"github.com/TykTechnologies/logrus"
 	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
 	logger "github.com/TykTechnologies/tykcommon-logger"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 	"gopkg.in/vmihailenco/msgpack.v2"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	"net"
 )
 
@@ -29,12 +34,19 @@ type Store interface {
 	// Delete removes the given key, via distributed consensus.
 	Delete(key string) error
 
+	// SetNode and DeleteNode change a key/value node if the condition holds when the change is applied
+	SetNode(key string, value []byte, cond *store.Condition) (*rafty_objects.NodeValue, error)
+	DeleteNode(key string, cond *store.Condition) error
+
 	// Join joins the node, reachable at addr, to the cluster.
 	Join(addr string) error
 
 	// Returns whether the store is leader or not
 	IsLeader() bool
 
+	// OnLeaderChange registers a callback for leadership moves, it returns a function to remove it
+	OnLeaderChange(func(store.LeaderChange)) func()
+
 	// RemovePeer removes a peer
 	RemovePeer(string) error
 
@@ -51,10 +63,57 @@ type Store interface {
 	LLen(string) (int64, error)
 	LRem(string, int, interface{}) error
 	LRange(key string, from, to int) ([]interface{}, error)
+	RPush(key string, values ...interface{}) error
+	LPop(key string) (interface{}, bool, error)
+	RPop(key string) (interface{}, bool, error)
+	BLPop(key string, timeout time.Duration) (interface{}, bool, error)
+	BRPop(key string, timeout time.Duration) (interface{}, bool, error)
+	LTrim(key string, start, stop int) error
+	LIndex(key string, index int) (interface{}, bool, error)
+	LSet(key string, index int, value interface{}) error
+	SRem(key string, value []byte) error
+	SIsMember(key string, value []byte) (bool, error)
+	SCard(key string) (int64, error)
 
 	ZAdd(string, int64, interface{}) error
 	ZRemRangeByScore(string, int64, int64) error
 	ZRangeByScore(string, int64, int64) ([]interface{}, error)
+	ZRem(key string, value interface{}) error
+	ZScore(key string, value interface{}) (int64, bool, error)
+	ZCard(key string) (int64, error)
+	ZRange(key string, start, stop int) ([]interface{}, error)
+
+	// Hash operations
+	HSet(key, field string, value interface{}) error
+	HGet(key, field string) (interface{}, bool, error)
+	HGetAll(key string) (map[string]interface{}, error)
+	HDel(key string, fields ...string) error
+	HIncrBy(key, field string, by int64) (int64, error)
+
+	// Counters, ttl applies to counters that are created by the increment
+	IncrBy(key string, by int64, ttl int) (*rafty_objects.NodeValue, error)
+	IncrByFloat(key string, by float64, ttl int) (*rafty_objects.NodeValue, error)
+
+	// Lock operations, leases are in seconds
+	AcquireLock(name, owner string, ttl int) (*rafty_objects.Lock, error)
+	RenewLease(name, owner string, ttl int) (*rafty_objects.Lock, error)
+	ReleaseLock(name, owner string) error
+	ExpireLock(name string, token uint64) error
+	GetLock(name string) (*rafty_objects.Lock, error)
+
+	// Watch follows changes to a key, or to all keys with a prefix, from the local copy of the store
+	Watch(key string, prefix bool, afterIndex uint64) (*store.Watch, error)
+
+	// ListKeys returns a page of the keys starting with prefix that sort after cursor
+	ListKeys(prefix, cursor string, limit int) (*store.KeyPage, error)
+
+	// Txn applies checks and operations on several keys as a single change
+	Txn(checks []store.TxnCheck, ops []store.TxnOp) (*store.TxnResult, error)
+
+	// VerifyRead checks that a local read meets a consistency level and returns the index it will be
+	// at least as new as, WaitForIndex waits for the local copy of the store to reach an index
+	VerifyRead(store.Consistency) (uint64, error)
+	WaitForIndex(index uint64, timeout time.Duration) error
 }
 
 type TLSConfig struct {
@@ -99,6 +158,7 @@ func (s *Service) Start() error {
 	r.HandleFunc("/leader", s.handleIsLeader).Methods("GET")
 	r.HandleFunc("/setpeers", s.setPeers).Methods("POST")
 	r.HandleFunc("/remove", s.handleRemove).Methods("POST")
+	r.HandleFunc("/keys", s.handleListKeys).Methods("GET")
 	r.HandleFunc("/key/{name}", s.handleGetKey).Methods("GET")
 	r.HandleFunc("/key/{name}", s.handleUpdateKey).Methods("PUT")
 	r.HandleFunc("/key/{name}", s.handleCreateKey).Methods("POST")
@@ -106,8 +166,37 @@ func (s *Service) Start() error {
 	r.HandleFunc("/key/sadd/{name}", s.handleAddToSet).Methods("PUT")
 	r.HandleFunc("/key/lpush/{name}", s.handleLPush).Methods("PUT")
 	r.HandleFunc("/key/lrem/{name}", s.handleLRem).Methods("DELETE")
+	r.HandleFunc("/key/rpush/{name}", s.handleRPush).Methods("PUT")
+	r.HandleFunc("/key/lpop/{name}", s.handlePop).Methods("PUT")
+	r.HandleFunc("/key/rpop/{name}", s.handlePop).Methods("PUT")
+	r.HandleFunc("/key/ltrim/{name}", s.handleLTrim).Methods("PUT")
+	r.HandleFunc("/key/lindex/{name}", s.handleLIndex).Methods("GET")
+	r.HandleFunc("/key/lset/{name}", s.handleLSet).Methods("PUT")
+	r.HandleFunc("/key/srem/{name}", s.handleSRem).Methods("DELETE")
+	r.HandleFunc("/key/sismember/{name}", s.handleSIsMember).Methods("GET")
+	r.HandleFunc("/key/scard/{name}", s.handleSCard).Methods("GET")
 	r.HandleFunc("/key/zadd/{name}", s.handleZAdd).Methods("PUT")
 	r.HandleFunc("/key/zremrangebyscore/{name}", s.handleZRemRangeByScore).Methods("PUT")
+	r.HandleFunc("/key/zrem/{name}", s.handleZRem).Methods("DELETE")
+	r.HandleFunc("/key/zscore/{name}", s.handleZScore).Methods("GET")
+	r.HandleFunc("/key/zcard/{name}", s.handleZCard).Methods("GET")
+	r.HandleFunc("/key/zrange/{name}", s.handleZRange).Methods("GET")
+	r.HandleFunc("/key/hset/{name}", s.handleHSet).Methods("PUT")
+	r.HandleFunc("/key/hget/{name}", s.handleHGet).Methods("GET")
+	r.HandleFunc("/key/hgetall/{name}", s.handleHGetAll).Methods("GET")
+	r.HandleFunc("/key/hdel/{name}", s.handleHDel).Methods("DELETE")
+	r.HandleFunc("/key/hincrby/{name}", s.handleHIncrBy).Methods("PUT")
+	r.HandleFunc("/key/incrby/{name}", s.handleIncrBy).Methods("PUT")
+	r.HandleFunc("/key/decrby/{name}", s.handleIncrBy).Methods("PUT")
+	r.HandleFunc("/key/incrbyfloat/{name}", s.handleIncrBy).Methods("PUT")
+	r.HandleFunc("/key/lock/{name}", s.handleGetLock).Methods("GET")
+	r.HandleFunc("/key/lock/{name}", s.handleAcquireLock).Methods("POST")
+	r.HandleFunc("/key/lock/{name}", s.handleRenewLease).Methods("PUT")
+	r.HandleFunc("/key/lock/{name}", s.handleReleaseLock).Methods("DELETE")
+	r.HandleFunc("/watch/{prefix:.*}", s.handleWatch).Methods("GET")
+	r.HandleFunc("/txn", s.handleTxn).Methods("POST")
+	r.HandleFunc("/index", s.handleReadIndex).Methods("GET")
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
 
 	go func() {
 		// Check TLS
@@ -265,6 +354,11 @@ func (s *Service) handleGetKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
 	// Get the existing value
 	returnValue, errResp := s.StorageAPI.GetKey(k, false)
 	if errResp != nil {
@@ -274,11 +368,42 @@ func (s *Service) handleGetKey(w http.ResponseWriter, r *http.Request) {
 		}
 
 		s.writeToClient(w, r, errResp, http.StatusBadRequest)
+		return
 	}
 
+	returnValue.Index = index
 	s.writeToClient(w, r, returnValue, 200)
 }
 
+func (s *Service) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var limit int
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			s.writeToClient(w, r, NewErrorResponse("/keys", "limit must be number: "+err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	page, errResp := s.StorageAPI.ListKeys(q.Get("prefix"), q.Get("cursor"), limit)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusInternalServerError)
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeysListed)
+	returnData.Page = page
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
 func (s *Service) handleCreateKey(w http.ResponseWriter, r *http.Request) {
 	if !s.store.IsLeader() {
 		s.forwardRequest(w, r)
@@ -342,6 +467,12 @@ func (s *Service) handleUpdateKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	cond, condErr := readCondition(r)
+	if condErr != nil {
+		s.writeToClient(w, r, condErr, http.StatusBadRequest)
+		return
+	}
+
 	// Get the existing value
 	v, errResp := s.StorageAPI.getKeyFromStore(k)
 	if errResp != nil {
@@ -382,14 +513,15 @@ func (s *Service) handleUpdateKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Write data to the store
-	if _, err := s.StorageAPI.SetKey(k, &nodeValue, true); err != nil {
-		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not write to store: "+err.ErrorCode.Reason), http.StatusInternalServerError)
+	stored, errResp := s.StorageAPI.SetKeyIf(k, &nodeValue, cond)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
 		return
 	}
 
 	// Return ok
 	returnData := NewKeyValueAPIObjectWithAction(ActionKeyModified)
-	returnData.Node = &nodeValue
+	returnData.Node = stored
 
 	s.writeToClient(w, r, returnData, http.StatusOK)
 }
@@ -407,8 +539,19 @@ func (s *Service) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := s.StorageAPI.DeleteKey(k); err != nil {
-		s.writeToClient(w, r, err, http.StatusInternalServerError)
+	cond, condErr := readCondition(r)
+	if condErr != nil {
+		s.writeToClient(w, r, condErr, http.StatusBadRequest)
+		return
+	}
+
+	if cond != nil {
+		if errResp := s.StorageAPI.DeleteKeyIf(k, cond); errResp != nil {
+			s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+			return
+		}
+	} else if _, err := s.StorageAPI.DeleteKey(k); err != nil {
+		s.writeToClient(w, r, err, storeErrorStatus(err))
 		return
 	}
 
@@ -447,7 +590,7 @@ func (s *Service) handleAddToSet(w http.ResponseWriter, r *http.Request) {
 
 	// Write data to the store
 	if _, err := s.StorageAPI.AddToSet(k, []byte(value)); err != nil {
-		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not add to set: "+err.ErrorCode.Reason), http.StatusInternalServerError)
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not add to set: "+err.ErrorCode.Reason), storeErrorStatus(err))
 		return
 	}
 
@@ -491,7 +634,7 @@ func (s *Service) handleLPush(w http.ResponseWriter, r *http.Request) {
 
 	// Write data to the store
 	if err := s.StorageAPI.LPush(k, values...); err != nil {
-		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not push to list: "+err.ErrorCode.Reason), http.StatusInternalServerError)
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not push to list: "+err.ErrorCode.Reason), storeErrorStatus(err))
 		return
 	}
 
@@ -547,7 +690,7 @@ func (s *Service) handleLRem(w http.ResponseWriter, r *http.Request) {
 
 	// Write data to the store
 	if err := s.StorageAPI.LRem(k, count, value); err != nil {
-		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not remove from list: "+err.ErrorCode.Reason), http.StatusInternalServerError)
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not remove from list: "+err.ErrorCode.Reason), storeErrorStatus(err))
 		return
 	}
 
@@ -603,7 +746,7 @@ func (s *Service) handleZAdd(w http.ResponseWriter, r *http.Request) {
 
 	// Write data to the store
 	if err := s.StorageAPI.ZAdd(k, int64(score), val); err != nil {
-		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not add to list: "+err.ErrorCode.Reason), http.StatusInternalServerError)
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not add to list: "+err.ErrorCode.Reason), storeErrorStatus(err))
 		return
 	}
 
@@ -660,7 +803,7 @@ func (s *Service) handleZRemRangeByScore(w http.ResponseWriter, r *http.Request)
 
 	// Write data to the store
 	if err := s.StorageAPI.ZRemRangeByScore(k, int64(min), int64(max)); err != nil {
-		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not perform RemRangeByScore: "+err.ErrorCode.Reason), http.StatusInternalServerError)
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not perform RemRangeByScore: "+err.ErrorCode.Reason), storeErrorStatus(err))
 		return
 	}
 
@@ -668,3 +811,438 @@ func (s *Service) handleZRemRangeByScore(w http.ResponseWriter, r *http.Request)
 	returnData := NewKeyValueAPIObjectWithAction(ActionKeyZSetRemRangeByScore)
 	s.writeToClient(w, r, returnData, http.StatusOK)
 }
+
+func (s *Service) handleHSet(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for PUT"), http.StatusBadRequest)
+		return
+	}
+
+	// Read the parameters from the PUT body as form params
+	err := r.ParseForm()
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not parse form data: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	field := r.Form.Get("field")
+	if field == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Field cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	value := r.Form.Get("value")
+	if value == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	var val interface{}
+	if err := json.Unmarshal([]byte(value), &val); err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Value must be object, err: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if errResp := s.StorageAPI.HSet(k, field, val); errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashSet)
+	returnData.Node.Key = k
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleHGet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	field := r.URL.Query().Get("field")
+	if k == "" || field == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "key and field cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	value, errResp := s.StorageAPI.HGet(k, field)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashGet)
+	returnData.Node.Key = k
+	returnData.Meta = value
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleHGetAll(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	h, errResp := s.StorageAPI.HGetAll(k)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusInternalServerError)
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashGetAll)
+	returnData.Node.Key = k
+	returnData.Meta = h
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleHDel(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for DELETE"), http.StatusBadRequest)
+		return
+	}
+
+	// DELETE bodies aren't parsed, so the fields are read from the query string
+	fields := r.URL.Query()["field"]
+	if len(fields) == 0 {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Field cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	if errResp := s.StorageAPI.HDel(k, fields...); errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashDelete)
+	returnData.Node.Key = k
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleHIncrBy(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for PUT"), http.StatusBadRequest)
+		return
+	}
+
+	// Read the parameters from the PUT body as form params
+	err := r.ParseForm()
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not parse form data: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	field := r.Form.Get("field")
+	if field == "" {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Field cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	by, byErr := strconv.ParseInt(r.Form.Get("by"), 10, 64)
+	if byErr != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "by must be number: "+byErr.Error()), http.StatusBadRequest)
+		return
+	}
+
+	value, errResp := s.StorageAPI.HIncrBy(k, field, by)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyHashIncrBy)
+	returnData.Node.Key = k
+	returnData.Meta = value
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+// handleIncrBy serves incrby, decrby and incrbyfloat, by defaults to 1
+func (s *Service) handleIncrBy(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "key cannot be empty for PUT"), http.StatusBadRequest)
+		return
+	}
+
+	// Read the parameters from the PUT body as form params
+	err := r.ParseForm()
+	if err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/"+k, "Could not parse form data: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	by := r.Form.Get("by")
+	if by == "" {
+		by = "1"
+	}
+
+	var ttl int
+	if t := r.Form.Get("ttl"); t != "" {
+		var ttlErr error
+		if ttl, ttlErr = strconv.Atoi(t); ttlErr != nil {
+			s.writeToClient(w, r, NewErrorResponse("/"+k, "ttl must be number: "+ttlErr.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var node *rafty_objects.NodeValue
+	var value interface{}
+	var errResp *ErrorResponse
+	if strings.HasPrefix(r.URL.Path, "/key/incrbyfloat/") {
+		byFloat, byErr := strconv.ParseFloat(by, 64)
+		if byErr != nil {
+			s.writeToClient(w, r, NewErrorResponse("/"+k, "by must be number: "+byErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		node, value, errResp = s.StorageAPI.IncrByFloat(k, byFloat, ttl)
+	} else {
+		byInt, byErr := strconv.ParseInt(by, 10, 64)
+		if byErr != nil {
+			s.writeToClient(w, r, NewErrorResponse("/"+k, "by must be integer: "+byErr.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/key/decrby/") {
+			if byInt == math.MinInt64 {
+				s.writeToClient(w, r, NewErrorResponse("/"+k, "by is out of range"), http.StatusBadRequest)
+				return
+			}
+			byInt = -byInt
+		}
+
+		node, value, errResp = s.StorageAPI.IncrBy(k, byInt, ttl)
+	}
+
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionKeyIncrBy)
+	returnData.Node = node
+	returnData.Meta = value
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleGetLock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		s.writeToClient(w, r, NewErrorResponse("/", "lock name cannot be empty for GET"), http.StatusBadRequest)
+		return
+	}
+
+	index, ok := s.verifyRead(w, r)
+	if !ok {
+		return
+	}
+
+	lock, errResp := s.StorageAPI.GetLock(k, false)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionLockRequested)
+	returnData.Node.Key = k
+	returnData.Lock = lock
+	returnData.Index = index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleAcquireLock(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	k, owner, ttl, errResp := s.readLockRequest(r, true)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusBadRequest)
+		return
+	}
+
+	lock, errResp := s.StorageAPI.AcquireLock(k, owner, ttl)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionLockAcquired)
+	returnData.Node.Key = k
+	returnData.Lock = lock
+	s.writeToClient(w, r, returnData, http.StatusCreated)
+}
+
+func (s *Service) handleRenewLease(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	k, owner, ttl, errResp := s.readLockRequest(r, true)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusBadRequest)
+		return
+	}
+
+	lock, errResp := s.StorageAPI.RenewLease(k, owner, ttl)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionLockRenewed)
+	returnData.Node.Key = k
+	returnData.Lock = lock
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+func (s *Service) handleReleaseLock(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	k, owner, _, errResp := s.readLockRequest(r, false)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, http.StatusBadRequest)
+		return
+	}
+
+	if errResp := s.StorageAPI.ReleaseLock(k, owner); errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionLockReleased)
+	returnData.Node.Key = k
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
+
+// readLockRequest reads the lock name, owner and (if needed) the lease TTL from a request, the
+// owner may be sent in the query string as DELETE requests don't have a form body
+func (s *Service) readLockRequest(r *http.Request, withTTL bool) (string, string, int, *ErrorResponse) {
+	vars := mux.Vars(r)
+	k := vars["name"]
+	if k == "" {
+		return "", "", 0, NewErrorResponse("/", "lock name cannot be empty")
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return "", "", 0, NewErrorResponse("/lock/"+k, "Could not parse form data: "+err.Error())
+	}
+
+	owner := r.Form.Get("owner")
+	if owner == "" {
+		return "", "", 0, NewErrorResponse("/lock/"+k, "Owner cannot be empty")
+	}
+
+	if !withTTL {
+		return k, owner, 0, nil
+	}
+
+	ttl, err := strconv.Atoi(r.Form.Get("ttl"))
+	if err != nil {
+		return "", "", 0, NewErrorResponse("/lock/"+k, "TTL must be number: "+err.Error())
+	}
+
+	if ttl <= 0 {
+		return "", "", 0, NewErrorResponse("/lock/"+k, "TTL must be greater than zero")
+	}
+
+	return k, owner, ttl, nil
+}
+
+// readCondition reads the compare-and-swap parameters of a request from its query string, it
+// returns nil if there are none
+func readCondition(r *http.Request) (*store.Condition, *ErrorResponse) {
+	q := r.URL.Query()
+	cond := &store.Condition{}
+	var isSet bool
+
+	if pi := q.Get("prevIndex"); pi != "" {
+		prevIndex, err := strconv.ParseUint(pi, 10, 64)
+		if err != nil {
+			return nil, NewErrorResponse(r.URL.Path, "prevIndex must be number: "+err.Error())
+		}
+		cond.PrevIndex = prevIndex
+		isSet = true
+	}
+
+	if pv, found := q["prevValue"]; found && len(pv) > 0 {
+		cond.PrevValue = &pv[0]
+		isSet = true
+	}
+
+	if pe := q.Get("prevExist"); pe != "" {
+		prevExist, err := strconv.ParseBool(pe)
+		if err != nil {
+			return nil, NewErrorResponse(r.URL.Path, "prevExist must be true or false: "+err.Error())
+		}
+		cond.PrevExist = &prevExist
+		isSet = true
+	}
+
+	if !isSet {
+		return nil, nil
+	}
+
+	return cond, nil
+}
+
+func storeErrorStatus(errResp *ErrorResponse) int {
+	switch errResp.ErrorCode {
+	case RAFTErrorNotFound:
+		return http.StatusNotFound
+	case RAFTErrorLockHeld, RAFTErrorLockNotHeld, RAFTErrorNotInteger, RAFTErrorNotNumber, RAFTErrorOverflow,
+		RAFTErrorOutOfRange:
+		return http.StatusConflict
+	case RAFTErrorCompareFailed, RAFTErrorKeyExists:
+		return http.StatusPreconditionFailed
+	case RAFTErrorInvalidTxn:
+		return http.StatusBadRequest
+	case RAFTErrorReservedKey:
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
@@ -2,16 +2,24 @@ package httpd
 
 import (
 	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
 	"github.com/foize/go.fifo"
 	"time"
 
 	"encoding/json"
 	"github.com/TykTechnologies/logrus"
+	"strconv"
+	"strings"
 	"sync"
 )
 
 const (
 	TTLSNAPSHOT_KEY = "TCF_TTL_SNAPHOT"
+
+	// DefaultListLimit and MaxListLimit bound the number of keys ListKeys returns at once
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
 )
 
 type SnapshotStatus int
@@ -106,28 +114,51 @@ func (s *StorageAPI) GetKey(k string, evenIfExpired bool) (*KeyValueAPIObject, *
 	return returnValue, nil
 }
 
+// ListKeys returns a page of the keys starting with prefix that sort after cursor, with the metadata
+// of key/value nodes. A limit of 0 returns DefaultListLimit keys, and no more than MaxListLimit are
+// returned at once.
+func (s *StorageAPI) ListKeys(prefix, cursor string, limit int) (*store.KeyPage, *ErrorResponse) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	page, err := s.store.ListKeys(prefix, cursor, limit)
+	if err != nil {
+		return nil, NewErrorResponse("/keys", "Could not list keys: "+err.Error())
+	}
+
+	return page, nil
+}
+
 func (s *StorageAPI) SetKey(k string, value *rafty_objects.NodeValue, overwrite bool) (*rafty_objects.NodeValue, *ErrorResponse) {
-	// Don't allow overwriting unless expired
-	existingValue, errResp := s.getKeyFromStore(k)
-	asNode, checkErr := NewKeyValueAPIObjectFromMsgPack(existingValue)
-
-	var allowOverwrite = overwrite
-	if checkErr == nil {
-		if time.Now().After(asNode.Node.Expiration) && asNode.Node.TTL != 0 {
-			allowOverwrite = true
-		}
+	// Don't allow overwriting unless expired, expired keys count as absent
+	var cond *store.Condition
+	if !overwrite {
+		cond = store.IfAbsent()
 	}
 
-	if errResp == nil && allowOverwrite == false {
-		keyExistsErr := NewErrorResponse("/"+k, RAFTErrorKeyExists)
-		return nil, keyExistsErr
+	return s.SetKeyIf(k, value, cond)
+}
+
+// SetKeyIf writes a key if cond holds when the write is applied, a nil cond always writes. The
+// returned node carries the raft indexes of the write.
+func (s *StorageAPI) SetKeyIf(k string, value *rafty_objects.NodeValue, cond *store.Condition) (*rafty_objects.NodeValue, *ErrorResponse) {
+	if errResp := checkWritable(k); errResp != nil {
+		return nil, errResp
+	}
+
+	if k == "" {
+		return nil, NewErrorResponse("/"+k, "Key cannot be empty")
 	}
 
 	value.Key = k
 
 	// Set expiry value
 	value.CalculateExpiry()
-	if !overwrite {
+	if value.Created == 0 {
 		value.Created = time.Now().Unix()
 	}
 	value.LastUpdated = time.Now().Unix()
@@ -138,19 +169,24 @@ func (s *StorageAPI) SetKey(k string, value *rafty_objects.NodeValue, overwrite
 	}
 
 	// Write data to the store
-	if err := s.store.Set(k, toStore); err != nil {
-		return nil, NewErrorResponse("/"+k, "Could not write to store: "+err.Error())
+	stored, err := s.store.SetNode(k, toStore, cond)
+	if err != nil {
+		return nil, newStoreErrorResponse("/"+k, "Could not write to store: ", err)
 	}
 
 	// Track the TTL
-	if value.TTL > 0 && value.Key != TTLSNAPSHOT_KEY {
-		s.trackTTLForKey(value.Key, value.Expiration.Unix())
+	if stored.TTL > 0 && stored.Key != TTLSNAPSHOT_KEY {
+		s.trackTTLForKey(stored.Key, stored.Expiration.Unix())
 	}
 
-	return value, nil
+	return stored, nil
 }
 
 func (s *StorageAPI) AddToSet(k string, value []byte) ([]byte, *ErrorResponse) {
+	if errResp := checkWritable(k); errResp != nil {
+		return nil, errResp
+	}
+
 	// Write data to the store
 	if err := s.store.AddToSet(k, value); err != nil {
 		return nil, NewErrorResponse("/"+k, "Could not add to set: "+err.Error())
@@ -172,6 +208,10 @@ func (s *StorageAPI) GetSet(k string) (map[interface{}]interface{}, *ErrorRespon
 }
 
 func (s *StorageAPI) LPush(key string, values ...interface{}) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
 	if err := s.store.LPush(key, values...); err != nil {
 		return NewErrorResponse("/"+key, "Could not get set: "+err.Error())
 	}
@@ -191,6 +231,10 @@ func (s *StorageAPI) LLen(key string) (int64, *ErrorResponse) {
 }
 
 func (s *StorageAPI) LRem(key string, count int, value interface{}) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
 	if err := s.store.LRem(key, count, value); err != nil {
 		return NewErrorResponse("/"+key, "Could not get set: "+err.Error())
 	}
@@ -209,7 +253,142 @@ func (s *StorageAPI) LRange(key string, from, to int) ([]interface{}, *ErrorResp
 	return value, nil
 }
 
+func (s *StorageAPI) RPush(key string, values ...interface{}) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.RPush(key, values...); err != nil {
+		return NewErrorResponse("/"+key, "Could not push to list: "+err.Error())
+	}
+
+	return nil
+}
+
+// LPop pops the first item of a list, with RAFTErrorNotFound if the list is empty. A timeout above
+// 0 waits that long for an item to be pushed.
+func (s *StorageAPI) LPop(key string, timeout time.Duration) (interface{}, *ErrorResponse) {
+	if errResp := checkWritable(key); errResp != nil {
+		return nil, errResp
+	}
+
+	var value interface{}
+	var found bool
+	var err error
+
+	if timeout > 0 {
+		value, found, err = s.store.BLPop(key, timeout)
+	} else {
+		value, found, err = s.store.LPop(key)
+	}
+
+	return popResponse(key, value, found, err)
+}
+
+// RPop is LPop for the last item of a list
+func (s *StorageAPI) RPop(key string, timeout time.Duration) (interface{}, *ErrorResponse) {
+	if errResp := checkWritable(key); errResp != nil {
+		return nil, errResp
+	}
+
+	var value interface{}
+	var found bool
+	var err error
+
+	if timeout > 0 {
+		value, found, err = s.store.BRPop(key, timeout)
+	} else {
+		value, found, err = s.store.RPop(key)
+	}
+
+	return popResponse(key, value, found, err)
+}
+
+func popResponse(key string, value interface{}, found bool, err error) (interface{}, *ErrorResponse) {
+	if err != nil {
+		return nil, NewErrorResponse("/"+key, "Could not pop from list: "+err.Error())
+	}
+
+	if !found {
+		return nil, NewErrorNotFound("/" + key)
+	}
+
+	return value, nil
+}
+
+func (s *StorageAPI) LTrim(key string, start, stop int) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.LTrim(key, start, stop); err != nil {
+		return NewErrorResponse("/"+key, "Could not trim list: "+err.Error())
+	}
+
+	return nil
+}
+
+// LIndex returns an item of a list, with RAFTErrorNotFound if there is no item at index
+func (s *StorageAPI) LIndex(key string, index int) (interface{}, *ErrorResponse) {
+	value, found, err := s.store.LIndex(key, index)
+	if err != nil {
+		return nil, NewErrorResponse("/"+key, "Could not get list item: "+err.Error())
+	}
+
+	if !found {
+		return nil, NewErrorNotFound("/" + key + "/" + strconv.Itoa(index))
+	}
+
+	return value, nil
+}
+
+func (s *StorageAPI) LSet(key string, index int, value interface{}) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.LSet(key, index, value); err != nil {
+		return newStoreErrorResponse("/"+key, "Could not set list item: ", err)
+	}
+
+	return nil
+}
+
+func (s *StorageAPI) SRem(key string, value []byte) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.SRem(key, value); err != nil {
+		return NewErrorResponse("/"+key, "Could not remove from set: "+err.Error())
+	}
+
+	return nil
+}
+
+func (s *StorageAPI) SIsMember(key string, value []byte) (bool, *ErrorResponse) {
+	isMember, err := s.store.SIsMember(key, value)
+	if err != nil {
+		return false, NewErrorResponse("/"+key, "Could not get set: "+err.Error())
+	}
+
+	return isMember, nil
+}
+
+func (s *StorageAPI) SCard(key string) (int64, *ErrorResponse) {
+	n, err := s.store.SCard(key)
+	if err != nil {
+		return 0, NewErrorResponse("/"+key, "Could not get set: "+err.Error())
+	}
+
+	return n, nil
+}
+
 func (s *StorageAPI) ZAdd(key string, score int64, value interface{}) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
 	if err := s.store.ZAdd(key, score, value); err != nil {
 		return NewErrorResponse("/"+key, "Could not add to sorted set: "+err.Error())
 	}
@@ -229,6 +408,10 @@ func (s *StorageAPI) ZRangeByScore(key string, min, max int64) ([]interface{}, *
 }
 
 func (s *StorageAPI) ZRemRangeByScore(key string, min int64, max int64) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
 	if err := s.store.ZRemRangeByScore(key, min, max); err != nil {
 		return NewErrorResponse("/"+key, "Could not remrange from zset: "+err.Error())
 	}
@@ -236,7 +419,270 @@ func (s *StorageAPI) ZRemRangeByScore(key string, min int64, max int64) *ErrorRe
 	return nil
 }
 
+func (s *StorageAPI) ZRem(key string, value interface{}) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.ZRem(key, value); err != nil {
+		return NewErrorResponse("/"+key, "Could not remove from zset: "+err.Error())
+	}
+
+	return nil
+}
+
+// ZScore returns the score of a zset member, with RAFTErrorNotFound if it isn't a member
+func (s *StorageAPI) ZScore(key string, value interface{}) (int64, *ErrorResponse) {
+	score, found, err := s.store.ZScore(key, value)
+	if err != nil {
+		return 0, NewErrorResponse("/"+key, "Could not get zset score: "+err.Error())
+	}
+
+	if !found {
+		return 0, NewErrorNotFound("/" + key)
+	}
+
+	return score, nil
+}
+
+func (s *StorageAPI) ZCard(key string) (int64, *ErrorResponse) {
+	n, err := s.store.ZCard(key)
+	if err != nil {
+		return 0, NewErrorResponse("/"+key, "Could not get zset: "+err.Error())
+	}
+
+	return n, nil
+}
+
+func (s *StorageAPI) ZRange(key string, start, stop int) ([]interface{}, *ErrorResponse) {
+	r, err := s.store.ZRange(key, start, stop)
+	if err != nil {
+		return nil, NewErrorResponse("/"+key, "Could not get range from zset: "+err.Error())
+	}
+
+	return r, nil
+}
+
+func (s *StorageAPI) HSet(key, field string, value interface{}) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.HSet(key, field, value); err != nil {
+		return NewErrorResponse("/"+key, "Could not set hash field: "+err.Error())
+	}
+
+	return nil
+}
+
+// HGet returns a field of a hash, with RAFTErrorNotFound if the field isn't set
+func (s *StorageAPI) HGet(key, field string) (interface{}, *ErrorResponse) {
+	value, found, err := s.store.HGet(key, field)
+	if err != nil {
+		return nil, NewErrorResponse("/"+key, "Could not get hash field: "+err.Error())
+	}
+
+	if !found {
+		return nil, NewErrorNotFound("/" + key + "/" + field)
+	}
+
+	return value, nil
+}
+
+func (s *StorageAPI) HGetAll(key string) (map[string]interface{}, *ErrorResponse) {
+	h, err := s.store.HGetAll(key)
+	if err != nil {
+		return nil, NewErrorResponse("/"+key, "Could not get hash: "+err.Error())
+	}
+
+	return h, nil
+}
+
+func (s *StorageAPI) HDel(key string, fields ...string) *ErrorResponse {
+	if errResp := checkWritable(key); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.HDel(key, fields...); err != nil {
+		return NewErrorResponse("/"+key, "Could not delete hash fields: "+err.Error())
+	}
+
+	return nil
+}
+
+func (s *StorageAPI) HIncrBy(key, field string, by int64) (int64, *ErrorResponse) {
+	if errResp := checkWritable(key); errResp != nil {
+		return 0, errResp
+	}
+
+	value, err := s.store.HIncrBy(key, field, by)
+	if err != nil {
+		return 0, newStoreErrorResponse("/"+key, "Could not increment hash field: ", err)
+	}
+
+	return value, nil
+}
+
+// IncrBy adds by to the counter at key and returns its node and value, a counter that is created
+// by the increment expires after ttl seconds if ttl is above 0
+func (s *StorageAPI) IncrBy(key string, by int64, ttl int) (*rafty_objects.NodeValue, int64, *ErrorResponse) {
+	if errResp := checkWritable(key); errResp != nil {
+		return nil, 0, errResp
+	}
+
+	node, err := s.store.IncrBy(key, by, ttl)
+	if err != nil {
+		return nil, 0, newStoreErrorResponse("/"+key, "Could not increment: ", err)
+	}
+	s.trackCounterTTL(node)
+
+	value, _ := strconv.ParseInt(node.Value, 10, 64)
+	return node, value, nil
+}
+
+// IncrByFloat is IncrBy for floating point counters
+func (s *StorageAPI) IncrByFloat(key string, by float64, ttl int) (*rafty_objects.NodeValue, float64, *ErrorResponse) {
+	if errResp := checkWritable(key); errResp != nil {
+		return nil, 0, errResp
+	}
+
+	node, err := s.store.IncrByFloat(key, by, ttl)
+	if err != nil {
+		return nil, 0, newStoreErrorResponse("/"+key, "Could not increment: ", err)
+	}
+	s.trackCounterTTL(node)
+
+	value, _ := strconv.ParseFloat(node.Value, 64)
+	return node, value, nil
+}
+
+// trackCounterTTL tracks the TTL of a counter the first time it is written
+func (s *StorageAPI) trackCounterTTL(node *rafty_objects.NodeValue) {
+	if node.TTL > 0 && node.CreatedIndex == node.ModifiedIndex {
+		s.trackTTLForKey(node.Key, node.Expiration.Unix())
+	}
+}
+
+func (s *StorageAPI) AcquireLock(name, owner string, ttl int) (*rafty_objects.Lock, *ErrorResponse) {
+	if errResp := checkLockRequest(name, owner); errResp != nil {
+		return nil, errResp
+	}
+
+	if ttl <= 0 {
+		return nil, NewErrorResponse("/lock/"+name, "TTL must be greater than zero")
+	}
+
+	lock, err := s.store.AcquireLock(name, owner, ttl)
+	if err != nil {
+		return nil, newStoreErrorResponse("/lock/"+name, "Could not acquire lock: ", err)
+	}
+
+	s.trackTTLForLock(lock)
+	return lock, nil
+}
+
+func (s *StorageAPI) RenewLease(name, owner string, ttl int) (*rafty_objects.Lock, *ErrorResponse) {
+	if errResp := checkLockRequest(name, owner); errResp != nil {
+		return nil, errResp
+	}
+
+	if ttl <= 0 {
+		return nil, NewErrorResponse("/lock/"+name, "TTL must be greater than zero")
+	}
+
+	lock, err := s.store.RenewLease(name, owner, ttl)
+	if err != nil {
+		return nil, newStoreErrorResponse("/lock/"+name, "Could not renew lease: ", err)
+	}
+
+	s.trackTTLForLock(lock)
+	return lock, nil
+}
+
+func (s *StorageAPI) ReleaseLock(name, owner string) *ErrorResponse {
+	if errResp := checkLockRequest(name, owner); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.ReleaseLock(name, owner); err != nil {
+		return newStoreErrorResponse("/lock/"+name, "Could not release lock: ", err)
+	}
+
+	return nil
+}
+
+// GetLock returns the named lock, a lock whose lease has run out but that hasn't been removed yet
+// is only returned if evenIfExpired is set
+func (s *StorageAPI) GetLock(name string, evenIfExpired bool) (*rafty_objects.Lock, *ErrorResponse) {
+	lock, err := s.store.GetLock(name)
+	if err != nil {
+		return nil, NewErrorResponse("/lock/"+name, "Could not get lock: "+err.Error())
+	}
+
+	if lock == nil || (lock.Expired(time.Now()) && !evenIfExpired) {
+		return nil, NewErrorNotFound("/lock/" + name)
+	}
+
+	return lock, nil
+}
+
+func checkLockRequest(name, owner string) *ErrorResponse {
+	if name == "" {
+		return NewErrorResponse("/lock/", "Lock name cannot be empty")
+	}
+
+	if owner == "" {
+		return NewErrorResponse("/lock/"+name, "Owner cannot be empty")
+	}
+
+	return nil
+}
+
+// checkWritable rejects writes to the keys that hold locks, which can only be changed through the
+// lock calls
+func checkWritable(k string) *ErrorResponse {
+	if !strings.HasPrefix(k, store.LockKeyPrefix) {
+		return nil
+	}
+
+	errResp := NewErrorResponse("/"+k, "Keys starting with "+store.LockKeyPrefix+" can only be changed through the lock API")
+	errResp.ErrorCode = RAFTErrorReservedKey
+	return errResp
+}
+
+// newStoreErrorResponse wraps an error from the store, giving the errors callers can act on their
+// own error codes
+func newStoreErrorResponse(cause, msg string, err error) *ErrorResponse {
+	errResp := NewErrorResponse(cause, msg+err.Error())
+	switch err {
+	case store.ErrLockHeld:
+		errResp.ErrorCode = RAFTErrorLockHeld
+	case store.ErrLockNotHeld:
+		errResp.ErrorCode = RAFTErrorLockNotHeld
+	case store.ErrKeyExists:
+		errResp.ErrorCode = RAFTErrorKeyExists
+	case store.ErrKeyNotFound:
+		errResp.ErrorCode = RAFTErrorNotFound
+	case store.ErrCompareFailed:
+		errResp.ErrorCode = RAFTErrorCompareFailed
+	case store.ErrNotInteger:
+		errResp.ErrorCode = RAFTErrorNotInteger
+	case store.ErrNotNumber:
+		errResp.ErrorCode = RAFTErrorNotNumber
+	case store.ErrOverflow:
+		errResp.ErrorCode = RAFTErrorOverflow
+	case store.ErrIndexOutOfRange:
+		errResp.ErrorCode = RAFTErrorOutOfRange
+	}
+
+	return errResp
+}
+
 func (s *StorageAPI) DeleteKey(k string) (*KeyValueAPIObject, *ErrorResponse) {
+	if errResp := checkWritable(k); errResp != nil {
+		return nil, errResp
+	}
+
 	if err := s.store.Delete(k); err != nil {
 		return nil, NewErrorResponse("/"+k, "Delete failed: "+err.Error())
 	}
@@ -244,6 +690,19 @@ func (s *StorageAPI) DeleteKey(k string) (*KeyValueAPIObject, *ErrorResponse) {
 	return nil, nil
 }
 
+// DeleteKeyIf deletes a key if cond holds when the delete is applied.
+func (s *StorageAPI) DeleteKeyIf(k string, cond *store.Condition) *ErrorResponse {
+	if errResp := checkWritable(k); errResp != nil {
+		return errResp
+	}
+
+	if err := s.store.DeleteNode(k, cond); err != nil {
+		return newStoreErrorResponse("/"+k, "Delete failed: ", err)
+	}
+
+	return nil
+}
+
 func (s *StorageAPI) getKeyFromStore(k string) ([]byte, *ErrorResponse) {
 	if k == "" {
 		return nil, NewErrorResponse("/"+k, "Key cannot be empty")
@@ -268,12 +727,17 @@ type ttlIndexElement struct {
 	TTL   int64
 	Key   string
 	Index int
+	Lock  bool `json:",omitempty"`
 }
 
 func (s *StorageAPI) trackTTLForKey(key string, expires int64) {
 	s.addTTL(ttlIndexElement{TTL: expires, Key: key})
 }
 
+func (s *StorageAPI) trackTTLForLock(lock *rafty_objects.Lock) {
+	s.addTTL(ttlIndexElement{TTL: lock.Expires.Unix(), Key: store.LockKeyPrefix + lock.Name, Lock: true})
+}
+
 func (s *StorageAPI) addTTL(elem ttlIndexElement) {
 	if s.store.IsLeader() == false {
 		return
@@ -281,6 +745,11 @@ func (s *StorageAPI) addTTL(elem ttlIndexElement) {
 
 	s.ttlIndex.Add(elem)
 
+	// The snapshot is rebuilt by the TTL processor once it has seen us become leader
+	if s.queueSnapshot == nil {
+		return
+	}
+
 	// Store the change in our snapshot
 	elem.Index = s.ttlIndex.Len()
 
@@ -317,6 +786,13 @@ func (s *StorageAPI) processTTLElement() {
 			break
 		}
 
+		if thisElem.(ttlIndexElement).Lock {
+			if s.processLockTTL(thisElem.(ttlIndexElement)) {
+				applyDeletes[i] = thisElem.(ttlIndexElement)
+			}
+			continue
+		}
+
 		existingKey, getErr := s.GetKey(thisElem.(ttlIndexElement).Key, true)
 		if getErr != nil {
 			// can't get the key, no need to delete it
@@ -348,6 +824,7 @@ func (s *StorageAPI) processTTLElement() {
 					"prefix": "tcf.rafty.storage-api",
 				}).Info("-> Removing key (", thisElem.(ttlIndexElement).Key, ") because expired")
 				s.DeleteKey(thisElem.(ttlIndexElement).Key)
+				metrics.IncrCounter([]string{"store", "ttl", "evictions"}, 1)
 
 				// It's not in the queue, aso it shouldn't be in the snapshot
 				applyDeletes[i] = thisElem.(ttlIndexElement)
@@ -375,6 +852,44 @@ func (s *StorageAPI) processTTLElement() {
 	s.storeTTLSnapshot()
 }
 
+// processLockTTL expires a lock once its lease has run out, it returns true if the lock is gone and
+// no longer needs tracking
+func (s *StorageAPI) processLockTTL(elem ttlIndexElement) bool {
+	name := strings.TrimPrefix(elem.Key, store.LockKeyPrefix)
+	lock, errResp := s.GetLock(name, true)
+	if errResp != nil {
+		// Already released
+		return errResp.ErrorCode == RAFTErrorNotFound
+	}
+
+	if lock.Expires.Unix() != elem.TTL {
+		// Lease has been renewed or the lock retaken, so it must be in the queue again
+		log.WithFields(logrus.Fields{
+			"prefix": "tcf.rafty.storage-api",
+		}).Debug("Skipping eviction for lock, lease has changed")
+		return false
+	}
+
+	if time.Now().Unix() <= elem.TTL {
+		s.addTTL(elem)
+		return false
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "tcf.rafty.storage-api",
+	}).Info("-> Removing lock (", name, ") because lease expired")
+	if err := s.store.ExpireLock(name, lock.Token); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "tcf.rafty.storage-api",
+		}).Error("Failed to expire lock: ", err)
+		s.addTTL(elem)
+		return false
+	}
+	metrics.IncrCounter([]string{"store", "ttl", "lock_evictions"}, 1)
+
+	return true
+}
+
 func (s *StorageAPI) rebuildFromSnapshot(intoFifoQ *fifo.Queue) SnapshotStatus {
 	if s.store.IsLeader() == false {
 		log.WithFields(logrus.Fields{
@@ -0,0 +1,29 @@
+package httpd
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLockKeysAreReserved(t *testing.T) {
+	// Writes are rejected before they reach the store
+	s := &StorageAPI{}
+
+	_, deleteErr := s.DeleteKey("TCF_LOCK_jobs")
+	errResps := []*ErrorResponse{
+		deleteErr,
+		s.DeleteKeyIf("TCF_LOCK_jobs", nil),
+		s.LPush("TCF_LOCK_jobs", "x"),
+		s.HSet("TCF_LOCK_jobs", "Owner", "me"),
+	}
+
+	for i, errResp := range errResps {
+		if errResp == nil || storeErrorStatus(errResp) != http.StatusForbidden {
+			t.Fatalf("Expected write %v to be forbidden, got: %+v", i, errResp)
+		}
+	}
+
+	if _, err := s.txnOp(&TxnOp{Op: "delete", Key: "TCF_LOCK_jobs"}); err == nil {
+		t.Fatal("Expected transactions to reject lock keys")
+	}
+}
@@ -0,0 +1,197 @@
+package httpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// TxnCondition is a condition on a key/value node, fields that are left out aren't checked
+type TxnCondition struct {
+	PrevIndex uint64  `json:"prevIndex,omitempty"`
+	PrevValue *string `json:"prevValue,omitempty"`
+	PrevExist *bool   `json:"prevExist,omitempty"`
+}
+
+func (c *TxnCondition) toStore() *store.Condition {
+	if c.PrevIndex == 0 && c.PrevValue == nil && c.PrevExist == nil {
+		return nil
+	}
+
+	return &store.Condition{PrevIndex: c.PrevIndex, PrevValue: c.PrevValue, PrevExist: c.PrevExist}
+}
+
+// TxnCheck must hold for a transaction to be applied
+type TxnCheck struct {
+	Key string `json:"key"`
+	TxnCondition
+}
+
+// TxnOp is an operation in a transaction. Op is one of set, delete, sadd, lpush, lrem, zadd and
+// zremrangebyscore, the other fields are used as they are by the key endpoint of the same name. A
+// set or delete can carry its own condition.
+type TxnOp struct {
+	Op    string      `json:"op"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"value,omitempty"`
+	TTL   int         `json:"ttl,omitempty"`
+	Count int         `json:"count,omitempty"`
+	Score int64       `json:"score,omitempty"`
+	Min   int64       `json:"min,omitempty"`
+	Max   int64       `json:"max,omitempty"`
+	TxnCondition
+}
+
+// TxnRequest is a set of operations that are applied together, only if every check holds and
+// every operation succeeds
+type TxnRequest struct {
+	Checks []TxnCheck `json:"checks"`
+	Ops    []TxnOp    `json:"ops"`
+}
+
+// Txn applies a transaction. A transaction that is applied but fails a check or an operation is
+// not an error, see the Succeeded field of the result.
+func (s *StorageAPI) Txn(req *TxnRequest) (*store.TxnResult, *ErrorResponse) {
+	if len(req.Ops) == 0 {
+		return nil, newTxnErrorResponse("Transaction has no operations")
+	}
+
+	checks := make([]store.TxnCheck, len(req.Checks))
+	for i, check := range req.Checks {
+		if check.Key == "" {
+			return nil, newTxnErrorResponse(fmt.Sprintf("Check %d: key cannot be empty", i))
+		}
+
+		checks[i] = store.TxnCheck{Key: check.Key}
+		if cond := check.toStore(); cond != nil {
+			checks[i].Cond = *cond
+		}
+	}
+
+	ops := make([]store.TxnOp, len(req.Ops))
+	for i := range req.Ops {
+		op, err := s.txnOp(&req.Ops[i])
+		if err != nil {
+			return nil, newTxnErrorResponse(fmt.Sprintf("Operation %d: %v", i, err))
+		}
+		ops[i] = *op
+	}
+
+	result, err := s.store.Txn(checks, ops)
+	if err != nil {
+		return nil, newStoreErrorResponse("/txn", "Transaction failed: ", err)
+	}
+
+	// Track the TTLs of the keys that were written
+	for _, r := range result.Results {
+		if r.Node != nil && r.Node.TTL > 0 && r.Key != TTLSNAPSHOT_KEY {
+			s.trackTTLForKey(r.Key, r.Node.Expiration.Unix())
+		}
+	}
+
+	return result, nil
+}
+
+func newTxnErrorResponse(msg string) *ErrorResponse {
+	errResp := NewErrorResponse("/txn", msg)
+	errResp.ErrorCode = RAFTErrorInvalidTxn
+	return errResp
+}
+
+// txnOp encodes an operation the way the matching StorageAPI method would
+func (s *StorageAPI) txnOp(op *TxnOp) (*store.TxnOp, error) {
+	if op.Key == "" {
+		return nil, fmt.Errorf("key cannot be empty")
+	}
+	if strings.HasPrefix(op.Key, store.LockKeyPrefix) {
+		return nil, fmt.Errorf("keys starting with %s can only be changed through the lock API", store.LockKeyPrefix)
+	}
+
+	sOp := &store.TxnOp{Key: op.Key}
+	var err error
+
+	switch op.Op {
+	case "set":
+		value, ok := op.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value must be a string")
+		}
+
+		node := &rafty_objects.NodeValue{Key: op.Key, Value: value, TTL: op.TTL}
+		node.CalculateExpiry()
+		node.Created = time.Now().Unix()
+
+		sOp.Op = store.TxnSetNode
+		sOp.Value, err = node.EncodeForStorage()
+		sOp.Cond = op.toStore()
+	case "delete":
+		sOp.Op = store.TxnDeleteNode
+		sOp.Cond = op.toStore()
+	case "sadd":
+		value, ok := op.Value.(string)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("value must be a non-empty string")
+		}
+
+		sOp.Op = store.TxnAddToSet
+		sOp.Value = []byte(value)
+	case "lpush":
+		values, ok := op.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("value must be an array")
+		}
+
+		sOp.Op = store.TxnLPush
+		sOp.Value, err = msgpack.Marshal(values)
+	case "lrem":
+		sOp.Op = store.TxnLRem
+		sOp.Count = op.Count
+		sOp.Value, err = msgpack.Marshal(op.Value)
+	case "zadd":
+		sOp.Op = store.TxnZAdd
+		sOp.Score = op.Score
+		sOp.Value, err = msgpack.Marshal(op.Value)
+	case "zremrangebyscore":
+		sOp.Op = store.TxnZRemRangeByScore
+		sOp.Min = op.Min
+		sOp.Max = op.Max
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sOp, nil
+}
+
+func (s *Service) handleTxn(w http.ResponseWriter, r *http.Request) {
+	if !s.store.IsLeader() {
+		s.forwardRequest(w, r)
+		return
+	}
+
+	req := &TxnRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		s.writeToClient(w, r, NewErrorResponse("/txn", "Could not decode transaction: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	result, errResp := s.StorageAPI.Txn(req)
+	if errResp != nil {
+		s.writeToClient(w, r, errResp, storeErrorStatus(errResp))
+		return
+	}
+
+	returnData := NewKeyValueAPIObjectWithAction(ActionTxn)
+	returnData.Txn = result
+	returnData.Index = result.Index
+	s.writeToClient(w, r, returnData, http.StatusOK)
+}
@@ -0,0 +1,190 @@
+package httpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/store"
+	"github.com/gorilla/mux"
+)
+
+// defaultWatchTimeout is how long a long-polling watch waits for a change, in seconds
+const defaultWatchTimeout = 60
+
+// Watcher delivers changes to watched keys as API objects, whose Index can be used to resume
+// watching after a restart
+type Watcher struct {
+	watch  *store.Watch
+	events chan *KeyValueAPIObject
+	done   chan struct{}
+	stop   sync.Once
+}
+
+func newWatcher(w *store.Watch) *Watcher {
+	watcher := &Watcher{
+		watch:  w,
+		events: make(chan *KeyValueAPIObject),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(watcher.events)
+		for e := range w.Events() {
+			select {
+			case watcher.events <- NewKeyValueAPIObjectFromEvent(e):
+			case <-watcher.done:
+				return
+			}
+		}
+	}()
+
+	return watcher
+}
+
+// Events returns the channel changes are delivered on, it is closed when the watch ends.
+func (w *Watcher) Events() <-chan *KeyValueAPIObject {
+	return w.events
+}
+
+// Err returns why the watch ended, or nil while it is still running.
+func (w *Watcher) Err() error {
+	return watchError(w.watch.Err())
+}
+
+// Stop ends the watch.
+func (w *Watcher) Stop() {
+	w.watch.Stop()
+	w.stop.Do(func() {
+		close(w.done)
+	})
+}
+
+// watchError turns store watch errors into API errors
+func watchError(err error) error {
+	switch err {
+	case store.ErrWatchIndexCleared:
+		return &ErrorResponse{
+			Cause:     "/watch",
+			ErrorCode: RAFTErrorIndexCleared,
+			MetaData:  err.Error(),
+		}
+	case store.ErrWatchOverflow:
+		return &ErrorResponse{
+			Cause:     "/watch",
+			ErrorCode: RAFTErrorWatchOverflow,
+			MetaData:  "Watch again from the index of the last event received",
+		}
+	}
+
+	return err
+}
+
+// handleWatch waits for changes to keys starting with the prefix, set exact to only watch the key
+// itself. By default it long-polls, returning the first change or 204 if there is none before the
+// timeout, with stream set it writes every change as a line of JSON until the client goes away.
+// Pass the index of the last change seen to resume without missing any.
+func (s *Service) handleWatch(w http.ResponseWriter, r *http.Request) {
+	k := mux.Vars(r)["prefix"]
+	q := r.URL.Query()
+
+	var afterIndex uint64
+	if idx := q.Get("index"); idx != "" {
+		var err error
+		if afterIndex, err = strconv.ParseUint(idx, 10, 64); err != nil {
+			s.writeToClient(w, r, NewErrorResponse("/watch/"+k, "Index must be number: "+err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	timeout := defaultWatchTimeout
+	if t := q.Get("timeout"); t != "" {
+		var err error
+		if timeout, err = strconv.Atoi(t); err != nil {
+			s.writeToClient(w, r, NewErrorResponse("/watch/"+k, "Timeout must be number: "+err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sw, err := s.store.Watch(k, q.Get("exact") != "true", afterIndex)
+	if err != nil {
+		s.writeWatchError(w, r, k, err)
+		return
+	}
+
+	watcher := newWatcher(sw)
+	defer watcher.Stop()
+
+	if q.Get("stream") == "true" {
+		s.streamWatch(w, r, watcher)
+		return
+	}
+
+	select {
+	case e, ok := <-watcher.Events():
+		if !ok {
+			s.writeWatchError(w, r, k, sw.Err())
+			return
+		}
+		s.writeToClient(w, r, e, http.StatusOK)
+	case <-time.After(time.Duration(timeout) * time.Second):
+		w.WriteHeader(http.StatusNoContent)
+	case <-r.Context().Done():
+	}
+}
+
+func (s *Service) streamWatch(w http.ResponseWriter, r *http.Request, watcher *Watcher) {
+	flusher, canFlush := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Generator", "tcf.rafty")
+	w.WriteHeader(http.StatusOK)
+	if canFlush {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case e, ok := <-watcher.Events():
+			if !ok {
+				// Let the client know why the stream ended
+				switch err := watcher.Err().(type) {
+				case nil:
+				case *ErrorResponse:
+					err.Cause = r.URL.Path
+					enc.Encode(err)
+				default:
+					enc.Encode(NewErrorResponse(r.URL.Path, err.Error()))
+				}
+				return
+			}
+
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+
+			if canFlush {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Service) writeWatchError(w http.ResponseWriter, r *http.Request, k string, err error) {
+	if errResp, ok := watchError(err).(*ErrorResponse); ok {
+		errResp.Cause = "/watch/" + k
+		status := http.StatusGone
+		if errResp.ErrorCode == RAFTErrorWatchOverflow {
+			status = http.StatusConflict
+		}
+		s.writeToClient(w, r, errResp, status)
+		return
+	}
+
+	s.writeToClient(w, r, NewErrorResponse("/watch/"+k, "Watch failed: "+err.Error()), http.StatusInternalServerError)
+}
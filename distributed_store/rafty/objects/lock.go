@@ -0,0 +1,21 @@
+package objects
+
+import (
+	"time"
+)
+
+// Lock is a named lock held by Owner until Expires, unless the lease is renewed. Token is the raft
+// index of the acquire, so it increases every time the lock changes hands and can be used as a
+// fencing token by whatever the lock protects.
+type Lock struct {
+	Name    string    `json:"name"`
+	Owner   string    `json:"owner"`
+	Token   uint64    `json:"token"`
+	TTL     int       `json:"ttl"`
+	Expires time.Time `json:"expires"`
+}
+
+// Expired reports whether the lease has run out at the given time
+func (l *Lock) Expired(now time.Time) bool {
+	return !now.Before(l.Expires)
+}
@@ -12,6 +12,14 @@ type NodeValue struct {
 	Value       string    `json:"value"`
 	Created     int64     `json:"created"`
 	LastUpdated int64     `json:"lastUpdated"`
+	// Raft indexes of the node's creation and last change, set by the store when the change is applied
+	CreatedIndex  uint64 `json:"createdIndex,omitempty"`
+	ModifiedIndex uint64 `json:"modifiedIndex,omitempty"`
+}
+
+// Expired reports whether a node with a TTL has expired at the given time
+func (n *NodeValue) Expired(now time.Time) bool {
+	return n.TTL != 0 && now.After(n.Expiration)
 }
 
 func (n *NodeValue) CalculateExpiry() {
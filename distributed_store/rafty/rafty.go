@@ -21,6 +21,10 @@ type Config struct {
 	RunInSingleServerMode bool
 	ResetPeersOnLoad      bool
 	AdvertiseInternal     bool
+
+	// PersistentState keeps the data in a BoltDB file in RaftDir rather than in memory, for
+	// datasets larger than memory and faster restarts
+	PersistentState bool
 }
 
 var tcfRaftyConfig Config = Config{
@@ -57,6 +57,16 @@ func StartServer(JoinAddress string, raftyConfig *Config, killChan chan os.Signa
 	s.RaftBind = raftyConfig.RaftBindToAddress
 	s.RaftAdvertise = raftyConfig.RaftServerAddress
 
+	if raftyConfig.PersistentState {
+		backend, err := store.NewBoltBackend(filepath.Join(raftDir, "state.db"))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": logPrefix,
+			}).Fatal("Failed to open state backend: ", err)
+		}
+		s.Backend = backend
+	}
+
 	var masterConfigChan = make(chan MasterConfigPayload)
 	if broadcastWith != nil {
 		log.WithFields(logrus.Fields{
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+)
+
+// Without a Backend the FSM holds everything in memory, and rebuilds it from the latest snapshot and
+// the log on every start. With one, m only holds the encoded values changed since the last
+// checkpoint, with nil marking a deleted key, and colls caches the collections in use, with dirty
+// marking the ones changed since the last checkpoint. Everything else is read from the backend.
+// Checkpoints write the changes to the backend along with the index of the last log entry applied,
+// so that entries it already holds can be skipped when the log is replayed after a restart.
+
+const (
+	// checkpointChanges is the number of changed keys that triggers a checkpoint
+	checkpointChanges = 1024
+	// checkpointInterval is the longest changes are held in memory while entries are being applied
+	checkpointInterval = 5 * time.Second
+)
+
+// BackendEntry is a value stored in a Backend. Kind names the kind of collection it is if it is a
+// list, set or sorted set, so that it can be decoded without guessing.
+type BackendEntry struct {
+	Value []byte
+	Kind  string
+}
+
+// Backend stores the FSM's values outside of memory. Changes are committed in batches along with the
+// raft index they bring the values up to.
+type Backend interface {
+	// Get returns the entry stored at key, nil if there is none
+	Get(key string) (*BackendEntry, error)
+	// Keys calls fn with the keys starting with prefix that sort after cursor, in key order, until
+	// fn returns false
+	Keys(prefix, cursor string, fn func(key string) bool) error
+	// Commit stores a batch of changes, where a nil entry deletes its key, and records index as the
+	// last one applied
+	Commit(changes map[string]*BackendEntry, index uint64) error
+	// AppliedIndex returns the index recorded by the last commit, 0 if there hasn't been one
+	AppliedIndex() (uint64, error)
+	// View returns a view of every entry as it is now, which later commits don't change
+	View() (BackendView, error)
+	// Reset removes every entry and sets the applied index back to 0
+	Reset() error
+	// Close closes the backend
+	Close() error
+}
+
+// BackendView is a point in time view of the entries of a Backend, which snapshots are written from
+type BackendView interface {
+	// Len returns the number of entries
+	Len() int
+	// ForEach calls fn with every entry in key order
+	ForEach(fn func(key string, entry *BackendEntry) error) error
+	// Release frees the view
+	Release()
+}
+
+// markDirty records that the collection at key has to be written at the next checkpoint
+func (f *fsm) markDirty(key string) {
+	if f.Backend != nil {
+		f.dirty[key] = true
+	}
+}
+
+// touch records that the collection at key is in use, so that it stays cached
+func (f *fsm) touch(key string) {
+	if f.Backend != nil {
+		f.touched[key] = true
+	}
+}
+
+// checkpointIfDue checkpoints once enough changes have built up, or have been held for long enough
+func (f *fsm) checkpointIfDue() {
+	if f.Backend == nil || len(f.m)+len(f.dirty) == 0 {
+		return
+	}
+
+	if len(f.m)+len(f.dirty) < checkpointChanges && time.Since(f.checkpointed) < checkpointInterval {
+		return
+	}
+
+	if err := f.checkpoint(); err != nil {
+		// The changes are kept until a checkpoint succeeds, and are still in the log if we stop first
+		f.logger.WithFields(logrus.Fields{
+			"prefix": "tcf.rafty.store",
+		}).Error("failed to checkpoint state: ", err)
+	}
+}
+
+// checkpoint writes the changes held in memory to the backend. Collections that haven't been used
+// since the last checkpoint are dropped from the cache, so that it only holds those in use.
+func (f *fsm) checkpoint() error {
+	changes := make(map[string]*BackendEntry, len(f.m)+len(f.dirty))
+	for k := range f.dirty {
+		c, found := f.colls[k]
+		if !found {
+			changes[k] = nil
+			continue
+		}
+
+		encoded, err := c.encode()
+		if err != nil {
+			return err
+		}
+		changes[k] = &BackendEntry{Value: encoded, Kind: c.kind()}
+	}
+
+	for k, v := range f.m {
+		if v == nil {
+			changes[k] = nil
+			continue
+		}
+		changes[k] = &BackendEntry{Value: v}
+	}
+
+	if err := f.Backend.Commit(changes, f.applied); err != nil {
+		return err
+	}
+
+	for k := range f.colls {
+		if !f.touched[k] {
+			delete(f.colls, k)
+		}
+	}
+
+	f.m = make(map[string][]byte)
+	f.dirty = make(map[string]bool)
+	f.touched = make(map[string]bool)
+	f.checkpointed = time.Now()
+	return nil
+}
+
+// lookup returns the encoded value at key, for keys that don't hold a decoded collection. Kind is
+// set if the backend knows the value to be a collection.
+func (f *fsm) lookup(key string) (value []byte, kind string, found bool, err error) {
+	if f.Backend == nil {
+		value, found = f.m[key]
+		return value, "", found, nil
+	}
+
+	if v, changed := f.m[key]; changed {
+		return v, "", v != nil, nil
+	}
+
+	entry, err := f.Backend.Get(key)
+	if err != nil || entry == nil {
+		return nil, "", false, err
+	}
+
+	return entry.Value, entry.Kind, true, nil
+}
+
+// keys returns the keys starting with prefix that sort after cursor, unsorted. At most limit+1 are
+// read from the backend if limit is above 0, which is enough to fill a page and tell if there is more.
+func (f *fsm) keys(prefix, cursor string, limit int) ([]string, error) {
+	keys := make([]string, 0)
+	for k, v := range f.m {
+		if v != nil && strings.HasPrefix(k, prefix) && k > cursor {
+			keys = append(keys, k)
+		}
+	}
+	for k := range f.colls {
+		if strings.HasPrefix(k, prefix) && k > cursor {
+			keys = append(keys, k)
+		}
+	}
+
+	if f.Backend == nil {
+		return keys, nil
+	}
+
+	read := 0
+	err := f.Backend.Keys(prefix, cursor, func(k string) bool {
+		// Keys changed since the last checkpoint have been listed or deleted already
+		_, changed := f.m[k]
+		_, cached := f.colls[k]
+		if changed || cached {
+			return true
+		}
+
+		keys = append(keys, k)
+		read++
+		return limit <= 0 || read <= limit
+	})
+
+	return keys, err
+}
+
+// openBackend picks up from the index the backend got to
+func (s *Store) openBackend() error {
+	var err error
+	if s.applied, err = s.Backend.AppliedIndex(); err != nil {
+		return err
+	}
+	s.checkpointed = time.Now()
+
+	// Events up to that index were never recorded, so watches can't resume from before it
+	s.watchMu.Lock()
+	s.history.complete = s.applied
+	s.watchMu.Unlock()
+	return nil
+}
+
+// closeBackend writes the last changes to the backend and closes it
+func (s *Store) closeBackend() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := (*fsm)(s).checkpoint(); err != nil {
+		s.Backend.Close()
+		return err
+	}
+
+	return s.Backend.Close()
+}
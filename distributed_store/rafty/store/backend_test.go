@@ -0,0 +1,167 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// raceEnabled is set when the tests are built with the race detector
+var raceEnabled bool
+
+// openBackendStore opens a store backed by the BoltDB file at path the way Open does
+func openBackendStore(t *testing.T, path string) (*Store, *fsm) {
+	if raceEnabled {
+		// The vendored bolt trips the race detector's pointer checks
+		t.Skip("bolt backend tests don't run under the race detector")
+	}
+
+	b, err := NewBoltBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New()
+	s.Backend = b
+	if err := s.openBackend(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s, (*fsm)(s)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tcf-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestBoltBackend(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.db")
+
+	s, f := openBackendStore(t, path)
+	fillCollections(t, f)
+	expectCollections(t, s)
+
+	if err := f.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.m) != 0 || len(f.dirty) != 0 {
+		t.Fatalf("Expected checkpoint to write out every change, got: %v %v", f.m, f.dirty)
+	}
+	expectCollections(t, s)
+
+	// Changes after the checkpoint are listed along with what is in the backend
+	applyCommand(t, f, 6, &command{Op: "delete", Key: "raw"})
+	applyCommand(t, f, 7, &command{Op: "set", Key: "new", Value: []byte("v")})
+	page, err := s.ListKeys("", "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Keys) != 3 || page.Keys[0].Key != "l" || page.Keys[2].Key != "s" || page.Next != "s" {
+		t.Fatalf("Unexpected page: %+v", page)
+	}
+
+	if err := s.closeBackend(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Collections are decoded from the backend, and entries it already holds are skipped
+	s, f = openBackendStore(t, path)
+	defer s.Backend.Close()
+	if f.applied != 7 {
+		t.Fatalf("Expected backend to be at index 7, got: %d", f.applied)
+	}
+
+	applyCommand(t, f, 5, &command{Op: "set", Key: "raw", Value: []byte("v")})
+	if v, _ := s.Get("raw"); v != nil {
+		t.Fatalf("Expected replayed entry to be skipped, got: %s", v)
+	}
+
+	// Events before the restart are gone, so watches can only resume from the backend's index
+	if _, err := s.Watch("", true, 6); err != ErrWatchIndexCleared {
+		t.Fatalf("Expected index to be cleared, got: %v", err)
+	}
+	resumed, err := s.Watch("", true, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Stop()
+	if in, _ := s.SIsMember("s", []byte("m")); !in {
+		t.Fatal("Expected set member")
+	}
+	if _, isSet := f.colls["s"].(*setValue); !isSet {
+		t.Fatal("Expected the set to be cached")
+	}
+
+	// Collections that go unused are dropped from the cache
+	f.checkpoint()
+	f.checkpoint()
+	if len(f.colls) != 0 {
+		t.Fatalf("Expected unused collections to be dropped, got: %v", f.colls)
+	}
+
+	w, err := s.Watch("", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// Telling watches what changed doesn't decode collections that are only on disk
+	if resp := applyCommand(t, f, 8, &command{Op: "hset", Key: "z", Field: "f", Value: []byte{0xc0}}); resp != ErrWrongType {
+		t.Fatalf("Expected wrong type, got: %v", resp)
+	}
+	applyCommand(t, f, 9, &command{Op: "delete", Key: "z"})
+	expectEvent(t, w, 9, EventDeleted, "z")
+	expectEvent(t, resumed, 9, EventDeleted, "z")
+	if len(f.colls) != 0 {
+		t.Fatalf("Expected collections to stay encoded, got: %v", f.colls)
+	}
+}
+
+func TestBoltBackendSnapshots(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, f := openBackendStore(t, filepath.Join(dir, "a.db"))
+	defer s.Backend.Close()
+	fillCollections(t, f)
+	applyCommand(t, f, 6, &command{Op: "set", Key: "raw", Value: []byte("v")})
+
+	// Snapshots from a backend restore in memory, and the other way round
+	snapshot := snapshotOf(t, f)
+	restored, rf := restoreFrom(t, snapshot)
+	expectCollections(t, restored)
+	if rf.applied != 6 {
+		t.Fatalf("Expected restore to record index 6, got: %d", rf.applied)
+	}
+
+	other, of := openBackendStore(t, filepath.Join(dir, "b.db"))
+	defer other.Backend.Close()
+	applyCommand(t, of, 1, &command{Op: "set", Key: "gone", Value: []byte("v")})
+	if err := of.Restore(ioutil.NopCloser(bytes.NewReader(snapshotOf(t, rf)))); err != nil {
+		t.Fatal(err)
+	}
+	expectCollections(t, other)
+	if v, _ := other.Get("gone"); v != nil {
+		t.Fatalf("Expected restore to replace every value, got: %s", v)
+	}
+	if entry, _ := other.Backend.Get("z"); entry == nil || entry.Kind != "zset" {
+		t.Fatalf("Expected the kind of collections to be restored, got: %+v", entry)
+	}
+
+	// A snapshot the backend is already past is skipped
+	applyCommand(t, of, 7, &command{Op: "set", Key: "raw", Value: []byte("w")})
+	if err := of.Restore(ioutil.NopCloser(bytes.NewReader(snapshot))); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := other.Get("raw"); string(v) != "w" {
+		t.Fatalf("Expected restore to be skipped, got: %s", v)
+	}
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	// Bucket names for the values, the kinds of the collections among them and the applied index
+	boltValues = []byte("values")
+	boltKinds  = []byte("kinds")
+	boltMeta   = []byte("meta")
+
+	boltAppliedIndex = []byte("applied_index")
+)
+
+// BoltBackend is a Backend that keeps the FSM's values in a BoltDB file. It should live in the raft
+// directory, since the applied index it records only makes sense alongside the log it came from.
+type BoltBackend struct {
+	db *bolt.DB
+}
+
+// NewBoltBackend opens the BoltDB file at path, creating it if it doesn't exist.
+func NewBoltBackend(path string) (*BoltBackend, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	b := &BoltBackend{db: db}
+	if err := db.Update(b.createBuckets); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *BoltBackend) createBuckets(tx *bolt.Tx) error {
+	for _, name := range [][]byte{boltValues, boltKinds, boltMeta} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns the entry stored at key, nil if there is none.
+func (b *BoltBackend) Get(key string) (*BackendEntry, error) {
+	var entry *BackendEntry
+	err := b.db.View(func(tx *bolt.Tx) error {
+		// Seek rather than Get, which can't tell an empty value from a missing one
+		k, v := tx.Bucket(boltValues).Cursor().Seek([]byte(key))
+		if k == nil || !bytes.Equal(k, []byte(key)) {
+			return nil
+		}
+
+		// Values are only valid during the transaction
+		entry = &BackendEntry{
+			Value: append([]byte{}, v...),
+			Kind:  string(tx.Bucket(boltKinds).Get(k)),
+		}
+		return nil
+	})
+
+	return entry, err
+}
+
+// Keys calls fn with the keys starting with prefix that sort after cursor, in key order, until fn
+// returns false.
+func (b *BoltBackend) Keys(prefix, cursor string, fn func(key string) bool) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		start := prefix
+		if cursor > start {
+			start = cursor
+		}
+
+		c := tx.Bucket(boltValues).Cursor()
+		for k, _ := c.Seek([]byte(start)); k != nil; k, _ = c.Next() {
+			key := string(k)
+			if !strings.HasPrefix(key, prefix) {
+				break
+			}
+			if key == cursor {
+				continue
+			}
+			if !fn(key) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// Commit stores a batch of changes, where a nil entry deletes its key, and records index as the last
+// one applied.
+func (b *BoltBackend) Commit(changes map[string]*BackendEntry, index uint64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		values := tx.Bucket(boltValues)
+		kinds := tx.Bucket(boltKinds)
+
+		for k, entry := range changes {
+			key := []byte(k)
+			if entry == nil {
+				if err := values.Delete(key); err != nil {
+					return err
+				}
+				if err := kinds.Delete(key); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := values.Put(key, entry.Value); err != nil {
+				return err
+			}
+
+			var err error
+			if entry.Kind != "" {
+				err = kinds.Put(key, []byte(entry.Kind))
+			} else {
+				err = kinds.Delete(key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		encodedIndex := make([]byte, 8)
+		binary.BigEndian.PutUint64(encodedIndex, index)
+		return tx.Bucket(boltMeta).Put(boltAppliedIndex, encodedIndex)
+	})
+}
+
+// AppliedIndex returns the index recorded by the last commit, 0 if there hasn't been one.
+func (b *BoltBackend) AppliedIndex() (uint64, error) {
+	var index uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltMeta).Get(boltAppliedIndex); len(v) == 8 {
+			index = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+
+	return index, err
+}
+
+// View returns a view of every entry as it is now. The view holds a read transaction open, which
+// stops the file from shrinking or being remapped to grow until it is released.
+func (b *BoltBackend) View() (BackendView, error) {
+	tx, err := b.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltView{tx: tx}, nil
+}
+
+// Reset removes every entry and sets the applied index back to 0.
+func (b *BoltBackend) Reset() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltValues, boltKinds, boltMeta} {
+			if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+
+		return b.createBuckets(tx)
+	})
+}
+
+// Close closes the BoltDB file.
+func (b *BoltBackend) Close() error {
+	return b.db.Close()
+}
+
+type boltView struct {
+	tx *bolt.Tx
+}
+
+func (v *boltView) Len() int {
+	return v.tx.Bucket(boltValues).Stats().KeyN
+}
+
+// ForEach calls fn with every entry, whose value is only valid until fn returns
+func (v *boltView) ForEach(fn func(key string, entry *BackendEntry) error) error {
+	kinds := v.tx.Bucket(boltKinds)
+	return v.tx.Bucket(boltValues).ForEach(func(k, value []byte) error {
+		return fn(string(k), &BackendEntry{Value: value, Kind: string(kinds.Get(k))})
+	})
+}
+
+func (v *boltView) Release() {
+	v.tx.Rollback()
+}
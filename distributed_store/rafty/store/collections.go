@@ -0,0 +1,376 @@
+package store
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/spaolacci/murmur3"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// ErrIndexOutOfRange is returned when setting a list item that doesn't exist
+var ErrIndexOutOfRange = errors.New("index out of range")
+
+// popped is the FSM response to a pop, found is false if the list was empty
+type popped struct {
+	value interface{}
+	found bool
+}
+
+// RPush appends values to the list stored at key, creating it if needed.
+func (s *Store) RPush(key string, values ...interface{}) error {
+	encoded, err := msgpack.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.applyCollection(&command{Op: "rpush", Key: key, Value: encoded})
+	return err
+}
+
+// LPop removes and returns the first item of the list stored at key, found is false if the list is
+// empty. The list is removed with its last item.
+func (s *Store) LPop(key string) (value interface{}, found bool, err error) {
+	return s.pop("lpop", key)
+}
+
+// RPop removes and returns the last item of the list stored at key, see LPop.
+func (s *Store) RPop(key string) (value interface{}, found bool, err error) {
+	return s.pop("rpop", key)
+}
+
+// BLPop is LPop that waits up to timeout for an item to be pushed to an empty list.
+func (s *Store) BLPop(key string, timeout time.Duration) (value interface{}, found bool, err error) {
+	return s.blockingPop("lpop", key, timeout)
+}
+
+// BRPop is RPop that waits up to timeout for an item to be pushed to an empty list.
+func (s *Store) BRPop(key string, timeout time.Duration) (value interface{}, found bool, err error) {
+	return s.blockingPop("rpop", key, timeout)
+}
+
+// LTrim trims the list stored at key to the items from start to stop inclusive, indexes count from
+// the end of the list if negative.
+func (s *Store) LTrim(key string, start, stop int) error {
+	_, err := s.applyCollection(&command{Op: "ltrim", Key: key, Start: start, Stop: stop})
+	return err
+}
+
+// LIndex returns the item at index of the list stored at key, negative indexes count from the end.
+func (s *Store) LIndex(key string, index int) (value interface{}, found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, err := (*fsm)(s).getList(key, false)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if index < 0 {
+		index += len(l.items)
+	}
+	if index < 0 || index >= len(l.items) {
+		return nil, false, nil
+	}
+
+	return l.items[index], true, nil
+}
+
+// LSet replaces the item at index of the list stored at key, negative indexes count from the end.
+func (s *Store) LSet(key string, index int, value interface{}) error {
+	encoded, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.applyCollection(&command{Op: "lset", Key: key, Pos: index, Value: encoded})
+	return err
+}
+
+// SRem removes value from the set stored at key, the set is removed with its last member.
+func (s *Store) SRem(key string, value []byte) error {
+	_, err := s.applyCollection(&command{Op: "srem", Key: key, Value: value})
+	return err
+}
+
+// SIsMember returns whether value is in the set stored at key.
+func (s *Store) SIsMember(key string, value []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, err := (*fsm)(s).getSet(key, false)
+	if err != nil {
+		return false, err
+	}
+
+	return set.has(value), nil
+}
+
+// SCard returns the number of members of the set stored at key.
+func (s *Store) SCard(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, err := (*fsm)(s).getSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(set.size()), nil
+}
+
+// ZRem removes value from the sorted set stored at key, the set is removed with its last member.
+func (s *Store) ZRem(key string, value interface{}) error {
+	encoded, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.applyCollection(&command{Op: "zrem", Key: key, Value: encoded})
+	return err
+}
+
+// ZScore returns the score of value in the sorted set stored at key.
+func (s *Store) ZScore(key string, value interface{}) (score int64, found bool, err error) {
+	encoded, err := msgpack.Marshal(value)
+	if err != nil {
+		return 0, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zset, err := (*fsm)(s).getZSet(key, false)
+	if err != nil {
+		return 0, false, err
+	}
+
+	score, found = zset.score(encoded)
+	return score, found, nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key.
+func (s *Store) ZCard(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zset, err := (*fsm)(s).getZSet(key, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(zset.size()), nil
+}
+
+// ZRange returns the members of the sorted set stored at key from rank start to stop inclusive, in
+// score order. Ranks count from the end of the set if negative.
+func (s *Store) ZRange(key string, start, stop int) ([]interface{}, error) {
+	s.mu.Lock()
+	zset, err := (*fsm)(s).getZSet(key, false)
+	var encoded [][]byte
+	if err == nil {
+		encoded = zset.rangeByRank(start, stop)
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return []interface{}{}, err
+	}
+
+	return decodeMembers(encoded)
+}
+
+func (s *Store) pop(op, key string) (interface{}, bool, error) {
+	resp, err := s.applyCollection(&command{Op: op, Key: key})
+	if err != nil {
+		return nil, false, err
+	}
+
+	p := resp.(*popped)
+	return p.value, p.found, nil
+}
+
+// blockingPop pops from the list at key, waiting for a push if it is empty. Pops are only applied
+// when the list has items, so that waiting doesn't fill the log.
+func (s *Store) blockingPop(op, key string, timeout time.Duration) (interface{}, bool, error) {
+	if s.raft.State() != raft.Leader {
+		return nil, false, fmt.Errorf("not leader")
+	}
+
+	// Watch before looking, so that a push in between isn't missed
+	w, err := s.Watch(key, false, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { w.Stop() }()
+
+	deadline := time.After(timeout)
+	// Look again now and then in case the watch missed something
+	recheck := time.NewTicker(time.Second)
+	defer recheck.Stop()
+
+	for {
+		n, err := s.LLen(key)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if n > 0 {
+			// Someone else may get there first, in which case keep waiting
+			value, found, err := s.pop(op, key)
+			if err != nil || found {
+				return value, found, err
+			}
+		}
+
+		select {
+		case _, ok := <-w.Events():
+			if !ok {
+				if w.Err() != ErrWatchOverflow {
+					return nil, false, w.Err()
+				}
+				if w, err = s.Watch(key, false, 0); err != nil {
+					return nil, false, err
+				}
+			}
+		case <-recheck.C:
+		case <-deadline:
+			return nil, false, nil
+		}
+	}
+}
+
+// listRange converts inclusive start and stop indexes, which count from the end if negative, to a
+// slice range of a list of n items
+func listRange(start, stop, n int) (int, int) {
+	if start < 0 {
+		start += n
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	if stop < 0 {
+		stop += n
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	if start > stop {
+		return 0, 0
+	}
+
+	return start, stop + 1
+}
+
+func setMemberID(value []byte) string {
+	h := murmur3.New128()
+	h.Write(value)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func zsetMemberID(encoded []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(encoded))
+}
+
+func (f *fsm) applyRPush(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	l, err := f.getList(c.Key, true)
+	if err != nil {
+		return err
+	}
+
+	var values []interface{}
+	if err := msgpack.Unmarshal(c.Value, &values); err != nil {
+		return err
+	}
+
+	l.push(values, false)
+	f.putCollection(c.Key, l)
+	return nil
+}
+
+func (f *fsm) applyPop(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	l, err := f.getList(c.Key, true)
+	if err != nil {
+		return err
+	}
+
+	value, found := l.pop(c.Op == "lpop")
+	f.putCollection(c.Key, l)
+	return &popped{value: value, found: found}
+}
+
+func (f *fsm) applyLTrim(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	l, err := f.getList(c.Key, true)
+	if err != nil {
+		return err
+	}
+
+	l.trim(c.Start, c.Stop)
+	f.putCollection(c.Key, l)
+	return nil
+}
+
+func (f *fsm) applyLSet(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	l, err := f.getList(c.Key, true)
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if err := msgpack.Unmarshal(c.Value, &value); err != nil {
+		return err
+	}
+
+	if err := l.set(c.Pos, value); err != nil {
+		return err
+	}
+
+	f.putCollection(c.Key, l)
+	return nil
+}
+
+func (f *fsm) applySRem(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	set, err := f.getSet(c.Key, true)
+	if err != nil {
+		return err
+	}
+
+	set.remove(c.Value)
+	f.putCollection(c.Key, set)
+	return nil
+}
+
+func (f *fsm) applyZRem(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	zset, err := f.getZSet(c.Key, true)
+	if err != nil {
+		return err
+	}
+
+	zset.remove(c.Value)
+	f.putCollection(c.Key, zset)
+	return nil
+}
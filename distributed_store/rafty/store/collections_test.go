@@ -0,0 +1,93 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+func TestLists(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	encode := func(v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	applyCommand(t, f, 1, &command{Op: "rpush", Key: "l", Value: encode([]interface{}{"a", "b", "c", "d"})})
+	if v, found, _ := s.LIndex("l", -1); !found || v != "d" {
+		t.Fatalf("Expected d at the end, got: %v %v", v, found)
+	}
+
+	if p := applyCommand(t, f, 2, &command{Op: "lpop", Key: "l"}).(*popped); !p.found || p.value != "a" {
+		t.Fatalf("Expected to pop a, got: %+v", p)
+	}
+	if p := applyCommand(t, f, 3, &command{Op: "rpop", Key: "l"}).(*popped); !p.found || p.value != "d" {
+		t.Fatalf("Expected to pop d, got: %+v", p)
+	}
+
+	applyCommand(t, f, 4, &command{Op: "lset", Key: "l", Pos: 1, Value: encode("x")})
+	if resp := applyCommand(t, f, 5, &command{Op: "lset", Key: "l", Pos: 5, Value: encode("y")}); resp != ErrIndexOutOfRange {
+		t.Fatalf("Expected out of range, got: %v", resp)
+	}
+	if l, _ := s.LRange("l", 0, -1); fmt.Sprint(l) != "[b x]" {
+		t.Fatalf("Unexpected list: %v", l)
+	}
+
+	// The list goes with its last item
+	applyCommand(t, f, 6, &command{Op: "ltrim", Key: "l", Start: 1, Stop: 0})
+	if v, _ := s.Get("l"); v != nil {
+		t.Fatal("Expected empty list to be removed")
+	}
+	if p := applyCommand(t, f, 7, &command{Op: "lpop", Key: "l"}).(*popped); p.found {
+		t.Fatalf("Expected nothing to pop, got: %+v", p)
+	}
+}
+
+func TestSetsAndSortedSets(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+
+	applyCommand(t, f, 1, &command{Op: "addToSet", Key: "s", Value: []byte("a")})
+	applyCommand(t, f, 2, &command{Op: "addToSet", Key: "s", Value: []byte("b")})
+	applyCommand(t, f, 3, &command{Op: "srem", Key: "s", Value: []byte("a")})
+
+	if n, _ := s.SCard("s"); n != 1 {
+		t.Fatalf("Expected 1 member, got: %v", n)
+	}
+	if in, _ := s.SIsMember("s", []byte("a")); in {
+		t.Fatal("Expected a to be removed")
+	}
+	if in, _ := s.SIsMember("s", []byte("b")); !in {
+		t.Fatal("Expected b to be a member")
+	}
+
+	for i, member := range []string{"low", "high", "mid"} {
+		score := map[string]int64{"low": 1, "mid": 5, "high": 10}[member]
+		encoded, _ := msgpack.Marshal(member)
+		applyCommand(t, f, uint64(4+i), &command{Op: "zadd", Key: "z", Value: encoded, Score: score})
+	}
+
+	if vals, _ := s.ZRange("z", 0, -1); fmt.Sprint(vals) != "[low mid high]" {
+		t.Fatalf("Expected members in score order, got: %v", vals)
+	}
+	if vals, _ := s.ZRange("z", -2, 10); fmt.Sprint(vals) != "[mid high]" {
+		t.Fatalf("Expected the top two, got: %v", vals)
+	}
+	if score, found, _ := s.ZScore("z", "mid"); !found || score != 5 {
+		t.Fatalf("Expected mid to score 5, got: %v %v", score, found)
+	}
+
+	encoded, _ := msgpack.Marshal("mid")
+	applyCommand(t, f, 7, &command{Op: "zrem", Key: "z", Value: encoded})
+	if n, _ := s.ZCard("z"); n != 2 {
+		t.Fatalf("Expected 2 members, got: %v", n)
+	}
+	if _, found, _ := s.ZScore("z", "mid"); found {
+		t.Fatal("Expected mid to be removed")
+	}
+}
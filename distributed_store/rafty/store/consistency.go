@@ -0,0 +1,88 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Consistency is how up to date a read has to be
+type Consistency string
+
+const (
+	// ConsistencyStale reads from the local copy of the store, which may be behind the leader. It is
+	// the default, as it was before reads had a consistency level.
+	ConsistencyStale Consistency = "stale"
+	// ConsistencyDefault reads from the leader, relying on its lease. A leader that has lost touch
+	// with the rest of the cluster steps down once the lease runs out, so there is a short window in
+	// which a deposed leader can still answer.
+	ConsistencyDefault Consistency = "default"
+	// ConsistencyLinearizable confirms leadership with a quorum and waits for every earlier write
+	// to be applied before reading
+	ConsistencyLinearizable Consistency = "linearizable"
+)
+
+// ErrNotLeader is returned when a read that has to be served by the leader is made on a follower
+var ErrNotLeader = errors.New("not leader")
+
+// ParseConsistency reads a consistency level, an empty string is ConsistencyStale
+func ParseConsistency(level string) (Consistency, error) {
+	switch Consistency(level) {
+	case "":
+		return ConsistencyStale, nil
+	case ConsistencyStale, ConsistencyDefault, ConsistencyLinearizable:
+		return Consistency(level), nil
+	}
+
+	return "", fmt.Errorf("unknown consistency level %q", level)
+}
+
+// AppliedIndex returns the raft index of the last change applied to this node's copy of the store
+func (s *Store) AppliedIndex() uint64 {
+	return s.raft.AppliedIndex()
+}
+
+// VerifyRead makes sure that a read from this node's copy of the store meets level, and returns the
+// index the read will be at least as new as. Anything but a stale read has to be made on the leader.
+func (s *Store) VerifyRead(level Consistency) (uint64, error) {
+	switch level {
+	case ConsistencyStale:
+		return s.AppliedIndex(), nil
+	case ConsistencyDefault:
+		if s.raft.State() != raft.Leader {
+			return 0, ErrNotLeader
+		}
+		return s.AppliedIndex(), nil
+	case ConsistencyLinearizable:
+		if err := s.raft.VerifyLeader().Error(); err != nil {
+			if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+				return 0, ErrNotLeader
+			}
+			return 0, err
+		}
+
+		// Earlier writes may be committed but not applied yet
+		if err := s.raft.Barrier(raftTimeout).Error(); err != nil {
+			return 0, err
+		}
+		return s.AppliedIndex(), nil
+	}
+
+	return 0, fmt.Errorf("unknown consistency level %q", level)
+}
+
+// WaitForIndex waits for this node's copy of the store to catch up with index, so that a follower
+// can serve a read at an index the leader has verified.
+func (s *Store) WaitForIndex(index uint64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for s.AppliedIndex() < index {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for index %d, applied %d", index, s.AppliedIndex())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+var (
+	// ErrNotInteger is returned when incrementing a value that doesn't hold an integer
+	ErrNotInteger = errors.New("value is not an integer")
+	// ErrNotNumber is returned when incrementing a value that doesn't hold a number
+	ErrNotNumber = errors.New("value is not a number")
+	// ErrOverflow is returned when an increment would take a value out of range
+	ErrOverflow = errors.New("increment would overflow")
+)
+
+// IncrBy adds by to the integer stored at key and returns the updated node, by can be negative. A
+// key that doesn't exist counts as 0 and is created with a TTL of ttl seconds if ttl is above 0,
+// incrementing an existing counter leaves its TTL alone.
+func (s *Store) IncrBy(key string, by int64, ttl int) (*rafty_objects.NodeValue, error) {
+	resp, err := s.applyNodeCommand(&command{
+		Op:  "incrBy",
+		Key: key,
+		By:  by,
+		TTL: int64(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.(*rafty_objects.NodeValue), nil
+}
+
+// IncrByFloat is IncrBy for floating point counters.
+func (s *Store) IncrByFloat(key string, by float64, ttl int) (*rafty_objects.NodeValue, error) {
+	resp, err := s.applyNodeCommand(&command{
+		Op:      "incrByFloat",
+		Key:     key,
+		ByFloat: by,
+		TTL:     int64(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.(*rafty_objects.NodeValue), nil
+}
+
+func (f *fsm) applyIncrBy(c *command, index uint64) interface{} {
+	return f.applyCounter(c, index, func(current string) (string, error) {
+		var n int64
+		if current != "" {
+			var err error
+			if n, err = strconv.ParseInt(current, 10, 64); err != nil {
+				return "", ErrNotInteger
+			}
+		}
+
+		sum, ok := addInt64(n, c.By)
+		if !ok {
+			return "", ErrOverflow
+		}
+
+		return strconv.FormatInt(sum, 10), nil
+	})
+}
+
+func (f *fsm) applyIncrByFloat(c *command, index uint64) interface{} {
+	return f.applyCounter(c, index, func(current string) (string, error) {
+		var n float64
+		if current != "" {
+			var err error
+			if n, err = strconv.ParseFloat(current, 64); err != nil {
+				return "", ErrNotNumber
+			}
+		}
+
+		sum := n + c.ByFloat
+		if math.IsInf(sum, 0) || math.IsNaN(sum) {
+			return "", ErrOverflow
+		}
+
+		return strconv.FormatFloat(sum, 'f', -1, 64), nil
+	})
+}
+
+// applyCounter replaces the value of the node at c.Key with the result of incr, creating the node
+// if it doesn't exist or has expired
+func (f *fsm) applyCounter(c *command, index uint64, incr func(current string) (string, error)) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Sets and locks can decode as a node too, but only nodes carry their own key
+	node, err := f.getNode(c.Key, c.Now)
+	if err != nil || (node != nil && node.Key != c.Key) {
+		return ErrNotNumber
+	}
+
+	if node == nil {
+		now := time.Unix(0, c.Now)
+		node = &rafty_objects.NodeValue{
+			Key:          c.Key,
+			TTL:          int(c.TTL),
+			Created:      now.Unix(),
+			CreatedIndex: index,
+		}
+		if c.TTL > 0 {
+			node.Expiration = now.Add(time.Duration(c.TTL) * time.Second)
+		}
+	}
+
+	value, err := incr(node.Value)
+	if err != nil {
+		return err
+	}
+
+	node.Value = value
+	node.LastUpdated = time.Unix(0, c.Now).Unix()
+	node.ModifiedIndex = index
+
+	encoded, err := msgpack.Marshal(node)
+	if err != nil {
+		return err
+	}
+
+	f.setEncoded(c.Key, encoded)
+	return node
+}
+
+// addInt64 adds two integers, reporting false if the result overflows
+func addInt64(a, b int64) (int64, bool) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+
+	return sum, true
+}
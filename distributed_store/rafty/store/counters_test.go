@@ -0,0 +1,58 @@
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+)
+
+func TestCounters(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	now := time.Now()
+	at := func(d time.Duration) int64 { return now.Add(d).UnixNano() }
+
+	resp := applyCommand(t, f, 1, &command{Op: "incrBy", Key: "hits", By: 5, TTL: 10, Now: at(0)})
+	node, ok := resp.(*rafty_objects.NodeValue)
+	if !ok || node.Value != "5" || node.TTL != 10 || node.CreatedIndex != 1 {
+		t.Fatalf("Expected counter to be created at 5, got: %+v", resp)
+	}
+
+	// Later increments keep the TTL the counter was created with
+	resp = applyCommand(t, f, 2, &command{Op: "incrBy", Key: "hits", By: -7, TTL: 100, Now: at(time.Second)})
+	if node := resp.(*rafty_objects.NodeValue); node.Value != "-2" || !node.Expiration.Equal(now.Add(10*time.Second)) || node.ModifiedIndex != 2 {
+		t.Fatalf("Expected -2 with the original expiry, got: %+v", node)
+	}
+
+	// Once expired the counter starts again from 0
+	resp = applyCommand(t, f, 3, &command{Op: "incrBy", Key: "hits", By: 1, Now: at(11 * time.Second)})
+	if node := resp.(*rafty_objects.NodeValue); node.Value != "1" || node.TTL != 0 || node.CreatedIndex != 3 {
+		t.Fatalf("Expected expired counter to restart, got: %+v", node)
+	}
+
+	applyCommand(t, f, 4, &command{Op: "incrBy", Key: "max", By: math.MaxInt64, Now: at(0)})
+	if resp := applyCommand(t, f, 5, &command{Op: "incrBy", Key: "max", By: 1, Now: at(0)}); resp != ErrOverflow {
+		t.Fatalf("Expected overflow, got: %v", resp)
+	}
+
+	resp = applyCommand(t, f, 6, &command{Op: "incrByFloat", Key: "hits", ByFloat: 0.5, Now: at(12 * time.Second)})
+	if node := resp.(*rafty_objects.NodeValue); node.Value != "1.5" {
+		t.Fatalf("Expected 1.5, got: %+v", node)
+	}
+	if resp := applyCommand(t, f, 7, &command{Op: "incrBy", Key: "hits", By: 1, Now: at(12 * time.Second)}); resp != ErrNotInteger {
+		t.Fatalf("Expected integer increment of a float to fail, got: %v", resp)
+	}
+
+	text := &rafty_objects.NodeValue{Key: "name", Value: "tyk"}
+	applyCommand(t, f, 8, &command{Op: "setNode", Key: "name", Value: encodeNode(t, text), Now: at(0)})
+	if resp := applyCommand(t, f, 9, &command{Op: "incrByFloat", Key: "name", ByFloat: 1, Now: at(0)}); resp != ErrNotNumber {
+		t.Fatalf("Expected increment of text to fail, got: %v", resp)
+	}
+
+	applyCommand(t, f, 10, &command{Op: "addToSet", Key: "set", Value: []byte("x")})
+	if resp := applyCommand(t, f, 11, &command{Op: "incrBy", Key: "set", By: 1, Now: at(0)}); resp != ErrNotNumber {
+		t.Fatalf("Expected increment of a set to fail, got: %v", resp)
+	}
+}
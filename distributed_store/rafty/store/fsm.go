@@ -1,11 +1,8 @@
 package store
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	"github.com/hashicorp/raft"
-	"github.com/spaolacci/murmur3"
 	"github.com/wangjia184/sortedset"
 	"gopkg.in/vmihailenco/msgpack.v2"
 	"io"
@@ -20,6 +17,34 @@ func (f *fsm) Apply(l *raft.Log) interface{} {
 		log.Fatalf(fmt.Sprintf("failed to unmarshal command: %s", err.Error()))
 	}
 
+	f.mu.Lock()
+	// The backend already holds the changes of entries replayed after a restart
+	if f.Backend != nil && l.Index <= f.applied {
+		f.mu.Unlock()
+		return nil
+	}
+	// Keys are tracked as the command changes them, so that watches can be told what changed
+	f.tracked = make(map[string]keyState)
+	f.trackedKeys = nil
+	f.mu.Unlock()
+
+	resp := f.applyCommand(&c, l.Index)
+
+	f.mu.Lock()
+	changes := f.trackedChanges()
+	f.applied = l.Index
+	f.checkpointIfDue()
+	f.mu.Unlock()
+
+	for _, change := range changes {
+		(*Store)(f).notify(l.Index, change.key, change.before, change.after)
+	}
+
+	return resp
+}
+
+// applyCommand runs a single command against the store
+func (f *fsm) applyCommand(c *command, index uint64) interface{} {
 	switch c.Op {
 	case "set":
 		return f.applySet(c.Key, c.Value)
@@ -35,6 +60,42 @@ func (f *fsm) Apply(l *raft.Log) interface{} {
 		return f.applyZADD(c.Key, c.Score, c.Value)
 	case "zremrangebyscore":
 		return f.applyZREMRANGEBYSCORE(c.Key, c.Min, c.Max)
+	case "setNode":
+		return f.applySetNode(c, index)
+	case "deleteNode":
+		return f.applyDeleteNode(c)
+	case "acquireLock":
+		return f.applyAcquireLock(c, index)
+	case "renewLease":
+		return f.applyRenewLease(c)
+	case "releaseLock":
+		return f.applyReleaseLock(c)
+	case "expireLock":
+		return f.applyExpireLock(c)
+	case "hset":
+		return f.applyHSet(c)
+	case "hdel":
+		return f.applyHDel(c)
+	case "hincrby":
+		return f.applyHIncrBy(c)
+	case "rpush":
+		return f.applyRPush(c)
+	case "lpop", "rpop":
+		return f.applyPop(c)
+	case "ltrim":
+		return f.applyLTrim(c)
+	case "lset":
+		return f.applyLSet(c)
+	case "srem":
+		return f.applySRem(c)
+	case "zrem":
+		return f.applyZRem(c)
+	case "incrBy":
+		return f.applyIncrBy(c, index)
+	case "incrByFloat":
+		return f.applyIncrByFloat(c, index)
+	case "txn":
+		return f.applyTxn(c, index)
 	default:
 		panic(fmt.Sprintf("unrecognized command op: %s", c.Op))
 	}
@@ -45,38 +106,139 @@ func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	// Clone the map.
-	o := make(map[string][]byte)
+	// The backend's view is taken once everything is written to it, and doesn't have to be copied
+	if f.Backend != nil {
+		if err := f.checkpoint(); err != nil {
+			return nil, err
+		}
+
+		view, err := f.Backend.View()
+		if err != nil {
+			return nil, err
+		}
+		return &backendSnapshot{view: view, index: f.applied}, nil
+	}
+
+	// Clone the map, collections are encoded as they would have been stored
+	o := make(map[string][]byte, len(f.m)+len(f.colls)+1)
 	for k, v := range f.m {
 		o[k] = v
 	}
-	return &fsmSnapshot{store: o}, nil
+
+	kinds := make(map[string]string, len(f.colls))
+	for k, c := range f.colls {
+		encoded, err := c.encode()
+		if err != nil {
+			return nil, err
+		}
+		o[k] = encoded
+		kinds[k] = c.kind()
+	}
+
+	if len(kinds) > 0 {
+		encodedKinds, err := msgpack.Marshal(kinds)
+		if err != nil {
+			return nil, err
+		}
+		o[collectionKindsKey] = encodedKinds
+	}
+
+	return &fsmSnapshot{store: o, index: f.applied}, nil
 }
 
 // Restore stores the key-value store to a previous state.
 func (f *fsm) Restore(rc io.ReadCloser) error {
+	if f.Backend != nil {
+		restored, err := f.restoreBackend(rc)
+		if restored {
+			f.resetWatches()
+		}
+		return err
+	}
+
+	if err := f.restoreMemory(rc); err != nil {
+		return err
+	}
+
+	f.resetWatches()
+	return nil
+}
+
+func (f *fsm) restoreMemory(rc io.ReadCloser) error {
 	o := make(map[string][]byte)
 	if err := msgpack.NewDecoder(rc).Decode(&o); err != nil {
 		return err
 	}
 
+	colls, err := restoreCollections(o)
+	if err != nil {
+		return err
+	}
+
+	// Snapshots taken before the index was recorded leave it at 0
+	index := decodeIndex(o[appliedIndexKey])
+	delete(o, appliedIndexKey)
+
 	// Set the state from the snapshot, no lock required according to
 	// Hashicorp docs.
 	f.m = o
+	f.colls = colls
+	f.applied = index
 	return nil
 }
 
+func (f *fsm) resetWatches() {
+	// Watches can't be told what changed, so they have to start over
+	f.watchMu.Lock()
+	f.history.reset = true
+	f.watchMu.Unlock()
+	(*Store)(f).stopWatches(ErrWatchIndexCleared)
+}
+
+// restoreCollections decodes the collections listed in a snapshot, taking them out of o
+func restoreCollections(o map[string][]byte) (map[string]collection, error) {
+	colls := make(map[string]collection)
+
+	encodedKinds, found := o[collectionKindsKey]
+	if !found {
+		return colls, nil
+	}
+	delete(o, collectionKindsKey)
+
+	var kinds map[string]string
+	if err := msgpack.Unmarshal(encodedKinds, &kinds); err != nil {
+		return nil, err
+	}
+
+	for k, kind := range kinds {
+		decode, known := collectionDecoders[kind]
+		v, found := o[k]
+		if !known || !found {
+			continue
+		}
+
+		c, err := decode(v)
+		if err != nil {
+			return nil, err
+		}
+		colls[k] = c
+		delete(o, k)
+	}
+
+	return colls, nil
+}
+
 func (f *fsm) applySet(key string, value []byte) interface{} {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.m[key] = value
+	f.setEncoded(key, value)
 	return nil
 }
 
 func (f *fsm) applyDelete(key string) interface{} {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	delete(f.m, key)
+	f.remove(key)
 	return nil
 }
 
@@ -84,71 +246,32 @@ func (f *fsm) applyAddToSet(key string, value []byte) interface{} {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	v, found := f.m[key]
-
-	// Decode it from []byte
-	var set map[interface{}]interface{}
-	if !found {
-		set = make(map[interface{}]interface{})
-	} else {
-		if err := msgpack.Unmarshal(v, &set); err != nil {
-			return err
-		}
-	}
-
-	// Set the key
-	h := murmur3.New128()
-	h.Write(value)
-	hash := hex.EncodeToString(h.Sum(nil))
-	set[hash] = value
-
-	// Re-encode
-	encoded, err := msgpack.Marshal(set)
+	set, err := f.getSet(key, true)
 	if err != nil {
 		return err
 	}
 
-	f.m[key] = encoded
+	set.add(value)
+	f.putCollection(key, set)
 	return nil
 }
 
-func (f *fsm) insert(v []interface{}, x interface{}, i int) []interface{} {
-	v = append(v, 0)
-	copy(v[i+1:], v[i:])
-	v[i] = x
-	return v
-}
-
 func (f *fsm) applyLPush(key string, values []byte) interface{} {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	v, found := f.m[key]
-
-	var l, vlist []interface{}
-	if !found {
-		l = make([]interface{}, 0)
-	} else {
-		if err := msgpack.Unmarshal(v, &l); err != nil {
-			return err
-		}
-	}
-
-	if err := msgpack.Unmarshal(values, &vlist); err != nil {
+	l, err := f.getList(key, true)
+	if err != nil {
 		return err
 	}
 
-	for _, value := range vlist {
-		l = f.insert(l, value, 0)
-	}
-
-	// Re-encode
-	encoded, err := msgpack.Marshal(l)
-	if err != nil {
+	var vlist []interface{}
+	if err := msgpack.Unmarshal(values, &vlist); err != nil {
 		return err
 	}
 
-	f.m[key] = encoded
+	l.push(vlist, true)
+	f.putCollection(key, l)
 	return nil
 }
 
@@ -156,14 +279,8 @@ func (f *fsm) applyLRem(key string, count int, value []byte) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	v, found := f.m[key]
-
-	var l []interface{}
-	if !found {
-		return nil
-	}
-
-	if err := msgpack.Unmarshal(v, &l); err != nil {
+	l, err := f.getList(key, true)
+	if err != nil {
 		return err
 	}
 
@@ -172,54 +289,8 @@ func (f *fsm) applyLRem(key string, count int, value []byte) error {
 		return err
 	}
 
-	var newL []interface{} = make([]interface{}, 0)
-
-	var end, direction int
-	end = len(l) - 1
-
-	if count == 0 {
-		direction = 1
-	} else if count < 0 {
-		direction = -1
-	} else if count > 0 {
-		direction = 1
-	}
-
-	c := 0
-
-	processItem := func(i int) {
-		if l[i] != compValue {
-			x := l[i]
-			if direction == 1 {
-				newL = append(newL, x)
-			} else {
-				newL = append([]interface{}{x}, newL...)
-			}
-			return
-		}
-		c += 1
-		if c == count && count != 0 {
-			return
-		}
-	}
-
-	if direction > 0 {
-		for i := 0; i <= end; i++ {
-			processItem(i)
-		}
-	} else {
-		for i := end; i >= 0; i-- {
-			processItem(i)
-		}
-	}
-
-	// Re-encode
-	encoded, err := msgpack.Marshal(newL)
-	if err != nil {
-		return err
-	}
-
-	f.m[key] = encoded
+	l.remove(count, compValue)
+	f.putCollection(key, l)
 	return nil
 }
 
@@ -230,100 +301,29 @@ type SortedSetBaseValue struct {
 }
 
 func (f *fsm) applyZADD(key string, score int64, value []byte) error {
-	// Get the encoded sorted set:
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	v, found := f.m[key]
-
-	var l []SortedSetBaseValue
-	if !found {
-		l = make([]SortedSetBaseValue, 0)
-	} else {
-		if err := msgpack.Unmarshal(v, &l); err != nil {
-			return err
-		}
-	}
-
-	// Seed the set
-	set := sortedset.New()
-	for _, item := range l {
-		set.AddOrUpdate(item.ID, item.Score, item.Value)
-	}
-
-	// USe an md5 to represent value, otherwise add or update wont update
-	vid := fmt.Sprintf("%x", md5.Sum(value))
-	set.AddOrUpdate(vid, sortedset.SCORE(score), value)
-
-	// Dump the set
-	allNodes := set.GetByRankRange(1, -1, false)
-	count := set.GetCount()
-
-	toStore := make([]SortedSetBaseValue, count)
-	for i, node := range allNodes {
-		toStore[i] = SortedSetBaseValue{
-			ID:    node.Key(),
-			Score: node.Score(),
-			Value: node.Value,
-		}
-	}
-
-	// Re-encode
-	encoded, err := msgpack.Marshal(toStore)
+	zset, err := f.getZSet(key, true)
 	if err != nil {
 		return err
 	}
 
-	f.m[key] = encoded
+	zset.add(score, value)
+	f.putCollection(key, zset)
 	return nil
 }
 
 func (f *fsm) applyZREMRANGEBYSCORE(key string, min int64, max int64) error {
-	// Get the encoded sorted set:
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	v, found := f.m[key]
-
-	var l []SortedSetBaseValue
-	if !found {
-		return nil
-	}
-
-	if err := msgpack.Unmarshal(v, &l); err != nil {
-		return err
-	}
-
-	// Seed the set
-	set := sortedset.New()
-	for _, item := range l {
-		set.AddOrUpdate(item.ID, item.Score, item.Value)
-	}
-
-	r := set.GetByScoreRange(sortedset.SCORE(min), sortedset.SCORE(max), nil)
-	for _, i := range r {
-		set.Remove(i.Key())
-	}
-
-	// Dump the set
-	allNodes := set.GetByRankRange(1, -1, false)
-	count := set.GetCount()
-
-	toStore := make([]SortedSetBaseValue, count)
-	for i, node := range allNodes {
-		toStore[i] = SortedSetBaseValue{
-			ID:    node.Key(),
-			Score: node.Score(),
-			Value: node.Value,
-		}
-	}
-
-	// Re-encode
-	encoded, err := msgpack.Marshal(toStore)
+	zset, err := f.getZSet(key, true)
 	if err != nil {
 		return err
 	}
 
-	f.m[key] = encoded
+	zset.removeRangeByScore(min, max)
+	f.putCollection(key, zset)
 	return nil
 }
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"fmt"
+	"math"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"github.com/hashicorp/raft"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// HSet sets field of the hash stored at key to value, creating the hash if needed.
+func (s *Store) HSet(key, field string, value interface{}) error {
+	encoded, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.applyCollection(&command{
+		Op:    "hset",
+		Key:   key,
+		Field: field,
+		Value: encoded,
+	})
+	return err
+}
+
+// HGet returns field of the hash stored at key, found is false if the field isn't set.
+func (s *Store) HGet(key, field string) (value interface{}, found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, err := (*fsm)(s).getHash(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, found = h[field]
+	return value, found, nil
+}
+
+// HGetAll returns every field of the hash stored at key, an empty map if there is none.
+func (s *Store) HGetAll(key string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return (*fsm)(s).getHash(key)
+}
+
+// HDel removes fields from the hash stored at key, the hash is removed with its last field.
+func (s *Store) HDel(key string, fields ...string) error {
+	_, err := s.applyCollection(&command{
+		Op:     "hdel",
+		Key:    key,
+		Fields: fields,
+	})
+	return err
+}
+
+// HIncrBy adds by to the integer in field of the hash stored at key and returns the result, a
+// field that isn't set counts as 0.
+func (s *Store) HIncrBy(key, field string, by int64) (int64, error) {
+	resp, err := s.applyCollection(&command{
+		Op:    "hincrby",
+		Key:   key,
+		Field: field,
+		By:    by,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.(int64), nil
+}
+
+func (s *Store) applyCollection(c *command) (interface{}, error) {
+	if s.raft.State() != raft.Leader {
+		return nil, fmt.Errorf("not leader")
+	}
+
+	b, err := msgpack.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.applyWithResponse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err, isErr := resp.(error); isErr {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (f *fsm) getHash(key string) (map[string]interface{}, error) {
+	h := make(map[string]interface{})
+
+	v, found, err := f.encoded(key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return h, nil
+	}
+
+	// Nodes are encoded as maps too, but only nodes carry their own key
+	node := &rafty_objects.NodeValue{}
+	if msgpack.Unmarshal(v, node) == nil && node.Key == key {
+		return nil, ErrWrongType
+	}
+
+	if err := msgpack.Unmarshal(v, &h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (f *fsm) putHash(key string, h map[string]interface{}) error {
+	if len(h) == 0 {
+		f.remove(key)
+		return nil
+	}
+
+	encoded, err := msgpack.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	f.setEncoded(key, encoded)
+	return nil
+}
+
+func (f *fsm) applyHSet(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, err := f.getHash(c.Key)
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if err := msgpack.Unmarshal(c.Value, &value); err != nil {
+		return err
+	}
+
+	h[c.Field] = value
+	return f.putHash(c.Key, h)
+}
+
+func (f *fsm) applyHDel(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, err := f.getHash(c.Key)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range c.Fields {
+		delete(h, field)
+	}
+
+	return f.putHash(c.Key, h)
+}
+
+func (f *fsm) applyHIncrBy(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, err := f.getHash(c.Key)
+	if err != nil {
+		return err
+	}
+
+	var current int64
+	if v, found := h[c.Field]; found {
+		var isInt bool
+		if current, isInt = toInt64(v); !isInt {
+			return ErrNotInteger
+		}
+	}
+
+	current, ok := addInt64(current, c.By)
+	if !ok {
+		return ErrOverflow
+	}
+
+	h[c.Field] = current
+	if err := f.putHash(c.Key, h); err != nil {
+		return err
+	}
+
+	return current
+}
+
+// toInt64 converts a decoded value to an integer, values that came in as JSON numbers are floats
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case float64:
+		return int64(n), n == math.Trunc(n) && math.Abs(n) < 1<<63
+	case float32:
+		return int64(n), float64(n) == math.Trunc(float64(n)) && math.Abs(float64(n)) < 1<<63
+	}
+
+	return 0, false
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+func TestHash(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	encode := func(v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	applyCommand(t, f, 1, &command{Op: "hset", Key: "h", Field: "name", Value: encode("tyk")})
+	applyCommand(t, f, 2, &command{Op: "hset", Key: "h", Field: "hits", Value: encode(float64(5))})
+
+	if v, found, err := s.HGet("h", "name"); err != nil || !found || v != "tyk" {
+		t.Fatalf("Expected name to be set, got: %v %v %v", v, found, err)
+	}
+	if _, found, _ := s.HGet("h", "missing"); found {
+		t.Fatal("Expected missing field not to be found")
+	}
+
+	// JSON numbers arrive as floats but can still be incremented
+	if resp := applyCommand(t, f, 3, &command{Op: "hincrby", Key: "h", Field: "hits", By: 3}); resp != int64(8) {
+		t.Fatalf("Expected 8, got: %v", resp)
+	}
+	if resp := applyCommand(t, f, 4, &command{Op: "hincrby", Key: "h", Field: "new", By: -2}); resp != int64(-2) {
+		t.Fatalf("Expected -2, got: %v", resp)
+	}
+	if resp := applyCommand(t, f, 5, &command{Op: "hincrby", Key: "h", Field: "name", By: 1}); resp != ErrNotInteger {
+		t.Fatalf("Expected increment of a string to fail, got: %v", resp)
+	}
+
+	all, err := s.HGetAll("h")
+	if err != nil || len(all) != 3 {
+		t.Fatalf("Expected 3 fields, got: %v %v", all, err)
+	}
+	if hits, _ := toInt64(all["hits"]); hits != 8 {
+		t.Fatalf("Expected hits to be 8 after decoding, got: %v", all["hits"])
+	}
+
+	applyCommand(t, f, 6, &command{Op: "hdel", Key: "h", Fields: []string{"name", "hits"}})
+	if all, _ := s.HGetAll("h"); len(all) != 1 {
+		t.Fatalf("Expected 1 field left, got: %v", all)
+	}
+
+	// The hash goes with its last field
+	applyCommand(t, f, 7, &command{Op: "hdel", Key: "h", Fields: []string{"new"}})
+	if v, _ := s.Get("h"); v != nil {
+		t.Fatal("Expected empty hash to be removed")
+	}
+}
+
+func TestHashOnNode(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	now := time.Now().UnixNano()
+
+	applyCommand(t, f, 1, &command{Op: "setNode", Key: "k", Value: encodeNode(t, &rafty_objects.NodeValue{Key: "k", Value: "v"}), Now: now})
+	before, _ := s.Get("k")
+
+	if resp := applyCommand(t, f, 2, &command{Op: "hset", Key: "k", Field: "Value", Value: []byte{0xc0}}); resp != ErrWrongType {
+		t.Fatalf("Expected wrong type, got: %v", resp)
+	}
+	if resp := applyCommand(t, f, 3, &command{Op: "hincrby", Key: "k", Field: "TTL", By: 1}); resp != ErrWrongType {
+		t.Fatalf("Expected wrong type, got: %v", resp)
+	}
+	if _, err := s.HGetAll("k"); err != ErrWrongType {
+		t.Fatalf("Expected wrong type, got: %v", err)
+	}
+
+	if after, _ := s.Get("k"); string(after) != string(before) {
+		t.Fatal("Expected the node to be left alone")
+	}
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"sort"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// KeyInfo describes a stored key
+type KeyInfo struct {
+	Key string `json:"key"`
+	// Node is the key/value node stored at the key without its value, nil for sets, lists and the
+	// other kinds of value. Expired nodes are listed until they are removed.
+	Node *rafty_objects.NodeValue `json:"node,omitempty"`
+}
+
+// KeyPage is a page of keys in key order
+type KeyPage struct {
+	Keys []KeyInfo `json:"keys"`
+	// Next is the cursor for the next page, empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// ListKeys returns the keys starting with prefix that sort after cursor, at most limit of them if
+// limit is above 0. Pass the Next cursor of a page to get the page after it.
+func (s *Store) ListKeys(prefix, cursor string, limit int) (*KeyPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := (*fsm)(s).keys(prefix, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	page := &KeyPage{Keys: make([]KeyInfo, 0)}
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		page.Next = keys[limit-1]
+	}
+
+	for _, k := range keys {
+		info := KeyInfo{Key: k}
+
+		// Other kinds of value can decode as a node too, but only nodes carry their own key
+		node := &rafty_objects.NodeValue{}
+		if v, found, _ := (*fsm)(s).encoded(k); found && msgpack.Unmarshal(v, node) == nil && node.Key == k {
+			node.Value = ""
+			info.Node = node
+		}
+
+		page.Keys = append(page.Keys, info)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+)
+
+func TestListKeys(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	now := time.Now().UnixNano()
+
+	index := uint64(1)
+	for _, k := range []string{"app/c", "app/a", "other", "app/b"} {
+		n := &rafty_objects.NodeValue{Key: k, Value: "secret", TTL: 10}
+		applyCommand(t, f, index, &command{Op: "setNode", Key: k, Value: encodeNode(t, n), Now: now})
+		index++
+	}
+	applyCommand(t, f, index, &command{Op: "addToSet", Key: "app/set", Value: []byte("x")})
+
+	var listed []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Expected listing to finish")
+		}
+
+		page, err := s.ListKeys("app/", cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, info := range page.Keys {
+			listed = append(listed, info.Key)
+			if info.Key == "app/set" {
+				if info.Node != nil {
+					t.Fatalf("Expected no node for a set, got: %+v", info.Node)
+				}
+				continue
+			}
+
+			if info.Node == nil || info.Node.TTL != 10 || info.Node.Value != "" {
+				t.Fatalf("Expected node metadata without the value for %v, got: %+v", info.Key, info.Node)
+			}
+		}
+
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+
+	if fmt.Sprint(listed) != "[app/a app/b app/c app/set]" {
+		t.Fatalf("Unexpected keys: %v", listed)
+	}
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"github.com/TykTechnologies/logrus"
+)
+
+// LeaderChange describes a move of raft leadership. Either address may be empty while the cluster
+// has no leader, e.g. during an election.
+type LeaderChange struct {
+	OldLeader string
+	NewLeader string
+	// IsLeader is set if this node is the new leader
+	IsLeader bool
+}
+
+// OnLeaderChange registers fn to be called whenever raft leadership moves. If there is a leader it
+// is called straight away with it, so that callers don't miss a leadership they already hold.
+// Callbacks are made one at a time and must not block. The returned function removes the callback.
+func (s *Store) OnLeaderChange(fn func(LeaderChange)) func() {
+	// Holding dispatchMu throughout keeps changes from being delivered until the current leader
+	// has been, so that it can't arrive after a newer one
+	s.dispatchMu.Lock()
+	s.leaderMu.Lock()
+	id := s.nextLeaderSub
+	s.nextLeaderSub++
+	s.leaderSubs[id] = fn
+	current := s.leader
+	s.leaderMu.Unlock()
+
+	if current != "" {
+		fn(LeaderChange{NewLeader: current, IsLeader: current == s.localAddr})
+	}
+	s.dispatchMu.Unlock()
+
+	return func() {
+		s.leaderMu.Lock()
+		delete(s.leaderSubs, id)
+		s.leaderMu.Unlock()
+	}
+}
+
+// leaderChanged records the new leader and tells the subscribers about it
+func (s *Store) leaderChanged(leader string) {
+	// Changes are recorded and delivered one at a time, so that callbacks see them in order
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+
+	s.leaderMu.Lock()
+	if leader == s.leader {
+		s.leaderMu.Unlock()
+		return
+	}
+
+	change := LeaderChange{
+		OldLeader: s.leader,
+		NewLeader: leader,
+		IsLeader:  leader != "" && leader == s.localAddr,
+	}
+	s.leader = leader
+
+	subs := make([]func(LeaderChange), 0, len(s.leaderSubs))
+	for _, fn := range s.leaderSubs {
+		subs = append(subs, fn)
+	}
+	s.leaderMu.Unlock()
+
+	s.logger.WithFields(logrus.Fields{
+		"prefix": "tcf.rafty.store",
+	}).Infof("leader changed from %q to %q", change.OldLeader, change.NewLeader)
+
+	for _, fn := range subs {
+		fn(change)
+	}
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestOnLeaderChange(t *testing.T) {
+	s := New()
+	s.localAddr = "127.0.0.1:12000"
+	s.leaderChanged("127.0.0.1:12001")
+
+	var changes []LeaderChange
+	cancel := s.OnLeaderChange(func(c LeaderChange) {
+		changes = append(changes, c)
+	})
+
+	s.leaderChanged("127.0.0.1:12001")
+	s.leaderChanged("")
+	s.leaderChanged("127.0.0.1:12000")
+	cancel()
+	s.leaderChanged("127.0.0.1:12002")
+
+	expect := []LeaderChange{
+		{NewLeader: "127.0.0.1:12001"},
+		{OldLeader: "127.0.0.1:12001"},
+		{NewLeader: "127.0.0.1:12000", IsLeader: true},
+	}
+
+	if len(changes) != len(expect) {
+		t.Fatalf("Expected %v changes, got: %+v", len(expect), changes)
+	}
+
+	for i, c := range changes {
+		if c != expect[i] {
+			t.Errorf("Change %v: expected %+v, got %+v", i, expect[i], c)
+		}
+	}
+}
+
+func TestOnLeaderChangeOrder(t *testing.T) {
+	s := New()
+	s.leaderChanged("0")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 1000; i++ {
+			s.leaderChanged(strconv.Itoa(i))
+		}
+	}()
+
+	// However the subscription lines up with the changes, the current leader comes first and
+	// every change after it follows on from the one before
+	var changes []LeaderChange
+	s.OnLeaderChange(func(c LeaderChange) {
+		changes = append(changes, c)
+	})
+	<-done
+
+	for i := 1; i < len(changes); i++ {
+		if changes[i].OldLeader != changes[i-1].NewLeader {
+			t.Fatalf("Change %v doesn't follow on from %+v: %+v", i, changes[i-1], changes[i])
+		}
+	}
+	if len(changes) == 0 || changes[len(changes)-1].NewLeader != "1000" {
+		t.Fatalf("Expected the last change to be to 1000, got: %+v", changes)
+	}
+}
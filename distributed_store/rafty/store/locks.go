@@ -0,0 +1,215 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"github.com/hashicorp/raft"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// LockKeyPrefix namespaces locks in the key space so that they can't clash with other keys
+const LockKeyPrefix = "TCF_LOCK_"
+
+var (
+	// ErrLockHeld is returned when acquiring a lock that another owner holds
+	ErrLockHeld = errors.New("lock is held by another owner")
+	// ErrLockNotHeld is returned when renewing or releasing a lock that the owner doesn't hold
+	ErrLockNotHeld = errors.New("lock is not held by this owner")
+)
+
+// AcquireLock takes the named lock for owner for ttl seconds. Acquiring a lock the owner already
+// holds extends the lease and keeps the token.
+func (s *Store) AcquireLock(name, owner string, ttl int) (*rafty_objects.Lock, error) {
+	return s.applyLock(&command{
+		Op:    "acquireLock",
+		Key:   LockKeyPrefix + name,
+		Owner: owner,
+		TTL:   int64(ttl),
+	})
+}
+
+// RenewLease extends the lease on a lock held by owner by ttl seconds from now.
+func (s *Store) RenewLease(name, owner string, ttl int) (*rafty_objects.Lock, error) {
+	return s.applyLock(&command{
+		Op:    "renewLease",
+		Key:   LockKeyPrefix + name,
+		Owner: owner,
+		TTL:   int64(ttl),
+	})
+}
+
+// ReleaseLock releases a lock held by owner.
+func (s *Store) ReleaseLock(name, owner string) error {
+	_, err := s.applyLock(&command{
+		Op:    "releaseLock",
+		Key:   LockKeyPrefix + name,
+		Owner: owner,
+	})
+	return err
+}
+
+// ExpireLock removes a lock whose lease has run out, token guards against removing a lock that
+// has changed hands since it was found to be expired.
+func (s *Store) ExpireLock(name string, token uint64) error {
+	_, err := s.applyLock(&command{
+		Op:    "expireLock",
+		Key:   LockKeyPrefix + name,
+		Token: token,
+	})
+	return err
+}
+
+// GetLock returns the named lock, or nil if there is none. A lock whose lease has run out stays
+// in the store until it is expired, so check Expired before relying on it.
+func (s *Store) GetLock(name string) (*rafty_objects.Lock, error) {
+	s.mu.Lock()
+	v, found, err := (*fsm)(s).encoded(LockKeyPrefix + name)
+	s.mu.Unlock()
+
+	if err != nil || !found {
+		return nil, err
+	}
+
+	lock := &rafty_objects.Lock{}
+	if err := msgpack.Unmarshal(v, lock); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// applyLock stamps the command with the leader's clock, so that every node sees the same lease
+// times, and returns the lock the FSM produced.
+func (s *Store) applyLock(c *command) (*rafty_objects.Lock, error) {
+	if s.raft.State() != raft.Leader {
+		return nil, fmt.Errorf("not leader")
+	}
+
+	c.Now = time.Now().UnixNano()
+	b, err := msgpack.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.applyWithResponse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r := resp.(type) {
+	case error:
+		return nil, r
+	case *rafty_objects.Lock:
+		return r, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (f *fsm) getLock(key string) (*rafty_objects.Lock, error) {
+	v, found, err := f.encoded(key)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	lock := &rafty_objects.Lock{}
+	if err := msgpack.Unmarshal(v, lock); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+func (f *fsm) putLock(key string, lock *rafty_objects.Lock) interface{} {
+	encoded, err := msgpack.Marshal(lock)
+	if err != nil {
+		return err
+	}
+
+	f.setEncoded(key, encoded)
+	return lock
+}
+
+func (f *fsm) applyAcquireLock(c *command, index uint64) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Unix(0, c.Now)
+	lock, err := f.getLock(c.Key)
+	if err != nil {
+		return err
+	}
+
+	if lock != nil && !lock.Expired(now) && lock.Owner != c.Owner {
+		return ErrLockHeld
+	}
+
+	if lock == nil || lock.Expired(now) {
+		lock = &rafty_objects.Lock{
+			Name:  c.Key[len(LockKeyPrefix):],
+			Owner: c.Owner,
+			Token: index,
+		}
+	}
+
+	lock.TTL = int(c.TTL)
+	lock.Expires = now.Add(time.Duration(c.TTL) * time.Second)
+	return f.putLock(c.Key, lock)
+}
+
+func (f *fsm) applyRenewLease(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Unix(0, c.Now)
+	lock, err := f.getLock(c.Key)
+	if err != nil {
+		return err
+	}
+
+	if lock == nil || lock.Expired(now) || lock.Owner != c.Owner {
+		return ErrLockNotHeld
+	}
+
+	lock.TTL = int(c.TTL)
+	lock.Expires = now.Add(time.Duration(c.TTL) * time.Second)
+	return f.putLock(c.Key, lock)
+}
+
+func (f *fsm) applyReleaseLock(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lock, err := f.getLock(c.Key)
+	if err != nil {
+		return err
+	}
+
+	if lock == nil || lock.Expired(time.Unix(0, c.Now)) || lock.Owner != c.Owner {
+		return ErrLockNotHeld
+	}
+
+	f.remove(c.Key)
+	return nil
+}
+
+func (f *fsm) applyExpireLock(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lock, err := f.getLock(c.Key)
+	if err != nil {
+		return err
+	}
+
+	// Leave it alone if it has been renewed or taken by someone else in the meantime
+	if lock == nil || lock.Token != c.Token || !lock.Expired(time.Unix(0, c.Now)) {
+		return nil
+	}
+
+	f.remove(c.Key)
+	return nil
+}
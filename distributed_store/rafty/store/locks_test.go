@@ -0,0 +1,79 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"github.com/hashicorp/raft"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+func applyCommand(t *testing.T, f *fsm, index uint64, c *command) interface{} {
+	b, err := msgpack.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Apply(&raft.Log{Index: index, Data: b})
+}
+
+func TestLocks(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	now := time.Now()
+	at := func(d time.Duration) int64 { return now.Add(d).UnixNano() }
+
+	resp := applyCommand(t, f, 10, &command{Op: "acquireLock", Key: LockKeyPrefix + "job", Owner: "a", TTL: 5, Now: at(0)})
+	lock, ok := resp.(*rafty_objects.Lock)
+	if !ok {
+		t.Fatalf("Expected lock, got: %v", resp)
+	}
+	if lock.Name != "job" || lock.Owner != "a" || lock.Token != 10 {
+		t.Fatalf("Unexpected lock: %+v", lock)
+	}
+
+	if resp := applyCommand(t, f, 11, &command{Op: "acquireLock", Key: LockKeyPrefix + "job", Owner: "b", TTL: 5, Now: at(time.Second)}); resp != ErrLockHeld {
+		t.Fatalf("Expected lock to be held, got: %v", resp)
+	}
+
+	// Re-acquiring extends the lease but keeps the token
+	resp = applyCommand(t, f, 12, &command{Op: "acquireLock", Key: LockKeyPrefix + "job", Owner: "a", TTL: 5, Now: at(2 * time.Second)})
+	if l := resp.(*rafty_objects.Lock); l.Token != 10 || !l.Expires.Equal(now.Add(7*time.Second)) {
+		t.Fatalf("Expected lease to be extended with the same token, got: %+v", l)
+	}
+
+	if resp := applyCommand(t, f, 13, &command{Op: "renewLease", Key: LockKeyPrefix + "job", Owner: "b", TTL: 5, Now: at(3 * time.Second)}); resp != ErrLockNotHeld {
+		t.Fatalf("Expected renew by another owner to fail, got: %v", resp)
+	}
+
+	// An expire for a lease that hasn't run out yet is ignored
+	applyCommand(t, f, 14, &command{Op: "expireLock", Key: LockKeyPrefix + "job", Token: 10, Now: at(6 * time.Second)})
+	if l, _ := s.GetLock("job"); l == nil {
+		t.Fatal("Expected lock to survive early expiry")
+	}
+
+	// Once the lease has run out another owner can take it, with a new token
+	resp = applyCommand(t, f, 15, &command{Op: "acquireLock", Key: LockKeyPrefix + "job", Owner: "b", TTL: 5, Now: at(8 * time.Second)})
+	if l := resp.(*rafty_objects.Lock); l.Owner != "b" || l.Token != 15 {
+		t.Fatalf("Expected b to take over the lock, got: %+v", l)
+	}
+
+	// A stale expire for the old token leaves the new holder alone
+	applyCommand(t, f, 16, &command{Op: "expireLock", Key: LockKeyPrefix + "job", Token: 10, Now: at(20 * time.Second)})
+	if l, _ := s.GetLock("job"); l == nil || l.Owner != "b" {
+		t.Fatalf("Expected b to still hold the lock, got: %+v", l)
+	}
+
+	if resp := applyCommand(t, f, 17, &command{Op: "releaseLock", Key: LockKeyPrefix + "job", Owner: "a", Now: at(9 * time.Second)}); resp != ErrLockNotHeld {
+		t.Fatalf("Expected release by old owner to fail, got: %v", resp)
+	}
+
+	if resp := applyCommand(t, f, 18, &command{Op: "releaseLock", Key: LockKeyPrefix + "job", Owner: "b", Now: at(9 * time.Second)}); resp != nil {
+		t.Fatalf("Expected release to succeed, got: %v", resp)
+	}
+
+	if l, _ := s.GetLock("job"); l != nil {
+		t.Fatalf("Expected lock to be gone, got: %+v", l)
+	}
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"time"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
+	"github.com/hashicorp/raft"
+)
+
+// apply submits a command to raft and records how long it took to commit
+func (s *Store) apply(b []byte) error {
+	_, err := s.applyWithResponse(b)
+	return err
+}
+
+// applyWithResponse is apply for commands whose result the caller needs, it returns whatever the
+// FSM returned for the entry
+func (s *Store) applyWithResponse(b []byte) (interface{}, error) {
+	defer metrics.MeasureSince([]string{"store", "apply", "latency"}, time.Now())
+
+	f := s.raft.Apply(b, raftTimeout)
+	if err := f.Error(); err != nil {
+		metrics.IncrCounter([]string{"store", "apply", "errors"}, 1)
+		return nil, err
+	}
+
+	return f.Response(), nil
+}
+
+// watchState keeps the raft state gauges up to date and tells leader change subscribers when
+// leadership moves, until the store is stopped
+func (s *Store) watchState() {
+	obsChan := make(chan raft.Observation, 64)
+	s.observations = obsChan
+	s.observer = raft.NewObserver(obsChan, false, func(o *raft.Observation) bool {
+		switch o.Data.(type) {
+		case raft.RaftState, raft.LeaderObservation:
+			return true
+		}
+		return false
+	})
+	s.raft.RegisterObserver(s.observer)
+
+	reportState(s.raft.State())
+	s.leaderChanged(s.raft.Leader())
+	go func() {
+		for o := range obsChan {
+			switch d := o.Data.(type) {
+			case raft.RaftState:
+				reportState(d)
+			case raft.LeaderObservation:
+				s.leaderChanged(d.Leader)
+			}
+		}
+	}()
+}
+
+func reportState(state raft.RaftState) {
+	metrics.SetGauge([]string{"store", "raft", "state"}, float32(state))
+
+	var isLeader float32
+	if state == raft.Leader {
+		isLeader = 1
+	}
+	metrics.SetGauge([]string{"store", "raft", "is_leader"}, isLeader)
+}
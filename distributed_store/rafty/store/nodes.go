@@ -0,0 +1,188 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"github.com/hashicorp/raft"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+var (
+	// ErrKeyExists is returned when a condition requires a key to be absent
+	ErrKeyExists = errors.New("key exists")
+	// ErrKeyNotFound is returned when a condition requires a key that doesn't exist
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrCompareFailed is returned when a key doesn't have the index or value a condition expects
+	ErrCompareFailed = errors.New("compare failed")
+)
+
+// Condition guards a change to a key/value node, the change is only made if every field that is
+// set matches the node as it is when the change is applied. Expired nodes count as absent.
+type Condition struct {
+	// PrevExist requires the node to exist, or not to exist
+	PrevExist *bool `msgpack:",omitempty"`
+	// PrevIndex requires the node's ModifiedIndex to match
+	PrevIndex uint64 `msgpack:",omitempty"`
+	// PrevValue requires the node's value to match
+	PrevValue *string `msgpack:",omitempty"`
+}
+
+// IfAbsent is a condition that only allows a change if the key doesn't exist
+func IfAbsent() *Condition {
+	exists := false
+	return &Condition{PrevExist: &exists}
+}
+
+func (c *Condition) check(current *rafty_objects.NodeValue) error {
+	if c == nil {
+		return nil
+	}
+
+	if c.PrevExist != nil && !*c.PrevExist {
+		if current != nil {
+			return ErrKeyExists
+		}
+		return nil
+	}
+
+	if current == nil {
+		if c.PrevExist != nil || c.PrevIndex != 0 || c.PrevValue != nil {
+			return ErrKeyNotFound
+		}
+		return nil
+	}
+
+	if c.PrevIndex != 0 && c.PrevIndex != current.ModifiedIndex {
+		return ErrCompareFailed
+	}
+
+	if c.PrevValue != nil && *c.PrevValue != current.Value {
+		return ErrCompareFailed
+	}
+
+	return nil
+}
+
+// SetNode writes an encoded NodeValue if cond holds, stamping it with its raft indexes. It returns
+// the node as it was stored.
+func (s *Store) SetNode(key string, value []byte, cond *Condition) (*rafty_objects.NodeValue, error) {
+	resp, err := s.applyNodeCommand(&command{
+		Op:    "setNode",
+		Key:   key,
+		Value: value,
+		Cond:  cond,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.(*rafty_objects.NodeValue), nil
+}
+
+// DeleteNode removes a key/value node if cond holds.
+func (s *Store) DeleteNode(key string, cond *Condition) error {
+	_, err := s.applyNodeCommand(&command{
+		Op:   "deleteNode",
+		Key:  key,
+		Cond: cond,
+	})
+	return err
+}
+
+// applyNodeCommand stamps the command with the leader's clock, so that every node agrees on which
+// keys have expired, and returns the FSM's result
+func (s *Store) applyNodeCommand(c *command) (interface{}, error) {
+	if s.raft.State() != raft.Leader {
+		return nil, fmt.Errorf("not leader")
+	}
+
+	c.Now = time.Now().UnixNano()
+	b, err := msgpack.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.applyWithResponse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err, isErr := resp.(error); isErr {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// getNode returns the live node stored at key, nil if there is none or it has expired
+func (f *fsm) getNode(key string, now int64) (*rafty_objects.NodeValue, error) {
+	v, found, err := f.encoded(key)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	node := &rafty_objects.NodeValue{}
+	if err := msgpack.Unmarshal(v, node); err != nil {
+		return nil, err
+	}
+
+	if node.Expired(time.Unix(0, now)) {
+		return nil, nil
+	}
+
+	return node, nil
+}
+
+func (f *fsm) applySetNode(c *command, index uint64) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current, err := f.getNode(c.Key, c.Now)
+	if err != nil && c.Cond != nil {
+		// Not a key/value node, so it can't match
+		return ErrCompareFailed
+	}
+
+	if err := c.Cond.check(current); err != nil {
+		return err
+	}
+
+	node := &rafty_objects.NodeValue{}
+	if err := msgpack.Unmarshal(c.Value, node); err != nil {
+		return err
+	}
+
+	node.ModifiedIndex = index
+	node.CreatedIndex = index
+	if current != nil {
+		node.CreatedIndex = current.CreatedIndex
+	}
+
+	encoded, err := msgpack.Marshal(node)
+	if err != nil {
+		return err
+	}
+
+	f.setEncoded(c.Key, encoded)
+	return node
+}
+
+func (f *fsm) applyDeleteNode(c *command) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current, err := f.getNode(c.Key, c.Now)
+	if err != nil && c.Cond != nil {
+		return ErrCompareFailed
+	}
+
+	if err := c.Cond.check(current); err != nil {
+		return err
+	}
+
+	f.remove(c.Key)
+	return nil
+}
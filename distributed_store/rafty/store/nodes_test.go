@@ -0,0 +1,73 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+func encodeNode(t *testing.T, n *rafty_objects.NodeValue) []byte {
+	b, err := msgpack.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestConditionalNodes(t *testing.T) {
+	f := (*fsm)(New())
+	now := time.Now().UnixNano()
+	value := func(v string) []byte { return encodeNode(t, &rafty_objects.NodeValue{Key: "k", Value: v}) }
+	prev := func(v string) *string { return &v }
+
+	resp := applyCommand(t, f, 5, &command{Op: "setNode", Key: "k", Value: value("a"), Cond: IfAbsent(), Now: now})
+	node, ok := resp.(*rafty_objects.NodeValue)
+	if !ok || node.CreatedIndex != 5 || node.ModifiedIndex != 5 {
+		t.Fatalf("Expected node created at 5, got: %+v", resp)
+	}
+
+	tests := []struct {
+		name   string
+		cond   *Condition
+		expect interface{}
+	}{
+		{"absent", IfAbsent(), ErrKeyExists},
+		{"stale index", &Condition{PrevIndex: 4}, ErrCompareFailed},
+		{"wrong value", &Condition{PrevValue: prev("b")}, ErrCompareFailed},
+		{"index and wrong value", &Condition{PrevIndex: 5, PrevValue: prev("b")}, ErrCompareFailed},
+	}
+	for _, tc := range tests {
+		if resp := applyCommand(t, f, 6, &command{Op: "setNode", Key: "k", Value: value("x"), Cond: tc.cond, Now: now}); resp != tc.expect {
+			t.Errorf("%v: expected %v, got %v", tc.name, tc.expect, resp)
+		}
+	}
+
+	resp = applyCommand(t, f, 7, &command{Op: "setNode", Key: "k", Value: value("b"), Cond: &Condition{PrevIndex: 5, PrevValue: prev("a")}, Now: now})
+	if node := resp.(*rafty_objects.NodeValue); node.CreatedIndex != 5 || node.ModifiedIndex != 7 || node.Value != "b" {
+		t.Fatalf("Expected node updated at 7, got: %+v", node)
+	}
+
+	if resp := applyCommand(t, f, 8, &command{Op: "deleteNode", Key: "k", Cond: &Condition{PrevIndex: 5}, Now: now}); resp != ErrCompareFailed {
+		t.Fatalf("Expected delete with stale index to fail, got: %v", resp)
+	}
+
+	if resp := applyCommand(t, f, 9, &command{Op: "deleteNode", Key: "k", Cond: &Condition{PrevIndex: 7}, Now: now}); resp != nil {
+		t.Fatalf("Expected delete to succeed, got: %v", resp)
+	}
+
+	if resp := applyCommand(t, f, 10, &command{Op: "deleteNode", Key: "k", Cond: &Condition{PrevIndex: 7}, Now: now}); resp != ErrKeyNotFound {
+		t.Fatalf("Expected delete of missing key to fail, got: %v", resp)
+	}
+
+	t.Run("Expired", func(t *testing.T) {
+		expired := encodeNode(t, &rafty_objects.NodeValue{Key: "e", Value: "old", TTL: 1, Expiration: time.Unix(0, now).Add(-time.Second)})
+		applyCommand(t, f, 11, &command{Op: "set", Key: "e", Value: expired})
+
+		resp := applyCommand(t, f, 12, &command{Op: "setNode", Key: "e", Value: value("new"), Cond: IfAbsent(), Now: now})
+		if node, ok := resp.(*rafty_objects.NodeValue); !ok || node.CreatedIndex != 12 {
+			t.Fatalf("Expected expired key to be recreated, got: %+v", resp)
+		}
+	})
+}
@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package store
+
+func init() {
+	raceEnabled = true
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/hashicorp/raft"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// Snapshots are written as an encoded map[string][]byte, one entry at a time so that a backend's
+// values don't have to fit in memory.
+
+// appliedIndexKey is a reserved snapshot entry holding the index of the last log entry in the
+// snapshot. It is always the first entry, so that a backend that is already past it can skip the rest.
+const appliedIndexKey = "TCF_APPLIED_INDEX"
+
+// restoreBatchSize is the number of entries written to a backend at a time on restore
+const restoreBatchSize = 1024
+
+// backendSnapshot is a snapshot of a Backend, written from a view that later commits don't change
+type backendSnapshot struct {
+	view  BackendView
+	index uint64
+}
+
+func (b *backendSnapshot) Persist(sink raft.SnapshotSink) error {
+	return persistSnapshot(sink, func(w io.Writer) error {
+		kinds := make(map[string]string)
+		return writeSnapshot(w, b.index, b.view.Len()+1, func(put func(string, []byte) error) error {
+			err := b.view.ForEach(func(key string, entry *BackendEntry) error {
+				if entry.Kind != "" {
+					kinds[key] = entry.Kind
+				}
+				return put(key, entry.Value)
+			})
+			if err != nil {
+				return err
+			}
+
+			encodedKinds, err := msgpack.Marshal(kinds)
+			if err != nil {
+				return err
+			}
+			return put(collectionKindsKey, encodedKinds)
+		})
+	})
+}
+
+func (b *backendSnapshot) Release() {
+	b.view.Release()
+}
+
+// persistSnapshot writes a snapshot to sink, cancelling it if that fails
+func persistSnapshot(sink raft.SnapshotSink, write func(w io.Writer) error) error {
+	err := func() error {
+		if err := write(sink); err != nil {
+			return err
+		}
+
+		// Close the sink.
+		return sink.Close()
+	}()
+
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return nil
+}
+
+// writeSnapshot writes the applied index followed by the n entries that entries puts
+func writeSnapshot(w io.Writer, index uint64, n int, entries func(put func(key string, value []byte) error) error) error {
+	buf := bufio.NewWriter(w)
+	enc := msgpack.NewEncoder(buf)
+	put := func(key string, value []byte) error {
+		if err := enc.EncodeString(key); err != nil {
+			return err
+		}
+		return enc.EncodeBytes(value)
+	}
+
+	if err := enc.EncodeMapLen(n + 1); err != nil {
+		return err
+	}
+	if err := put(appliedIndexKey, encodeIndex(index)); err != nil {
+		return err
+	}
+
+	written := 0
+	err := entries(func(key string, value []byte) error {
+		written++
+		return put(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	if written != n {
+		return fmt.Errorf("snapshot has %d entries, expected %d", written, n)
+	}
+
+	return buf.Flush()
+}
+
+func encodeIndex(index uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, index)
+	return b
+}
+
+func decodeIndex(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// restoreBackend replaces the backend's values with those of a snapshot, unless the backend already
+// holds everything in it, which is the case whenever raft restores the latest snapshot on start. It
+// reports whether anything changed.
+func (f *fsm) restoreBackend(r io.Reader) (bool, error) {
+	dec := msgpack.NewDecoder(r)
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return false, err
+	}
+
+	var index uint64
+	var kinds map[string]string
+	changes := make(map[string]*BackendEntry)
+	reset := false
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeString()
+		if err != nil {
+			return reset, err
+		}
+		value, err := dec.DecodeBytes()
+		if err != nil {
+			return reset, err
+		}
+
+		if key == appliedIndexKey {
+			index = decodeIndex(value)
+			if i == 0 && index != 0 && index <= f.applied {
+				f.logger.WithFields(logrus.Fields{
+					"prefix": "tcf.rafty.store",
+				}).Infof("state backend is at index %d, skipping snapshot at %d", f.applied, index)
+				return false, nil
+			}
+			continue
+		}
+
+		if !reset {
+			if err := f.resetBackend(); err != nil {
+				return true, err
+			}
+			reset = true
+		}
+
+		if key == collectionKindsKey {
+			if err := msgpack.Unmarshal(value, &kinds); err != nil {
+				return true, err
+			}
+			continue
+		}
+
+		changes[key] = &BackendEntry{Value: value}
+		if len(changes) >= restoreBatchSize {
+			// The applied index stays at 0 until the end, so that a restore that doesn't finish is
+			// started over
+			if err := f.Backend.Commit(changes, 0); err != nil {
+				return true, err
+			}
+			changes = make(map[string]*BackendEntry)
+		}
+	}
+
+	if !reset {
+		if err := f.resetBackend(); err != nil {
+			return true, err
+		}
+	}
+
+	for k, kind := range kinds {
+		if _, known := collectionDecoders[kind]; !known {
+			continue
+		}
+
+		entry, pending := changes[k]
+		if !pending {
+			if entry, err = f.Backend.Get(k); err != nil {
+				return true, err
+			}
+			if entry == nil {
+				continue
+			}
+			changes[k] = entry
+		}
+		entry.Kind = kind
+	}
+
+	if err := f.Backend.Commit(changes, index); err != nil {
+		return true, err
+	}
+
+	f.applied = index
+	return true, nil
+}
+
+// resetBackend drops every value, in memory and in the backend
+func (f *fsm) resetBackend() error {
+	f.m = make(map[string][]byte)
+	f.colls = make(map[string]collection)
+	f.dirty = make(map[string]bool)
+	f.touched = make(map[string]bool)
+	f.applied = 0
+	return f.Backend.Reset()
+}
@@ -0,0 +1,600 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/wangjia184/sortedset"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// Lists, sets and sorted sets are kept decoded in colls, so that changing a large collection doesn't
+// mean decoding and re-encoding all of it. Everything else is kept encoded in m, and a key is only
+// ever in one of the two. Collections are encoded for snapshots in the same format they used to be
+// stored in, so snapshots taken before and after they were kept decoded restore the same way. With a
+// Backend both only hold part of the values, see backend.go.
+
+// ErrWrongType is returned when an operation is used on a key that holds another kind of value
+var ErrWrongType = errors.New("key holds the wrong kind of value")
+
+// collectionKindsKey is a reserved snapshot entry listing which keys are collections, so that they
+// are decoded on restore. Collections in snapshots without it are decoded on their first write.
+const collectionKindsKey = "TCF_COLLECTION_KINDS"
+
+// collection is a list, set or sorted set held decoded in memory
+type collection interface {
+	// kind names the type of collection in snapshots
+	kind() string
+	// size returns the number of items, empty collections aren't stored
+	size() int
+	// encode returns the stored format of the collection
+	encode() ([]byte, error)
+	// generation changes whenever the collection does, so that watches can tell if it changed
+	generation() uint64
+}
+
+var collectionDecoders = map[string]func([]byte) (collection, error){
+	"list": decodeList,
+	"set":  decodeSet,
+	"zset": decodeZSet,
+}
+
+type changeCounter struct {
+	gen uint64
+}
+
+func (c *changeCounter) changed() {
+	c.gen++
+}
+
+func (c *changeCounter) generation() uint64 {
+	return c.gen
+}
+
+// listValue is a list, the head is the first item
+type listValue struct {
+	changeCounter
+	items []interface{}
+}
+
+func decodeList(b []byte) (collection, error) {
+	l := &listValue{}
+	if err := msgpack.Unmarshal(b, &l.items); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *listValue) kind() string {
+	return "list"
+}
+
+func (l *listValue) size() int {
+	return len(l.items)
+}
+
+func (l *listValue) encode() ([]byte, error) {
+	return msgpack.Marshal(l.items)
+}
+
+// push adds values to the head of the list one by one, so they end up reversed, or to the tail
+func (l *listValue) push(values []interface{}, head bool) {
+	if len(values) == 0 {
+		return
+	}
+
+	if head {
+		items := make([]interface{}, 0, len(values)+len(l.items))
+		for i := len(values) - 1; i >= 0; i-- {
+			items = append(items, values[i])
+		}
+		l.items = append(items, l.items...)
+	} else {
+		l.items = append(l.items, values...)
+	}
+	l.changed()
+}
+
+func (l *listValue) pop(head bool) (interface{}, bool) {
+	if len(l.items) == 0 {
+		return nil, false
+	}
+
+	var value interface{}
+	if head {
+		value = l.items[0]
+		l.items[0] = nil
+		l.items = l.items[1:]
+	} else {
+		value = l.items[len(l.items)-1]
+		l.items[len(l.items)-1] = nil
+		l.items = l.items[:len(l.items)-1]
+	}
+	l.changed()
+
+	return value, true
+}
+
+// rangeOf returns a copy of the items from start to stop inclusive, see listRange
+func (l *listValue) rangeOf(start, stop int) []interface{} {
+	from, to := listRange(start, stop, len(l.items))
+	return append([]interface{}{}, l.items[from:to]...)
+}
+
+func (l *listValue) trim(start, stop int) {
+	from, to := listRange(start, stop, len(l.items))
+	if from == 0 && to == len(l.items) {
+		return
+	}
+
+	l.items = append([]interface{}{}, l.items[from:to]...)
+	l.changed()
+}
+
+func (l *listValue) set(index int, value interface{}) error {
+	if index < 0 {
+		index += len(l.items)
+	}
+	if index < 0 || index >= len(l.items) {
+		return ErrIndexOutOfRange
+	}
+
+	l.items[index] = value
+	l.changed()
+	return nil
+}
+
+func (l *listValue) remove(count int, compValue interface{}) {
+	var newL []interface{} = make([]interface{}, 0)
+
+	var end, direction int
+	end = len(l.items) - 1
+
+	if count == 0 {
+		direction = 1
+	} else if count < 0 {
+		direction = -1
+	} else if count > 0 {
+		direction = 1
+	}
+
+	c := 0
+
+	processItem := func(i int) {
+		if l.items[i] != compValue {
+			x := l.items[i]
+			if direction == 1 {
+				newL = append(newL, x)
+			} else {
+				newL = append([]interface{}{x}, newL...)
+			}
+			return
+		}
+		c += 1
+		if c == count && count != 0 {
+			return
+		}
+	}
+
+	if direction > 0 {
+		for i := 0; i <= end; i++ {
+			processItem(i)
+		}
+	} else {
+		for i := end; i >= 0; i-- {
+			processItem(i)
+		}
+	}
+
+	if len(newL) != len(l.items) {
+		l.items = newL
+		l.changed()
+	}
+}
+
+// setValue is a set of raw values keyed by setMemberID
+type setValue struct {
+	changeCounter
+	members map[string][]byte
+}
+
+func newSet() *setValue {
+	return &setValue{members: make(map[string][]byte)}
+}
+
+func decodeSet(b []byte) (collection, error) {
+	s := newSet()
+	if err := msgpack.Unmarshal(b, &s.members); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *setValue) kind() string {
+	return "set"
+}
+
+func (s *setValue) size() int {
+	return len(s.members)
+}
+
+func (s *setValue) encode() ([]byte, error) {
+	return msgpack.Marshal(s.members)
+}
+
+func (s *setValue) add(value []byte) {
+	id := setMemberID(value)
+	if existing, found := s.members[id]; found && bytes.Equal(existing, value) {
+		return
+	}
+
+	s.members[id] = value
+	s.changed()
+}
+
+func (s *setValue) remove(value []byte) {
+	id := setMemberID(value)
+	if _, found := s.members[id]; !found {
+		return
+	}
+
+	delete(s.members, id)
+	s.changed()
+}
+
+func (s *setValue) has(value []byte) bool {
+	_, found := s.members[setMemberID(value)]
+	return found
+}
+
+// zsetValue is a sorted set, members are keyed by zsetMemberID and hold their encoded value
+type zsetValue struct {
+	changeCounter
+	set *sortedset.SortedSet
+}
+
+func newZSet() *zsetValue {
+	return &zsetValue{set: sortedset.New()}
+}
+
+func decodeZSet(b []byte) (collection, error) {
+	var items []SortedSetBaseValue
+	if err := msgpack.Unmarshal(b, &items); err != nil {
+		return nil, err
+	}
+
+	z := newZSet()
+	for _, item := range items {
+		value, isBytes := item.Value.([]byte)
+		if !isBytes {
+			return nil, ErrWrongType
+		}
+		z.set.AddOrUpdate(item.ID, item.Score, value)
+	}
+
+	return z, nil
+}
+
+func (z *zsetValue) kind() string {
+	return "zset"
+}
+
+func (z *zsetValue) size() int {
+	return z.set.GetCount()
+}
+
+func (z *zsetValue) encode() ([]byte, error) {
+	nodes := z.set.GetByRankRange(1, -1, false)
+
+	items := make([]SortedSetBaseValue, len(nodes))
+	for i, node := range nodes {
+		items[i] = SortedSetBaseValue{
+			ID:    node.Key(),
+			Score: node.Score(),
+			Value: node.Value,
+		}
+	}
+
+	return msgpack.Marshal(items)
+}
+
+func (z *zsetValue) add(score int64, encoded []byte) {
+	id := zsetMemberID(encoded)
+	if node := z.set.GetByKey(id); node != nil && node.Score() == sortedset.SCORE(score) {
+		return
+	}
+
+	z.set.AddOrUpdate(id, sortedset.SCORE(score), encoded)
+	z.changed()
+}
+
+func (z *zsetValue) remove(encoded []byte) {
+	if z.set.Remove(zsetMemberID(encoded)) != nil {
+		z.changed()
+	}
+}
+
+func (z *zsetValue) removeRangeByScore(min, max int64) {
+	nodes := z.set.GetByScoreRange(sortedset.SCORE(min), sortedset.SCORE(max), nil)
+	for _, node := range nodes {
+		z.set.Remove(node.Key())
+	}
+
+	if len(nodes) > 0 {
+		z.changed()
+	}
+}
+
+func (z *zsetValue) score(encoded []byte) (int64, bool) {
+	node := z.set.GetByKey(zsetMemberID(encoded))
+	if node == nil {
+		return 0, false
+	}
+
+	return int64(node.Score()), true
+}
+
+// rangeByRank returns the encoded members from rank start to stop inclusive, see listRange
+func (z *zsetValue) rangeByRank(start, stop int) [][]byte {
+	from, to := listRange(start, stop, z.set.GetCount())
+	if from == to {
+		return [][]byte{}
+	}
+
+	return memberValues(z.set.GetByRankRange(from+1, to, false))
+}
+
+func (z *zsetValue) rangeByScore(min, max int64) [][]byte {
+	return memberValues(z.set.GetByScoreRange(sortedset.SCORE(min), sortedset.SCORE(max), nil))
+}
+
+func memberValues(nodes []*sortedset.SortedSetNode) [][]byte {
+	values := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		values[i] = node.Value.([]byte)
+	}
+
+	return values
+}
+
+// decodeMembers decodes the encoded values of sorted set members
+func decodeMembers(encoded [][]byte) ([]interface{}, error) {
+	vals := make([]interface{}, len(encoded))
+	for i, v := range encoded {
+		if err := msgpack.Unmarshal(v, &vals[i]); err != nil {
+			return []interface{}{}, err
+		}
+	}
+
+	return vals, nil
+}
+
+// keyState is what a key held at some point, for telling watches what changed. Collections that
+// are only stored encoded are compared by their encoding, since decoding them would cost as much as
+// the change itself.
+type keyState struct {
+	raw  []byte
+	coll collection
+	gen  uint64
+}
+
+func (k keyState) exists() bool {
+	return k.raw != nil || k.coll != nil
+}
+
+// unchanged reports whether a key still holds what it held in an earlier state
+func (k keyState) unchanged(earlier keyState) bool {
+	if k.coll != nil || earlier.coll != nil {
+		return k.coll == earlier.coll && k.gen == earlier.gen
+	}
+
+	return bytes.Equal(k.raw, earlier.raw)
+}
+
+// keyChange is what a key held either side of a log entry
+type keyChange struct {
+	key           string
+	before, after keyState
+}
+
+// state returns what key holds without decoding anything
+func (f *fsm) state(key string) keyState {
+	if c, found := f.colls[key]; found {
+		return keyState{coll: c, gen: c.generation()}
+	}
+
+	v, _, _, _ := f.lookup(key)
+	return keyState{raw: v}
+}
+
+// track remembers what key held before the entry being applied first changed it. Writers call it
+// before changing anything, reads and scratch transactions aren't tracked.
+func (f *fsm) track(key string) {
+	if f.tracked == nil {
+		return
+	}
+
+	if _, seen := f.tracked[key]; !seen {
+		f.tracked[key] = f.state(key)
+		f.trackedKeys = append(f.trackedKeys, key)
+	}
+}
+
+// trackedChanges returns the keys changed by the entry being applied, in the order they were
+// changed, and stops tracking
+func (f *fsm) trackedChanges() []keyChange {
+	changes := make([]keyChange, 0, len(f.trackedKeys))
+	for _, k := range f.trackedKeys {
+		changes = append(changes, keyChange{key: k, before: f.tracked[k], after: f.state(k)})
+	}
+
+	f.tracked = nil
+	f.trackedKeys = nil
+	return changes
+}
+
+// raw returns the stored format of the value at key, encoding it if it is a collection
+func (f *fsm) raw(key string) ([]byte, bool, error) {
+	if c, found := f.colls[key]; found {
+		b, err := c.encode()
+		return b, err == nil, err
+	}
+
+	v, _, found, err := f.lookup(key)
+	return v, found, err
+}
+
+// encoded returns the encoded value at key, it fails with ErrWrongType if key holds a collection
+func (f *fsm) encoded(key string) ([]byte, bool, error) {
+	if _, found := f.colls[key]; found {
+		return nil, false, ErrWrongType
+	}
+
+	v, kind, found, err := f.lookup(key)
+	if kind != "" {
+		return nil, false, ErrWrongType
+	}
+
+	return v, found, err
+}
+
+// setEncoded stores an encoded value at key, replacing whatever it held
+func (f *fsm) setEncoded(key string, value []byte) {
+	// nil marks a deleted key when there is a backend
+	if value == nil && f.Backend != nil {
+		value = []byte{}
+	}
+
+	f.track(key)
+	delete(f.colls, key)
+	f.m[key] = value
+}
+
+// remove deletes key, whatever it holds
+func (f *fsm) remove(key string) {
+	f.track(key)
+	delete(f.colls, key)
+	if f.Backend != nil {
+		f.m[key] = nil
+		return
+	}
+
+	delete(f.m, key)
+}
+
+// loadCollection returns the collection at key, nil if there is none. A collection that is still
+// encoded is decoded, and kept decoded if keep is set. Only writers keep it, since a reader can't
+// tell that the value really is that kind of collection, unless the backend knows its kind.
+func (f *fsm) loadCollection(key string, decode func([]byte) (collection, error), keep bool) (collection, error) {
+	if keep {
+		f.track(key)
+	}
+
+	if c, found := f.colls[key]; found {
+		f.touch(key)
+		return c, nil
+	}
+
+	v, kind, found, err := f.lookup(key)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	if known, isKnown := collectionDecoders[kind]; isKnown {
+		decode = known
+		keep = true
+	}
+
+	c, err := decode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if keep {
+		// The key was tracked by its encoding, which holds the same value as the decoded collection
+		if before, tracked := f.tracked[key]; tracked && before.coll == nil {
+			f.tracked[key] = keyState{coll: c, gen: c.generation()}
+		}
+
+		delete(f.m, key)
+		f.colls[key] = c
+		f.touch(key)
+		// Without a kind it isn't stored as a collection yet
+		if kind == "" {
+			f.markDirty(key)
+		}
+	}
+
+	return c, nil
+}
+
+// putCollection stores a collection at key, removing the key if it is empty
+func (f *fsm) putCollection(key string, c collection) {
+	if c.size() == 0 {
+		f.remove(key)
+		return
+	}
+
+	f.track(key)
+	delete(f.m, key)
+	f.colls[key] = c
+	f.touch(key)
+	f.markDirty(key)
+}
+
+// getList returns the list at key, an empty one if there is none. Writers pass keep, and have to
+// put the list back with putCollection.
+func (f *fsm) getList(key string, keep bool) (*listValue, error) {
+	c, err := f.loadCollection(key, decodeList, keep)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return &listValue{}, nil
+	}
+
+	l, isList := c.(*listValue)
+	if !isList {
+		return nil, ErrWrongType
+	}
+
+	return l, nil
+}
+
+// getSet is getList for sets
+func (f *fsm) getSet(key string, keep bool) (*setValue, error) {
+	c, err := f.loadCollection(key, decodeSet, keep)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return newSet(), nil
+	}
+
+	s, isSet := c.(*setValue)
+	if !isSet {
+		return nil, ErrWrongType
+	}
+
+	return s, nil
+}
+
+// getZSet is getList for sorted sets
+func (f *fsm) getZSet(key string, keep bool) (*zsetValue, error) {
+	c, err := f.loadCollection(key, decodeZSet, keep)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return newZSet(), nil
+	}
+
+	z, isZSet := c.(*zsetValue)
+	if !isZSet {
+		return nil, ErrWrongType
+	}
+
+	return z, nil
+}
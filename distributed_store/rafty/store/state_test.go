@@ -0,0 +1,207 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (b *bufferSink) ID() string    { return "test" }
+func (b *bufferSink) Cancel() error { return nil }
+func (b *bufferSink) Close() error  { return nil }
+
+func snapshotOf(t *testing.T, f *fsm) []byte {
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	sink := &bufferSink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	return sink.Bytes()
+}
+
+func restoreFrom(t *testing.T, b []byte) (*Store, *fsm) {
+	s := New()
+	f := (*fsm)(s)
+	if err := f.Restore(ioutil.NopCloser(bytes.NewReader(b))); err != nil {
+		t.Fatal(err)
+	}
+
+	return s, f
+}
+
+func fillCollections(t *testing.T, f *fsm) {
+	encode := func(v interface{}) []byte {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	applyCommand(t, f, 1, &command{Op: "rpush", Key: "l", Value: encode([]interface{}{"a", "b"})})
+	applyCommand(t, f, 2, &command{Op: "addToSet", Key: "s", Value: []byte("m")})
+	applyCommand(t, f, 3, &command{Op: "zadd", Key: "z", Score: 2, Value: encode("two")})
+	applyCommand(t, f, 4, &command{Op: "zadd", Key: "z", Score: 1, Value: encode("one")})
+	applyCommand(t, f, 5, &command{Op: "set", Key: "raw", Value: []byte("v")})
+}
+
+func expectCollections(t *testing.T, s *Store) {
+	if l, _ := s.LRange("l", 0, -1); fmt.Sprint(l) != "[a b]" {
+		t.Fatalf("Unexpected list: %v", l)
+	}
+	if in, _ := s.SIsMember("s", []byte("m")); !in {
+		t.Fatal("Expected set member")
+	}
+	if z, _ := s.ZRangeByScore("z", 0, 10); fmt.Sprint(z) != "[one two]" {
+		t.Fatalf("Unexpected sorted set: %v", z)
+	}
+	if v, _ := s.Get("raw"); string(v) != "v" {
+		t.Fatalf("Unexpected raw value: %s", v)
+	}
+}
+
+func TestSnapshotCollections(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	fillCollections(t, f)
+
+	restored, rf := restoreFrom(t, snapshotOf(t, f))
+	expectCollections(t, restored)
+	if len(rf.colls) != 3 {
+		t.Fatalf("Expected collections to be decoded on restore, got: %v", rf.colls)
+	}
+	if _, found := rf.m[collectionKindsKey]; found {
+		t.Fatal("Expected the collection kinds not to be restored as a key")
+	}
+
+	// Snapshots from before collections were kept decoded hold the same encoding without the kinds,
+	// which is also what Get returns
+	old := make(map[string][]byte)
+	for _, k := range []string{"l", "s", "z", "raw"} {
+		old[k], _ = s.Get(k)
+	}
+	b, err := msgpack.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, rf = restoreFrom(t, b)
+	expectCollections(t, restored)
+	if len(rf.colls) != 0 {
+		t.Fatalf("Expected reads to leave collections encoded, got: %v", rf.colls)
+	}
+
+	applyCommand(t, rf, 6, &command{Op: "srem", Key: "s", Value: []byte("x")})
+	if _, isSet := rf.colls["s"].(*setValue); !isSet {
+		t.Fatal("Expected a write to decode the set")
+	}
+}
+
+func TestCollectionChanges(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	fillCollections(t, f)
+
+	w, err := s.Watch("", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// Removing something that isn't there is not a change
+	applyCommand(t, f, 6, &command{Op: "srem", Key: "s", Value: []byte("x")})
+	expectNoEvent(t, w)
+
+	applyCommand(t, f, 7, &command{Op: "addToSet", Key: "s", Value: []byte("n")})
+	expectEvent(t, w, 7, EventModified, "s")
+
+	applyCommand(t, f, 8, &command{Op: "zremrangebyscore", Key: "z", Min: 0, Max: 10})
+	expectEvent(t, w, 8, EventDeleted, "z")
+
+	// Other kinds of operation can't be used on collections
+	if resp := applyCommand(t, f, 9, &command{Op: "hset", Key: "l", Field: "f", Value: []byte{0xc0}}); resp != ErrWrongType {
+		t.Fatalf("Expected wrong type, got: %v", resp)
+	}
+	if resp := applyCommand(t, f, 10, &command{Op: "incrBy", Key: "l", By: 1}); resp != ErrNotNumber {
+		t.Fatalf("Expected not a number, got: %v", resp)
+	}
+	if resp := applyCommand(t, f, 11, &command{Op: "zadd", Key: "l", Score: 1, Value: []byte{0xc0}}); resp != ErrWrongType {
+		t.Fatalf("Expected wrong type, got: %v", resp)
+	}
+	expectNoEvent(t, w)
+}
+
+func bigZSet(members int) *zsetValue {
+	zset := newZSet()
+	for i := 0; i < members; i++ {
+		encoded, _ := msgpack.Marshal(fmt.Sprintf("member-%d", i))
+		zset.add(int64(i), encoded)
+	}
+	return zset
+}
+
+// BenchmarkZAdd adds to a sorted set of 100k members through Apply, including telling a watch
+func BenchmarkZAdd(b *testing.B) {
+	s := New()
+	f := (*fsm)(s)
+	f.putCollection("z", bigZSet(100000))
+
+	w, err := s.Watch("z", false, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer w.Stop()
+	go func() {
+		for range w.Events() {
+		}
+	}()
+
+	commands := make([][]byte, b.N)
+	for i := range commands {
+		value, _ := msgpack.Marshal(fmt.Sprintf("new-%d", i))
+		if commands[i], err = msgpack.Marshal(&command{Op: "zadd", Key: "z", Score: int64(i), Value: value}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Apply(&raft.Log{Index: uint64(i + 1), Data: commands[i]})
+	}
+}
+
+// BenchmarkZAddEncoded is what every ZADD to the same set cost while collections were stored
+// encoded, to compare BenchmarkZAdd with
+func BenchmarkZAddEncoded(b *testing.B) {
+	encoded, err := bigZSet(100000).encode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	value, _ := msgpack.Marshal("new")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, err := decodeZSet(encoded)
+		if err != nil {
+			b.Fatal(err)
+		}
+		c.(*zsetValue).add(int64(i), value)
+		if encoded, err = c.encode(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
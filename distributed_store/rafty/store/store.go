@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
@@ -19,10 +20,10 @@ import (
 
 	"errors"
 	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
 	logger "github.com/TykTechnologies/tykcommon-logger"
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/raft-boltdb"
-	"github.com/wangjia184/sortedset"
 	"gopkg.in/vmihailenco/msgpack.v2"
 	"strconv"
 	"strings"
@@ -43,6 +44,29 @@ type command struct {
 	Min   int64  `json:"min,omitempty"`
 	Max   int64  `json:"max,omitempty"`
 	Value []byte `json:"value,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	TTL   int64  `json:"ttl,omitempty"`
+	Now   int64  `json:"now,omitempty"`
+	Token uint64 `json:"token,omitempty"`
+
+	// Hashes
+	Field  string   `json:"field,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	By     int64    `json:"by,omitempty"`
+
+	// Float counters
+	ByFloat float64 `json:"byFloat,omitempty"`
+
+	// List ranges and positions
+	Start int `json:"start,omitempty"`
+	Stop  int `json:"stop,omitempty"`
+	Pos   int `json:"pos,omitempty"`
+
+	Cond *Condition `json:"cond,omitempty"`
+
+	// Transactions
+	Checks []TxnCheck `json:"checks,omitempty"`
+	Ops    []command  `json:"ops,omitempty"`
 }
 
 // Store is a simple key-value store, where all changes are made via Raft consensus.
@@ -51,10 +75,39 @@ type Store struct {
 	RaftBind string
 	RaftAdvertise string
 
-	mu sync.Mutex
-	m  map[string][]byte // The key-value store for the system.
+	// Backend keeps the values on disk rather than in memory if set, it is closed by Stop
+	Backend Backend
+
+	mu      sync.Mutex
+	m       map[string][]byte     // The key-value store for the system.
+	colls   map[string]collection // Lists, sets and sorted sets, kept decoded
+	applied uint64                // The index of the last log entry applied
+
+	// What the keys changed by the entry being applied held before it, see fsm.track
+	tracked     map[string]keyState
+	trackedKeys []string
+
+	// Changes not yet written to the Backend, see backend.go
+	dirty        map[string]bool
+	touched      map[string]bool
+	checkpointed time.Time
 
-	raft *raft.Raft // The consensus mechanism
+	raft         *raft.Raft // The consensus mechanism
+	observer     *raft.Observer
+	observations chan raft.Observation
+
+	// Leadership change subscribers
+	leaderMu      sync.Mutex
+	dispatchMu    sync.Mutex
+	leader        string
+	localAddr     string
+	leaderSubs    map[int]func(LeaderChange)
+	nextLeaderSub int
+
+	// Key change watches and the recent events they can resume from
+	watchMu sync.Mutex
+	watches map[*Watch]struct{}
+	history eventHistory
 
 	logger *logrus.Logger
 }
@@ -62,8 +115,13 @@ type Store struct {
 // New returns a new Store.
 func New() *Store {
 	return &Store{
-		m:      make(map[string][]byte),
-		logger: log,
+		m:          make(map[string][]byte),
+		colls:      make(map[string]collection),
+		dirty:      make(map[string]bool),
+		touched:    make(map[string]bool),
+		leaderSubs: make(map[int]func(LeaderChange)),
+		watches:    make(map[*Watch]struct{}),
+		logger:     log,
 	}
 }
 
@@ -80,6 +138,13 @@ func GetOutboundIP() (string, error) {
 // Open opens the store. If enableSingle is set, and there are no existing peers,
 // then this node becomes the first node, and therefore leader, of the cluster.
 func (s *Store) Open(enableSingle bool) error {
+	// Capture the metrics raft emits in the TCF registry
+	if err := metrics.RegisterGlobalSink(); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"prefix": "tcf.rafty.store",
+		}).Warning("failed to register the metrics sink: ", err)
+	}
+
 	// Setup Raft configuration with our custom writer to convert to logrus
 	config := raft.DefaultConfig()
 	convertedLogger := &ConvertedLogrusLogger{Prefix: "tcf.rafty.raft", LogInstance: log}
@@ -120,6 +185,7 @@ func (s *Store) Open(enableSingle bool) error {
 	if err != nil {
 		return err
 	}
+	s.localAddr = transport.LocalAddr()
 
 	// Create peer storage.
 	peerStore := raft.NewJSONPeers(s.RaftDir, transport)
@@ -136,12 +202,23 @@ func (s *Store) Open(enableSingle bool) error {
 		return fmt.Errorf("new bolt store: %s", err)
 	}
 
+	// Pick up from where the backend got to, raft replays the log entries it already holds
+	if s.Backend != nil {
+		if err := s.openBackend(); err != nil {
+			return fmt.Errorf("state backend: %s", err)
+		}
+		s.logger.WithFields(logrus.Fields{
+			"prefix": "tcf.rafty.store",
+		}).Info("state backend is up to index ", s.applied)
+	}
+
 	// Instantiate the Raft systems.
 	ra, err := raft.NewRaft(config, (*fsm)(s), logStore, logStore, snapshots, peerStore, transport)
 	if err != nil {
 		return fmt.Errorf("new raft: %s", err)
 	}
 	s.raft = ra
+	s.watchState()
 
 	return nil
 }
@@ -154,7 +231,9 @@ func (s *Store) Leader() string {
 func (s *Store) Get(key string) ([]byte, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.m[key], nil
+
+	v, _, err := (*fsm)(s).raw(key)
+	return v, err
 }
 
 // Set sets the value for the given key.
@@ -173,8 +252,7 @@ func (s *Store) Set(key string, value []byte) error {
 		return err
 	}
 
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+	return s.apply(b)
 }
 
 func (s *Store) AddToSet(key string, value []byte) error {
@@ -194,24 +272,21 @@ func (s *Store) AddToSet(key string, value []byte) error {
 		return err
 	}
 
-	m := s.raft.Apply(b, raftTimeout)
-	return m.Error()
+	return s.apply(b)
 }
 
 func (s *Store) GetSet(key string) (map[interface{}]interface{}, error) {
-	// Get the set
 	s.mu.Lock()
-	v, f := s.m[key]
-	s.mu.Unlock()
+	defer s.mu.Unlock()
 
-	// Decode it from []byte
-	var set map[interface{}]interface{}
-	if !f {
-		return nil, nil
+	members, err := (*fsm)(s).getSet(key, false)
+	if err != nil || members.size() == 0 {
+		return nil, err
 	}
 
-	if err := msgpack.Unmarshal(v, &set); err != nil {
-		return nil, err
+	set := make(map[interface{}]interface{}, members.size())
+	for id, value := range members.members {
+		set[id] = value
 	}
 
 	return set, nil
@@ -236,26 +311,19 @@ func (s *Store) LPush(key string, values ...interface{}) error {
 		return err
 	}
 
-	m := s.raft.Apply(b, raftTimeout)
-	return m.Error()
+	return s.apply(b)
 }
 
 func (s *Store) LLen(key string) (int64, error) {
-	// Get the list
 	s.mu.Lock()
-	v, f := s.m[key]
-	s.mu.Unlock()
+	defer s.mu.Unlock()
 
-	var l []interface{}
-	if !f {
-		return 0, nil
-	} else {
-		if err := msgpack.Unmarshal(v, &l); err != nil {
-			return 0, err
-		}
+	l, err := (*fsm)(s).getList(key, false)
+	if err != nil {
+		return 0, err
 	}
 
-	return int64(len(l)), nil
+	return int64(l.size()), nil
 }
 
 func (s *Store) LRem(key string, count int, value interface{}) error {
@@ -278,25 +346,18 @@ func (s *Store) LRem(key string, count int, value interface{}) error {
 		return err
 	}
 
-	m := s.raft.Apply(b, raftTimeout)
-	return m.Error()
+	return s.apply(b)
 }
 
 func (s *Store) LRange(key string, from, to int) ([]interface{}, error) {
-
-	// Get the list
 	s.mu.Lock()
-	v, f := s.m[key]
-	s.mu.Unlock()
+	defer s.mu.Unlock()
 
-	var list []interface{}
-	if !f {
-		return []interface{}{}, nil
-	} else {
-		if err := msgpack.Unmarshal(v, &list); err != nil {
-			return []interface{}{}, err
-		}
+	l, err := (*fsm)(s).getList(key, false)
+	if err != nil {
+		return []interface{}{}, err
 	}
+	list := l.items
 
 	if from < 0 {
 		from = len(list) + from
@@ -329,42 +390,24 @@ func (s *Store) LRange(key string, from, to int) ([]interface{}, error) {
 		return []interface{}{}, errors.New("Start index is after end")
 	}
 
-	return list[from:to], nil
+	return append([]interface{}{}, list[from:to]...), nil
 }
 
 func (s *Store) ZRangeByScore(key string, min, max int64) ([]interface{}, error) {
-	// Get the list
+	// Copy the members out, they are decoded without holding the lock
 	s.mu.Lock()
-	v, f := s.m[key]
-	s.mu.Unlock()
-
-	var sSetSeed []SortedSetBaseValue
-	if !f {
-		return []interface{}{}, nil
-	} else {
-		if err := msgpack.Unmarshal(v, &sSetSeed); err != nil {
-			return []interface{}{}, err
-		}
-	}
-
-	// Seed the set
-	set := sortedset.New()
-	for _, item := range sSetSeed {
-		set.AddOrUpdate(item.ID, item.Score, item.Value)
+	zset, err := (*fsm)(s).getZSet(key, false)
+	var encoded [][]byte
+	if err == nil {
+		encoded = zset.rangeByScore(min, max)
 	}
+	s.mu.Unlock()
 
-	r := set.GetByScoreRange(sortedset.SCORE(min), sortedset.SCORE(max), nil)
-
-	vals := make([]interface{}, len(r))
-	for i, v := range r {
-		var decoded interface{}
-		if err := msgpack.Unmarshal(v.Value.([]byte), &decoded); err != nil {
-			return []interface{}{}, err
-		}
-		vals[i] = decoded
+	if err != nil {
+		return []interface{}{}, err
 	}
 
-	return vals, nil
+	return decodeMembers(encoded)
 }
 
 func (s *Store) ZAdd(key string, score int64, value interface{}) error {
@@ -389,8 +432,7 @@ func (s *Store) ZAdd(key string, score int64, value interface{}) error {
 		return err
 	}
 
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+	return s.apply(b)
 }
 
 func (s *Store) ZRemRangeByScore(key string, min int64, max int64) error {
@@ -409,8 +451,7 @@ func (s *Store) ZRemRangeByScore(key string, min int64, max int64) error {
 		return err
 	}
 
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+	return s.apply(b)
 }
 
 // Delete deletes the given key.
@@ -428,8 +469,7 @@ func (s *Store) Delete(key string) error {
 		return err
 	}
 
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+	return s.apply(b)
 }
 
 // Join joins a node, located at addr, to this store. The node must be ready to
@@ -484,40 +524,39 @@ func (s *Store) IsLeader() bool {
 }
 
 func (s *Store) Stop() {
-	s.raft.Shutdown()
+	if s.observer != nil {
+		s.raft.DeregisterObserver(s.observer)
+		close(s.observations)
+		s.observer = nil
+	}
+	s.raft.Shutdown().Error()
+	s.stopWatches(ErrWatchStopped)
+
+	if s.Backend != nil {
+		if err := s.closeBackend(); err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"prefix": "tcf.rafty.store",
+			}).Error("failed to close state backend: ", err)
+		}
+	}
 }
 
 type fsmSnapshot struct {
 	store map[string][]byte
+	index uint64
 }
 
 func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
-	err := func() error {
-		// Encode data.
-		b, err := msgpack.Marshal(f.store)
-		if err != nil {
-			return err
-		}
-
-		// Write data to sink.
-		if _, err := sink.Write(b); err != nil {
-			return err
-		}
-
-		// Close the sink.
-		if err := sink.Close(); err != nil {
-			return err
-		}
-
-		return nil
-	}()
-
-	if err != nil {
-		sink.Cancel()
-		return err
-	}
-
-	return nil
+	return persistSnapshot(sink, func(w io.Writer) error {
+		return writeSnapshot(w, f.index, len(f.store), func(put func(string, []byte) error) error {
+			for k, v := range f.store {
+				if err := put(k, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
 }
 
 func (f *fsmSnapshot) Release() {}
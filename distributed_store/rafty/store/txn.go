@@ -0,0 +1,190 @@
+package store
+
+import (
+	"fmt"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+)
+
+// TxnOpType is an operation that can be run in a transaction, values are encoded as they are for
+// the store method of the same name
+type TxnOpType string
+
+const (
+	TxnSetNode          TxnOpType = "setNode"
+	TxnDeleteNode       TxnOpType = "deleteNode"
+	TxnSet              TxnOpType = "set"
+	TxnDelete           TxnOpType = "delete"
+	TxnAddToSet         TxnOpType = "addToSet"
+	TxnLPush            TxnOpType = "lpush"
+	TxnLRem             TxnOpType = "lrem"
+	TxnZAdd             TxnOpType = "zadd"
+	TxnZRemRangeByScore TxnOpType = "zremrangebyscore"
+)
+
+var txnOps = map[TxnOpType]bool{
+	TxnSetNode:          true,
+	TxnDeleteNode:       true,
+	TxnSet:              true,
+	TxnDelete:           true,
+	TxnAddToSet:         true,
+	TxnLPush:            true,
+	TxnLRem:             true,
+	TxnZAdd:             true,
+	TxnZRemRangeByScore: true,
+}
+
+// TxnCheck is a condition on a key/value node that must hold for a transaction to be applied
+type TxnCheck struct {
+	Key  string
+	Cond Condition
+}
+
+// TxnOp is a single operation in a transaction
+type TxnOp struct {
+	Op    TxnOpType
+	Key   string
+	Value []byte
+	Count int
+	Score int64
+	Min   int64
+	Max   int64
+	// Cond guards TxnSetNode and TxnDeleteNode like it does for SetNode and DeleteNode
+	Cond *Condition
+}
+
+// TxnOpResult is the outcome of an operation in a transaction that was applied
+type TxnOpResult struct {
+	Key string `json:"key"`
+	// Node is the stored node for TxnSetNode operations
+	Node *rafty_objects.NodeValue `json:"node,omitempty"`
+}
+
+// TxnResult is the outcome of a transaction. If a check or an operation fails nothing is changed,
+// and FailedCheck or FailedOp says which one it was.
+type TxnResult struct {
+	Succeeded   bool          `json:"succeeded"`
+	Index       uint64        `json:"index"`
+	Results     []TxnOpResult `json:"results,omitempty"`
+	FailedCheck int           `json:"failedCheck"`
+	FailedOp    int           `json:"failedOp"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Txn applies ops as a single raft log entry, only if every check holds and every op succeeds. Ops
+// see the changes made by the ops before them, and readers see either none or all of the changes.
+func (s *Store) Txn(checks []TxnCheck, ops []TxnOp) (*TxnResult, error) {
+	c := &command{
+		Op:     "txn",
+		Checks: checks,
+		Ops:    make([]command, len(ops)),
+	}
+
+	for i, op := range ops {
+		if !txnOps[op.Op] {
+			return nil, fmt.Errorf("operation %q can't be used in a transaction", op.Op)
+		}
+
+		c.Ops[i] = command{
+			Op:    string(op.Op),
+			Key:   op.Key,
+			Value: op.Value,
+			Count: op.Count,
+			Score: op.Score,
+			Min:   op.Min,
+			Max:   op.Max,
+			Cond:  op.Cond,
+		}
+	}
+
+	resp, err := s.applyNodeCommand(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.(*TxnResult), nil
+}
+
+func (f *fsm) applyTxn(c *command, index uint64) interface{} {
+	result := &TxnResult{Index: index, FailedCheck: -1, FailedOp: -1}
+	f.runTxn(c, index, result)
+	return result
+}
+
+// runTxn checks and applies the transaction under a single lock
+func (f *fsm) runTxn(c *command, index uint64, result *TxnResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, check := range c.Checks {
+		current, err := f.getNode(check.Key, c.Now)
+		if err != nil {
+			err = ErrCompareFailed
+		} else {
+			err = check.Cond.check(current)
+		}
+
+		if err != nil {
+			result.FailedCheck = i
+			result.Error = err.Error()
+			return
+		}
+	}
+
+	// Run the ops against a scratch copy of the keys they touch, so that nothing changes unless all
+	// of them succeed. Collections are copied by encoding them, and decoded again by the first op
+	// that uses them.
+	scratch := (*fsm)(New())
+	for i, op := range c.Ops {
+		v, found, err := f.raw(op.Key)
+		if err != nil {
+			result.FailedOp = i
+			result.Error = err.Error()
+			return
+		}
+		if found {
+			scratch.m[op.Key] = v
+		}
+	}
+
+	for i := range c.Ops {
+		op := &c.Ops[i]
+		op.Now = c.Now
+
+		var resp interface{}
+		if txnOps[TxnOpType(op.Op)] {
+			resp = scratch.applyCommand(op, index)
+		} else {
+			resp = fmt.Errorf("operation %q can't be used in a transaction", op.Op)
+		}
+
+		if err, isErr := resp.(error); isErr {
+			result.FailedOp = i
+			result.Error = err.Error()
+			return
+		}
+
+		opResult := TxnOpResult{Key: op.Key}
+		if node, isNode := resp.(*rafty_objects.NodeValue); isNode {
+			opResult.Node = node
+		}
+		result.Results = append(result.Results, opResult)
+	}
+
+	seen := make(map[string]bool)
+	for _, op := range c.Ops {
+		if seen[op.Key] {
+			continue
+		}
+		seen[op.Key] = true
+
+		f.remove(op.Key)
+		if v, found := scratch.m[op.Key]; found {
+			f.setEncoded(op.Key, v)
+		} else if coll, found := scratch.colls[op.Key]; found {
+			f.putCollection(op.Key, coll)
+		}
+	}
+
+	result.Succeeded = true
+}
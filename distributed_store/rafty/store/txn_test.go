@@ -0,0 +1,106 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	rafty_objects "github.com/TykTechnologies/tyk-cluster-framework/distributed_store/rafty/objects"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+func TestTxn(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+	now := time.Now().UnixNano()
+	value := func(k, v string) []byte { return encodeNode(t, &rafty_objects.NodeValue{Key: k, Value: v}) }
+	member := func(v string) []byte {
+		b, err := msgpack.Marshal([]interface{}{v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	applyCommand(t, f, 3, &command{Op: "setNode", Key: "a", Value: value("a", "1"), Now: now})
+
+	w, err := s.Watch("", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// A failed check leaves everything alone
+	resp := applyCommand(t, f, 4, &command{
+		Op:     "txn",
+		Now:    now,
+		Checks: []TxnCheck{{Key: "a", Cond: Condition{PrevIndex: 2}}},
+		Ops:    []command{{Op: "setNode", Key: "b", Value: value("b", "2")}},
+	})
+	result := resp.(*TxnResult)
+	if result.Succeeded || result.FailedCheck != 0 || result.FailedOp != -1 {
+		t.Fatalf("Expected check to fail, got: %+v", result)
+	}
+	if v, _ := s.Get("b"); v != nil {
+		t.Fatal("Expected b not to be written")
+	}
+
+	// A failed op rolls back the ops before it
+	resp = applyCommand(t, f, 5, &command{
+		Op:  "txn",
+		Now: now,
+		Ops: []command{
+			{Op: "setNode", Key: "b", Value: value("b", "2")},
+			{Op: "deleteNode", Key: "a", Cond: &Condition{PrevIndex: 2}},
+		},
+	})
+	result = resp.(*TxnResult)
+	if result.Succeeded || result.FailedOp != 1 || result.Error != ErrCompareFailed.Error() {
+		t.Fatalf("Expected second op to fail, got: %+v", result)
+	}
+	if v, _ := s.Get("b"); v != nil {
+		t.Fatal("Expected b to be rolled back")
+	}
+
+	resp = applyCommand(t, f, 6, &command{
+		Op:     "txn",
+		Now:    now,
+		Checks: []TxnCheck{{Key: "a", Cond: Condition{PrevIndex: 3}}},
+		Ops: []command{
+			{Op: "setNode", Key: "b", Value: value("b", "2")},
+			{Op: "deleteNode", Key: "a"},
+			{Op: "lpush", Key: "l", Value: member("x")},
+			{Op: "lpush", Key: "l", Value: member("y")},
+		},
+	})
+	result = resp.(*TxnResult)
+	if !result.Succeeded || result.Index != 6 || len(result.Results) != 4 {
+		t.Fatalf("Expected transaction to succeed, got: %+v", result)
+	}
+	if n := result.Results[0].Node; n == nil || n.CreatedIndex != 6 {
+		t.Fatalf("Expected b to be created at 6, got: %+v", n)
+	}
+	if v, _ := s.Get("a"); v != nil {
+		t.Fatal("Expected a to be deleted")
+	}
+	if l, _ := s.LRange("l", 0, -1); len(l) != 2 || l[0] != "y" {
+		t.Fatalf("Expected later ops to see earlier ones, got: %v", l)
+	}
+
+	// Watchers get one event per key changed, all at the transaction's index
+	got := map[string]EventType{}
+	for i := 0; i < 3; i++ {
+		e := <-w.Events()
+		if e.Index != 6 {
+			t.Fatalf("Expected event at 6, got: %+v", e)
+		}
+		got[e.Key] = e.Type
+	}
+	if got["a"] != EventDeleted || got["b"] != EventCreated || got["l"] != EventCreated {
+		t.Fatalf("Unexpected events: %v", got)
+	}
+	select {
+	case e := <-w.Events():
+		t.Fatalf("Unexpected extra event: %+v", e)
+	default:
+	}
+}
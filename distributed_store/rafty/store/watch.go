@@ -0,0 +1,287 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+const (
+	// watchHistorySize is how many events are kept for watches resuming from an earlier index
+	watchHistorySize = 1000
+	// watchBufferSize is how many new events a watch can fall behind by before it is dropped
+	watchBufferSize = 100
+)
+
+// EventType is the kind of change an Event describes, the values match the HTTP API's actions
+type EventType string
+
+const (
+	EventCreated  EventType = "created"
+	EventModified EventType = "modified"
+	EventDeleted  EventType = "deleted"
+)
+
+var (
+	// ErrWatchIndexCleared is returned when a watch asks to resume from an index that is older than
+	// the event history, the caller should re-read the keys it cares about and watch from now
+	ErrWatchIndexCleared = errors.New("the requested index is outside the event history")
+	// ErrWatchOverflow ends a watch that fell too far behind, resume it from the index of the last
+	// event received
+	ErrWatchOverflow = errors.New("watch fell behind and was dropped")
+	// ErrWatchStopped ends a watch that was stopped, or one whose store was stopped or restored
+	ErrWatchStopped = errors.New("watch stopped")
+)
+
+// Event is a change to a key, every node emits events as the change is applied to its copy of the
+// store, Index is the raft index of the change.
+type Event struct {
+	Index uint64
+	Type  EventType
+	Key   string
+	// Value is the raw stored value after the change, nil for deletes and for lists, sets and sorted
+	// sets, which aren't encoded on every change
+	Value []byte
+}
+
+// Watch delivers events for a key, or for all keys with a prefix
+type Watch struct {
+	Key    string
+	Prefix bool
+
+	// events buffers new changes, out is what the watcher reads and only differs from events while
+	// missed events are being replayed
+	events  chan Event
+	out     chan Event
+	stopped chan struct{}
+	store   *Store
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// Events returns the channel events are delivered on, it is closed when the watch ends, see Err.
+func (w *Watch) Events() <-chan Event {
+	return w.out
+}
+
+// Err returns why the watch ended, or nil while it is still running.
+func (w *Watch) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Stop ends the watch.
+func (w *Watch) Stop() {
+	w.store.removeWatch(w)
+	w.close(ErrWatchStopped)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.stopped:
+	default:
+		close(w.stopped)
+	}
+}
+
+func (w *Watch) matches(key string) bool {
+	if w.Prefix {
+		return strings.HasPrefix(key, w.Key)
+	}
+	return key == w.Key
+}
+
+// replay delivers the events missed before the watch started, followed by the new ones buffered in
+// the meantime. It blocks on the reader, so however many events were missed the watch only falls
+// behind if more than watchBufferSize new ones arrive while they are being read.
+func (w *Watch) replay(missed []Event) {
+	defer close(w.out)
+
+	for _, e := range missed {
+		select {
+		case w.out <- e:
+		case <-w.stopped:
+			return
+		}
+	}
+
+	for e := range w.events {
+		select {
+		case w.out <- e:
+		case <-w.stopped:
+			return
+		}
+	}
+}
+
+// send delivers an event without blocking, returning false if the watch has fallen behind
+func (w *Watch) send(e Event) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return true
+	}
+
+	select {
+	case w.events <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Watch) close(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	w.closed = true
+	w.err = err
+	close(w.events)
+}
+
+// eventHistory is a ring buffer of the most recent events
+type eventHistory struct {
+	events []Event
+	start  int
+	count  int
+	// complete is the index after which the history has every event
+	complete uint64
+	// reset is set when the history no longer lines up with the log, e.g. after a restore
+	reset bool
+}
+
+func (h *eventHistory) add(e Event) {
+	if h.events == nil {
+		h.events = make([]Event, watchHistorySize)
+	}
+
+	if h.count == len(h.events) {
+		h.complete = h.events[h.start].Index
+		h.start = (h.start + 1) % len(h.events)
+		h.count--
+	}
+
+	h.events[(h.start+h.count)%len(h.events)] = e
+	h.count++
+}
+
+// since returns the events after index, or false if some of them are no longer in the history
+func (h *eventHistory) since(index uint64) ([]Event, bool) {
+	if h.reset || index < h.complete {
+		return nil, false
+	}
+
+	found := make([]Event, 0)
+	for i := 0; i < h.count; i++ {
+		e := h.events[(h.start+i)%len(h.events)]
+		if e.Index > index {
+			found = append(found, e)
+		}
+	}
+
+	return found, true
+}
+
+// Watch follows changes to key, or to every key starting with key if prefix is set. If afterIndex
+// is set the events after that raft index are replayed first, so that a client can pick up where
+// it left off, otherwise only new changes are delivered.
+func (s *Store) Watch(key string, prefix bool, afterIndex uint64) (*Watch, error) {
+	w := &Watch{
+		Key:     key,
+		Prefix:  prefix,
+		events:  make(chan Event, watchBufferSize),
+		stopped: make(chan struct{}),
+		store:   s,
+	}
+	w.out = w.events
+
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	if afterIndex > 0 {
+		history, ok := s.history.since(afterIndex)
+		if !ok {
+			return nil, ErrWatchIndexCleared
+		}
+
+		missed := make([]Event, 0)
+		for _, e := range history {
+			if w.matches(e.Key) {
+				missed = append(missed, e)
+			}
+		}
+
+		if len(missed) > 0 {
+			w.out = make(chan Event)
+			go w.replay(missed)
+		}
+	}
+
+	s.watches[w] = struct{}{}
+	return w, nil
+}
+
+func (s *Store) removeWatch(w *Watch) {
+	s.watchMu.Lock()
+	delete(s.watches, w)
+	s.watchMu.Unlock()
+}
+
+// stopWatches ends every watch with err
+func (s *Store) stopWatches(err error) {
+	s.watchMu.Lock()
+	watches := s.watches
+	s.watches = make(map[*Watch]struct{})
+	s.watchMu.Unlock()
+
+	for w := range watches {
+		w.close(err)
+	}
+}
+
+// notify records the change of key at index and passes it on to the watches, before and after are
+// the stored values either side of the change
+func (s *Store) notify(index uint64, key string, before, after keyState) {
+	var t EventType
+	switch {
+	case !before.exists() && !after.exists():
+		return
+	case !before.exists():
+		t = EventCreated
+	case !after.exists():
+		t = EventDeleted
+	case after.unchanged(before):
+		return
+	default:
+		t = EventModified
+	}
+
+	e := Event{Index: index, Type: t, Key: key, Value: after.raw}
+
+	s.watchMu.Lock()
+	if s.history.reset {
+		s.history = eventHistory{complete: index - 1}
+	}
+	s.history.add(e)
+
+	var dropped []*Watch
+	for w := range s.watches {
+		if w.matches(key) && !w.send(e) {
+			delete(s.watches, w)
+			dropped = append(dropped, w)
+		}
+	}
+	s.watchMu.Unlock()
+
+	for _, w := range dropped {
+		w.close(ErrWatchOverflow)
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func expectEvent(t *testing.T, w *Watch, index uint64, typ EventType, key string) {
+	// Missed events are replayed from another goroutine
+	select {
+	case e := <-w.Events():
+		if e.Index != index || e.Type != typ || e.Key != key {
+			t.Fatalf("Expected %v %v at %v, got: %+v", typ, key, index, e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected %v %v at %v, got nothing", typ, key, index)
+	}
+}
+
+func expectNoEvent(t *testing.T, w *Watch) {
+	select {
+	case e := <-w.Events():
+		t.Fatalf("Expected no event, got: %+v", e)
+	default:
+	}
+}
+
+func TestWatch(t *testing.T) {
+	s := New()
+	f := (*fsm)(s)
+
+	prefix, err := s.Watch("config.", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact, err := s.Watch("config.a", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applyCommand(t, f, 1, &command{Op: "set", Key: "config.a", Value: []byte("1")})
+	applyCommand(t, f, 2, &command{Op: "set", Key: "config.b", Value: []byte("1")})
+	applyCommand(t, f, 3, &command{Op: "set", Key: "other", Value: []byte("1")})
+	applyCommand(t, f, 4, &command{Op: "set", Key: "config.a", Value: []byte("2")})
+	// Setting the same value again is not a change
+	applyCommand(t, f, 5, &command{Op: "set", Key: "config.a", Value: []byte("2")})
+	applyCommand(t, f, 6, &command{Op: "delete", Key: "config.b"})
+
+	expectEvent(t, prefix, 1, EventCreated, "config.a")
+	expectEvent(t, prefix, 2, EventCreated, "config.b")
+	expectEvent(t, prefix, 4, EventModified, "config.a")
+	expectEvent(t, prefix, 6, EventDeleted, "config.b")
+	expectNoEvent(t, prefix)
+
+	expectEvent(t, exact, 1, EventCreated, "config.a")
+	expectEvent(t, exact, 4, EventModified, "config.a")
+	expectNoEvent(t, exact)
+
+	t.Run("Resume", func(t *testing.T) {
+		w, err := s.Watch("config.", true, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Stop()
+
+		expectEvent(t, w, 4, EventModified, "config.a")
+		expectEvent(t, w, 6, EventDeleted, "config.b")
+		expectNoEvent(t, w)
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		exact.Stop()
+		if _, ok := <-exact.Events(); ok || exact.Err() != ErrWatchStopped {
+			t.Fatalf("Expected watch to be stopped, got: %v", exact.Err())
+		}
+	})
+
+	t.Run("Overflow", func(t *testing.T) {
+		for i := uint64(0); i <= watchBufferSize; i++ {
+			applyCommand(t, f, 10+i, &command{Op: "set", Key: "config.a", Value: []byte{byte(i)}})
+		}
+
+		if prefix.Err() != ErrWatchOverflow {
+			t.Fatalf("Expected slow watch to be dropped, got: %v", prefix.Err())
+		}
+
+		// A dropped watch can resume however many events it missed
+		w, err := s.Watch("config.", true, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Stop()
+
+		for i := uint64(0); i <= watchBufferSize; i++ {
+			expectEvent(t, w, 10+i, EventModified, "config.a")
+		}
+		applyCommand(t, f, 150, &command{Op: "delete", Key: "config.a"})
+		expectEvent(t, w, 150, EventDeleted, "config.a")
+	})
+
+	t.Run("Stop while replaying", func(t *testing.T) {
+		w, err := s.Watch("config.", true, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectEvent(t, w, 10, EventModified, "config.a")
+		w.Stop()
+		for range w.Events() {
+		}
+		if w.Err() != ErrWatchStopped {
+			t.Fatalf("Expected watch to be stopped, got: %v", w.Err())
+		}
+	})
+
+	t.Run("History cleared", func(t *testing.T) {
+		for i := uint64(0); i < watchHistorySize; i++ {
+			applyCommand(t, f, 200+i, &command{Op: "set", Key: "other", Value: []byte{byte(i), byte(i >> 8)}})
+		}
+
+		if _, err := s.Watch("config.", true, 2); err != ErrWatchIndexCleared {
+			t.Fatalf("Expected index to be cleared, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+// Package clienttest provides an in-memory client.Client for testing TCF packages that send and receive
+// payloads, without a queue, server or network.
+package clienttest
+
+import (
+	"sync"
+
+	"github.com/TykTechnologies/tyk-cluster-framework/client"
+	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
+	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+)
+
+// Hub delivers every payload published or broadcast by one of its clients once, straight away and
+// before the call returns, to every handler subscribed to the topic on any of its clients.
+type Hub struct {
+	mu       sync.Mutex
+	handlers map[string][]client.PayloadHandler
+}
+
+// NewHub returns a hub without any subscribers.
+func NewHub() *Hub {
+	return &Hub{handlers: make(map[string][]client.PayloadHandler)}
+}
+
+// Client returns a new client of the hub. Payloads it broadcasts carry a client.SourceAddressHeader
+// of "10.0.0." followed by id, as if each client were on its own host.
+func (h *Hub) Client(id string) *Client {
+	return &Client{hub: h, id: id}
+}
+
+func (h *Hub) subscribers(topic string) []client.PayloadHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.handlers[topic]
+}
+
+// Client is a client.Client connected to a Hub.
+type Client struct {
+	client.ClientHandler
+	hub *Hub
+	id  string
+}
+
+func (c *Client) Connect() error                           { return nil }
+func (c *Client) StopBroadcast(string) error               { return nil }
+func (c *Client) SetEncoding(encoding.Encoding) error      { return nil }
+func (c *Client) Init(interface{}) error                   { return nil }
+func (c *Client) Stop() error                              { return nil }
+func (c *Client) SetConnectionDropHook(func() error) error { return nil }
+func (c *Client) GetID() string                            { return c.id }
+
+// Subscribe adds handler to the handlers of topic, the returned channel is always nil.
+func (c *Client) Subscribe(topic string, handler client.PayloadHandler) (chan string, error) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	c.hub.handlers[topic] = append(c.hub.handlers[topic], handler)
+	return nil, nil
+}
+
+// Publish hands p to every handler subscribed to topic.
+func (c *Client) Publish(topic string, p payloads.Payload) error {
+	for _, h := range c.hub.subscribers(topic) {
+		c.Dispatch(h, p)
+	}
+	return nil
+}
+
+// Broadcast hands each handler subscribed to topic its own copy of p, with the client's source
+// address set. It is delivered once, whatever the interval.
+func (c *Client) Broadcast(topic string, p payloads.Payload, interval int) error {
+	for _, h := range c.hub.subscribers(topic) {
+		cp := p.Copy()
+		cp.SetHeader(client.SourceAddressHeader, "10.0.0."+c.id)
+		c.Dispatch(h, cp)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package metrics provides a Prometheus-compatible registry that the TCF clients, server,
+// bus and distributed store report to. Mount `metrics.Handler()` in the host application
+// (or scrape `/metrics` on the rafty HTTP API) to expose them.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	logger "github.com/TykTechnologies/tykcommon-logger"
+	gometrics "github.com/armon/go-metrics"
+)
+
+var log = logger.GetLogger()
+
+// DefaultRegistry is the registry that all TCF components report to
+var DefaultRegistry *Registry = NewRegistry("tcf")
+
+// Handler returns an http.Handler that renders the default registry
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+// RegisterGlobalSink makes the default registry the global go-metrics sink, this captures the
+// metrics that raft emits internally (commit times, RPC latencies, elections etc.)
+func RegisterGlobalSink() error {
+	conf := gometrics.DefaultConfig("")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+
+	_, err := gometrics.NewGlobal(conf, goMetricsSink{DefaultRegistry})
+	return err
+}
+
+// goMetricsSink passes go-metrics on to a registry. The samples raft emits are all timings in
+// milliseconds, so they are recorded as timings in seconds like our own.
+type goMetricsSink struct {
+	*Registry
+}
+
+func (s goMetricsSink) AddSample(key []string, val float32) {
+	s.observe(s.timerName(key), float64(val)/1000)
+}
+
+// IncrCounter adds val to a counter in the default registry
+func IncrCounter(key []string, val float32) {
+	DefaultRegistry.IncrCounter(key, val)
+}
+
+// SetGauge sets a gauge in the default registry
+func SetGauge(key []string, val float32) {
+	DefaultRegistry.SetGauge(key, val)
+}
+
+// AddGauge adds delta to a gauge in the default registry
+func AddGauge(key []string, delta float32) {
+	DefaultRegistry.AddGauge(key, delta)
+}
+
+// AddSample records an observation in the default registry
+func AddSample(key []string, val float32) {
+	DefaultRegistry.AddSample(key, val)
+}
+
+// MeasureSince records the seconds elapsed since start in the default registry
+func MeasureSince(key []string, start time.Time) {
+	DefaultRegistry.MeasureSince(key, start)
+}
@@ -0,0 +1,264 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type summary struct {
+	count uint64
+	sum   float64
+}
+
+// Registry collects counters, gauges and samples and renders them in the Prometheus
+// text exposition format. It implements the armon/go-metrics MetricSink interface so
+// that it can also be used as the sink for libraries that use go-metrics (e.g. raft).
+//
+// A key part that is a host:port address (e.g. the peer in raft's replication metrics) becomes
+// a `peer` label instead of part of the name, so that every peer shares one metric.
+type Registry struct {
+	Prefix string
+
+	mu       sync.RWMutex
+	counters map[string]float64
+	gauges   map[string]float64
+	samples  map[string]*summary
+}
+
+// NewRegistry will create an empty registry, all metric names are prefixed with `prefix`.
+func NewRegistry(prefix string) *Registry {
+	return &Registry{
+		Prefix:   prefix,
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		samples:  make(map[string]*summary),
+	}
+}
+
+// IncrCounter adds val to a counter
+func (r *Registry) IncrCounter(key []string, val float32) {
+	name := r.counterName(key)
+	r.mu.Lock()
+	r.counters[name] += float64(val)
+	r.mu.Unlock()
+}
+
+// SetGauge sets a gauge to val
+func (r *Registry) SetGauge(key []string, val float32) {
+	name := r.name(key)
+	r.mu.Lock()
+	r.gauges[name] = float64(val)
+	r.mu.Unlock()
+}
+
+// AddGauge adds delta (which can be negative) to a gauge
+func (r *Registry) AddGauge(key []string, delta float32) {
+	name := r.name(key)
+	r.mu.Lock()
+	r.gauges[name] += float64(delta)
+	r.mu.Unlock()
+}
+
+// EmitKey is treated as a gauge, the last emitted value is retained
+func (r *Registry) EmitKey(key []string, val float32) {
+	r.SetGauge(key, val)
+}
+
+// MeasureSince records the time elapsed since start as a sample in seconds, the name of the
+// summary gets a `_seconds` suffix
+func (r *Registry) MeasureSince(key []string, start time.Time) {
+	r.observe(r.timerName(key), time.Since(start).Seconds())
+}
+
+// AddSample records an observation, samples are exposed as summaries (sum and count)
+func (r *Registry) AddSample(key []string, val float32) {
+	r.observe(r.name(key), float64(val))
+}
+
+func (r *Registry) observe(name string, val float64) {
+	r.mu.Lock()
+	s, found := r.samples[name]
+	if !found {
+		s = &summary{}
+		r.samples[name] = s
+	}
+	s.count++
+	s.sum += val
+	r.mu.Unlock()
+}
+
+// Counter returns the current value of a counter, useful for tests and health checks
+func (r *Registry) Counter(key []string) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.counters[r.counterName(key)]
+}
+
+// Gauge returns the current value of a gauge
+func (r *Registry) Gauge(key []string) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.gauges[r.name(key)]
+}
+
+// WriteTo writes all metrics to w in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+
+	r.mu.RLock()
+	var typed string
+	for _, series := range sortedKeys(r.counters) {
+		name, labels := splitSeries(series)
+		writeType(&buf, &typed, name, "counter")
+		fmt.Fprintf(&buf, "%s%s %s\n", name, labels, formatValue(r.counters[series]))
+	}
+	for _, series := range sortedKeys(r.gauges) {
+		name, labels := splitSeries(series)
+		writeType(&buf, &typed, name, "gauge")
+		fmt.Fprintf(&buf, "%s%s %s\n", name, labels, formatValue(r.gauges[series]))
+	}
+
+	sampleNames := make([]string, 0, len(r.samples))
+	for series := range r.samples {
+		sampleNames = append(sampleNames, series)
+	}
+	sortSeries(sampleNames)
+	for _, series := range sampleNames {
+		s := r.samples[series]
+		name, labels := splitSeries(series)
+		writeType(&buf, &typed, name, "summary")
+		fmt.Fprintf(&buf, "%s_sum%s %s\n%s_count%s %d\n", name, labels, formatValue(s.sum), name, labels, s.count)
+	}
+	r.mu.RUnlock()
+
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP makes the registry mountable as a scrape endpoint (e.g. `/metrics`)
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := r.WriteTo(w); err != nil {
+		log.Error("Failed to write metrics: ", err)
+	}
+}
+
+// name returns the series for key, which is the metric name followed by its labels if it has any
+func (r *Registry) name(key []string) string {
+	return r.series(key, "")
+}
+
+// counterName returns the series for a counter, which Prometheus names with a _total suffix
+func (r *Registry) counterName(key []string) string {
+	return r.series(key, "_total")
+}
+
+// timerName returns the series for a timing in seconds
+func (r *Registry) timerName(key []string) string {
+	return r.series(key, "_seconds")
+}
+
+func (r *Registry) series(key []string, suffix string) string {
+	parts := make([]string, 0, len(key)+1)
+	if r.Prefix != "" {
+		parts = append(parts, r.Prefix)
+	}
+
+	peer := ""
+	for _, part := range key {
+		if peer == "" && isAddress(part) {
+			peer = part
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	name := sanitise(strings.Join(parts, "_") + suffix)
+	if peer == "" {
+		return name
+	}
+
+	return name + `{peer="` + escapeLabel(peer) + `"}`
+}
+
+// isAddress reports whether a key part is a host:port address
+func isAddress(part string) bool {
+	_, port, err := net.SplitHostPort(part)
+	if err != nil {
+		return false
+	}
+
+	_, err = strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
+
+// escapeLabel escapes a label value for the text format
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// splitSeries splits a series into the metric name and its labels
+func splitSeries(series string) (string, string) {
+	if i := strings.IndexByte(series, '{'); i >= 0 {
+		return series[:i], series[i:]
+	}
+	return series, ""
+}
+
+// writeType writes the TYPE line of a metric before its first series, series of the same metric
+// sort next to each other
+func writeType(buf *bytes.Buffer, last *string, name, typ string) {
+	if *last == name {
+		return
+	}
+	*last = name
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+}
+
+// sanitise converts a name into a valid Prometheus metric name
+func sanitise(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' ||
+			(c >= 'a' && c <= 'z') ||
+			(c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9' && i > 0)
+		if !valid {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sortSeries(keys)
+	return keys
+}
+
+// sortSeries sorts series by name and then labels, so that the series of a metric are together
+func sortSeries(series []string) {
+	sort.Slice(series, func(i, j int) bool {
+		iName, iLabels := splitSeries(series[i])
+		jName, jLabels := splitSeries(series[j])
+		if iName != jName {
+			return iName < jName
+		}
+		return iLabels < jLabels
+	})
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry("tcf")
+
+	r.IncrCounter([]string{"client", "redis", "published"}, 1)
+	r.IncrCounter([]string{"client", "redis", "published"}, 2)
+	r.SetGauge([]string{"store", "raft", "state"}, 2)
+	r.AddGauge([]string{"server", "mangos", "connections"}, 1)
+	r.AddGauge([]string{"server", "mangos", "connections"}, -1)
+	r.AddSample([]string{"raft", "replication", "heartbeat", "127.0.0.1:11201"}, 4)
+	r.AddSample([]string{"raft", "replication", "heartbeat", "127.0.0.1:11201"}, 6)
+	r.AddSample([]string{"raft", "replication", "heartbeat", "127.0.0.1:11202"}, 1)
+	r.MeasureSince([]string{"client", "handler", "latency"}, time.Now())
+	goMetricsSink{r}.AddSample([]string{"raft", "commitTime"}, 250)
+
+	t.Run("Counter", func(t *testing.T) {
+		if v := r.Counter([]string{"client", "redis", "published"}); v != 3 {
+			t.Fatalf("Expected counter to be 3, got: %v", v)
+		}
+	})
+
+	t.Run("Gauge", func(t *testing.T) {
+		if v := r.Gauge([]string{"server", "mangos", "connections"}); v != 0 {
+			t.Fatalf("Expected gauge to be 0, got: %v", v)
+		}
+	})
+
+	t.Run("Exposition", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		out := buf.String()
+		expected := []string{
+			"# TYPE tcf_client_redis_published_total counter\ntcf_client_redis_published_total 3\n",
+			"# TYPE tcf_store_raft_state gauge\ntcf_store_raft_state 2\n",
+			// Peers are labels of one metric
+			"# TYPE tcf_raft_replication_heartbeat summary\n" +
+				"tcf_raft_replication_heartbeat_sum{peer=\"127.0.0.1:11201\"} 10\n" +
+				"tcf_raft_replication_heartbeat_count{peer=\"127.0.0.1:11201\"} 2\n" +
+				"tcf_raft_replication_heartbeat_sum{peer=\"127.0.0.1:11202\"} 1\n",
+			// Timings are in seconds
+			"# TYPE tcf_client_handler_latency_seconds summary\n",
+			"tcf_raft_commitTime_seconds_sum 0.25\n",
+		}
+
+		for _, e := range expected {
+			if !strings.Contains(out, e) {
+				t.Fatalf("Expected output to contain %q, got:\n%v", e, out)
+			}
+		}
+	})
+
+	t.Run("Handler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+		if w.Code != 200 {
+			t.Fatalf("Unexpected status code: %v", w.Code)
+		}
+
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+			t.Fatalf("Unexpected content type: %v", w.Header().Get("Content-Type"))
+		}
+	})
+}
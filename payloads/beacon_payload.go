@@ -3,6 +3,7 @@ package payloads
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	tykenc "github.com/TykTechnologies/tyk-cluster-framework/encoding"
 	"gopkg.in/vmihailenco/msgpack.v2"
 	"time"
@@ -18,6 +19,8 @@ type MicroPayload struct {
 	TP      string `json:"TP,omitempty"`
 	F     string `json:"F,omitempty"`
 	MI      string `json:"MI,omitempty"`
+	H       map[string]string `json:"H,omitempty"`
+	C       Compression       `json:"C,omitempty"`
 }
 
 // TimeStamp will set the TS of the payload
@@ -50,10 +53,38 @@ func (p *MicroPayload) GetID() string {
 	return p.MI
 }
 
-// Not implemented in MP
+// SetHeader will set a header on the payload envelope
+func (p *MicroPayload) SetHeader(key, value string) {
+	if p.H == nil {
+		p.H = make(map[string]string)
+	}
+	p.H[key] = value
+}
+
+// GetHeader will return the value of a header, or an empty string if it is not set
+func (p *MicroPayload) GetHeader(key string) string {
+	return p.H[key]
+}
+
+// Headers will return a copy of all headers set on the payload
+func (p *MicroPayload) Headers() map[string]string {
+	return copyHeaders(p.H)
+}
+
+// Verify will check the signature if enabled
 func (p *MicroPayload) Verify() error {
+	if p.M == nil {
+		return nil
+	}
 
-	return nil
+	switch p.M.(type) {
+	case []byte:
+		return defaultPayloadConfig.verifier.Verify(signedBytes(p.M.([]byte), p.H), p.S)
+	case string:
+		return defaultPayloadConfig.verifier.Verify(signedBytes([]byte(p.M.(string)), p.H), p.S)
+	default:
+		return fmt.Errorf("Cannot verify payload because not a byte array or string: %v", p.M)
+	}
 }
 
 // Encode will convert the payload into the baseline encoding.Encoding type to send over the wire
@@ -64,10 +95,13 @@ func (p *MicroPayload) Encode() error {
 		if err != nil {
 			return err
 		}
+		if j, p.C, err = compressMessage(j); err != nil {
+			return err
+		}
 		p.M = string(j)
 
 		// Sign
-		p.S, err = defaultPayloadConfig.verifier.Sign(j)
+		p.S, err = defaultPayloadConfig.verifier.Sign(signedBytes(j, p.H))
 		return err
 
 	case tykenc.MPK:
@@ -75,10 +109,13 @@ func (p *MicroPayload) Encode() error {
 		if err != nil {
 			return err
 		}
+		if j, p.C, err = compressMessage(j); err != nil {
+			return err
+		}
 		p.M = string(j)
 
 		// Sign
-		p.S, err = defaultPayloadConfig.verifier.Sign(j)
+		p.S, err = defaultPayloadConfig.verifier.Sign(signedBytes(j, p.H))
 		return err
 
 	case tykenc.NONE:
@@ -94,9 +131,9 @@ func (p *MicroPayload) Encode() error {
 func (p *MicroPayload) getBytes() ([]byte, error) {
 	switch p.M.(type) {
 	case []byte:
-		return p.M.([]byte), nil
+		return decompressMessage(p.M.([]byte), p.C)
 	case string:
-		return []byte(p.M.(string)), nil
+		return decompressMessage([]byte(p.M.(string)), p.C)
 	case nil:
 		return []byte("{}"), nil
 	default:
@@ -155,6 +192,8 @@ func (p *MicroPayload) Copy() Payload {
 		TP:      p.TP,
 		F:     p.From(),
 		MI:      p.MI,
+		H:       copyHeaders(p.H),
+		C:       p.C,
 	}
 
 	return np
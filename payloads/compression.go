@@ -0,0 +1,85 @@
+package payloads
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Compression is the algorithm used to compress a payload message
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+
+	// maxDecompressedSize stops a malicious payload from expanding without limit
+	maxDecompressedSize = 64 << 20
+)
+
+// SetCompression will compress payload messages that are at least threshold bytes once encoded, use
+// CompressionNone to disable it (the default). Compressed payloads are flagged in the envelope, so
+// receivers can always decode them regardless of their own settings.
+func SetCompression(c Compression, threshold int) error {
+	switch c {
+	case CompressionNone, CompressionGzip:
+	default:
+		return fmt.Errorf("Compression %q is not supported", c)
+	}
+
+	defaultPayloadConfig.compression = c
+	defaultPayloadConfig.compressionThreshold = threshold
+	return nil
+}
+
+// compressMessage will compress an encoded message if compression is enabled and the message is
+// over the threshold. Compressed messages are base64 encoded as they are carried as a string.
+func compressMessage(msg []byte) ([]byte, Compression, error) {
+	c := defaultPayloadConfig.compression
+	if c == CompressionNone || len(msg) < defaultPayloadConfig.compressionThreshold {
+		return msg, CompressionNone, nil
+	}
+
+	var buf bytes.Buffer
+	b64 := base64.NewEncoder(base64.StdEncoding, &buf)
+	zw := gzip.NewWriter(b64)
+	if _, err := zw.Write(msg); err != nil {
+		return nil, c, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, c, err
+	}
+	if err := b64.Close(); err != nil {
+		return nil, c, err
+	}
+
+	return buf.Bytes(), c, nil
+}
+
+func decompressMessage(msg []byte, c Compression) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return msg, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(msg)))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		out, err := ioutil.ReadAll(io.LimitReader(zr, maxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > maxDecompressedSize {
+			return nil, fmt.Errorf("Decompressed message exceeds %d bytes", maxDecompressedSize)
+		}
+
+		return out, nil
+	default:
+		return nil, fmt.Errorf("Compression %q is not supported", c)
+	}
+}
@@ -0,0 +1,70 @@
+package payloads
+
+import (
+	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	if err := SetCompression(CompressionGzip, 128); err != nil {
+		t.Fatal(err)
+	}
+	defer SetCompression(CompressionNone, 0)
+
+	large := testPayloadData{FullName: strings.Repeat("policy-sync ", 500)}
+
+	constructors := map[string]func(interface{}) (Payload, error){
+		"DefaultPayload": NewPayload,
+		"MicroPayload":   NewMicroPayload,
+	}
+
+	for name, newPayload := range constructors {
+		for _, enc := range []encoding.Encoding{encoding.JSON, encoding.MPK} {
+			t.Run(name+" "+string(enc), func(t *testing.T) {
+				p, _ := newPayload(large)
+				p.SetEncoding(enc)
+
+				v, err := Marshal(p, enc)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(v.([]byte)) > len(large.FullName)/4 {
+					t.Fatalf("Payload was not compressed, size: %v", len(v.([]byte)))
+				}
+
+				into, _ := newPayload(struct{}{})
+				if err = Unmarshal(into, v, enc); err != nil {
+					t.Fatal(err)
+				}
+
+				if err = into.Verify(); err != nil {
+					t.Fatalf("Verification should pass: %v", err)
+				}
+
+				var d testPayloadData
+				if err = into.DecodeMessage(&d); err != nil {
+					t.Fatal(err)
+				}
+
+				if d.FullName != large.FullName {
+					t.Fatal("Decompressed message is wrong")
+				}
+			})
+		}
+	}
+
+	t.Run("Below threshold", func(t *testing.T) {
+		p, _ := NewPayload(testPayloadData{FullName: "Foo"})
+		if p.(*DefaultPayload).Compression != CompressionNone {
+			t.Fatal("Small payloads should not be compressed")
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		if err := SetCompression("lz4", 0); err == nil {
+			t.Fatal("Unsupported compression should be rejected")
+		}
+	})
+}
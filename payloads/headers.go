@@ -0,0 +1,48 @@
+package payloads
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+func copyHeaders(h map[string]string) map[string]string {
+	if h == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(h))
+	for k, v := range h {
+		c[k] = v
+	}
+
+	return c
+}
+
+// signedBytes appends the headers to the message in a canonical form so that they are covered by
+// the signature. Payloads without headers sign the message only, which keeps them compatible
+// with older nodes.
+func signedBytes(msg []byte, headers map[string]string) []byte {
+	if len(headers) == 0 {
+		return msg
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Length-prefix every key and value so that the boundaries can't be shifted
+	var buf bytes.Buffer
+	buf.Write(msg)
+	for _, k := range keys {
+		for _, s := range []string{k, headers[k]} {
+			buf.WriteString(strconv.Itoa(len(s)))
+			buf.WriteByte(':')
+			buf.WriteString(s)
+		}
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,72 @@
+package payloads
+
+import (
+	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	constructors := map[string]func(interface{}) (Payload, error){
+		"DefaultPayload": NewPayload,
+		"MicroPayload":   NewMicroPayload,
+	}
+
+	for name, newPayload := range constructors {
+		for _, enc := range []encoding.Encoding{encoding.JSON, encoding.MPK} {
+			t.Run(name+" "+string(enc), func(t *testing.T) {
+				p, err := newPayload(testPayloadData{FullName: "Foo"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				p.SetEncoding(enc)
+				p.SetHeader("tenant", "acme")
+				p.SetHeader("content-type", "application/json")
+
+				v, err := Marshal(p, enc)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				into, _ := newPayload(struct{}{})
+				if err = Unmarshal(into, v, enc); err != nil {
+					t.Fatal(err)
+				}
+
+				if into.GetHeader("tenant") != "acme" {
+					t.Fatalf("Header was not decoded: %v", into.Headers())
+				}
+
+				if len(into.Headers()) != 2 {
+					t.Fatalf("Expected 2 headers, got: %v", into.Headers())
+				}
+
+				if err = into.Verify(); err != nil {
+					t.Fatalf("Verification should pass: %v", err)
+				}
+
+				into.SetHeader("tenant", "other")
+				if err = into.Verify(); err == nil {
+					t.Fatal("Verification should fail when a header is changed")
+				}
+			})
+		}
+	}
+
+	t.Run("Copy", func(t *testing.T) {
+		p, _ := NewPayload(testPayloadData{FullName: "Foo"})
+		p.SetHeader("tenant", "acme")
+
+		c := p.Copy()
+		c.SetHeader("tenant", "other")
+
+		if p.GetHeader("tenant") != "acme" {
+			t.Fatal("Headers should not be shared between copies")
+		}
+	})
+
+	t.Run("No headers", func(t *testing.T) {
+		if string(signedBytes([]byte("msg"), nil)) != "msg" {
+			t.Fatal("Payloads without headers should sign the message only")
+		}
+	})
+}
@@ -0,0 +1,5 @@
+package payloads
+
+type testPayloadData struct {
+	FullName string
+}
@@ -3,8 +3,10 @@ package payloads
 import "github.com/TykTechnologies/tyk-cluster-framework/verifier"
 
 type config struct {
-	verifier    verifier.Verifier
-	payloadType PayloadType
+	verifier             verifier.Verifier
+	payloadType          PayloadType
+	compression          Compression
+	compressionThreshold int
 }
 
 var defaultPayloadConfig config = config{}
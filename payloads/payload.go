@@ -23,18 +23,23 @@ type Payload interface {
 	SetFrom(string)
 	GetID() string
 	SetData(interface{})
+	SetHeader(string, string)
+	GetHeader(string) string
+	Headers() map[string]string
 }
 
 // DefaultPayload is the default payload that is used by TCF
 type DefaultPayload struct {
-	Message    interface{}
-	rawMessage interface{}
-	Encoding   tykenc.Encoding
-	Sig        string
-	Time       int64
-	Topic      string
-	FromID     string
-	MsgID      string
+	Message     interface{}
+	rawMessage  interface{}
+	Encoding    tykenc.Encoding
+	Sig         string
+	Time        int64
+	Topic       string
+	FromID      string
+	MsgID       string
+	Header      map[string]string
+	Compression Compression
 }
 
 // TimeStamp will set the TS of the payload
@@ -62,6 +67,26 @@ func (p *DefaultPayload) GetID() string {
 	return p.MsgID
 }
 
+// SetHeader will set a header on the payload envelope, headers travel with the payload
+// but are not part of the message. Headers are covered by the signature, so they must
+// be set before the payload is encoded.
+func (p *DefaultPayload) SetHeader(key, value string) {
+	if p.Header == nil {
+		p.Header = make(map[string]string)
+	}
+	p.Header[key] = value
+}
+
+// GetHeader will return the value of a header, or an empty string if it is not set
+func (p *DefaultPayload) GetHeader(key string) string {
+	return p.Header[key]
+}
+
+// Headers will return a copy of all headers set on the payload
+func (p *DefaultPayload) Headers() map[string]string {
+	return copyHeaders(p.Header)
+}
+
 // Verify will check the signature if enabled
 func (p *DefaultPayload) Verify() error {
 	if p.Message == nil {
@@ -70,9 +95,9 @@ func (p *DefaultPayload) Verify() error {
 
 	switch p.Message.(type) {
 	case []byte:
-		return defaultPayloadConfig.verifier.Verify(p.Message.([]byte), p.Sig)
+		return defaultPayloadConfig.verifier.Verify(signedBytes(p.Message.([]byte), p.Header), p.Sig)
 	case string:
-		return defaultPayloadConfig.verifier.Verify([]byte(p.Message.(string)), p.Sig)
+		return defaultPayloadConfig.verifier.Verify(signedBytes([]byte(p.Message.(string)), p.Header), p.Sig)
 	default:
 		return fmt.Errorf("Cannot verify payload because not a byte array or string: %v", p.Message)
 	}
@@ -93,10 +118,13 @@ func (p *DefaultPayload) Encode() error {
 		if err != nil {
 			return err
 		}
+		if j, p.Compression, err = compressMessage(j); err != nil {
+			return err
+		}
 		p.Message = string(j)
 
 		// Sign
-		p.Sig, err = defaultPayloadConfig.verifier.Sign(j)
+		p.Sig, err = defaultPayloadConfig.verifier.Sign(signedBytes(j, p.Header))
 		return err
 
 	case tykenc.MPK:
@@ -104,10 +132,13 @@ func (p *DefaultPayload) Encode() error {
 		if err != nil {
 			return err
 		}
+		if j, p.Compression, err = compressMessage(j); err != nil {
+			return err
+		}
 		p.Message = string(j)
 
 		// Sign
-		p.Sig, err = defaultPayloadConfig.verifier.Sign(j)
+		p.Sig, err = defaultPayloadConfig.verifier.Sign(signedBytes(j, p.Header))
 		return err
 
 	case tykenc.NONE:
@@ -123,9 +154,9 @@ func (p *DefaultPayload) Encode() error {
 func (p *DefaultPayload) getBytes() ([]byte, error) {
 	switch p.Message.(type) {
 	case []byte:
-		return p.Message.([]byte), nil
+		return decompressMessage(p.Message.([]byte), p.Compression)
 	case string:
-		return []byte(p.Message.(string)), nil
+		return decompressMessage([]byte(p.Message.(string)), p.Compression)
 	case nil:
 		return []byte("{}"), nil
 	default:
@@ -176,14 +207,16 @@ func (p *DefaultPayload) SetEncoding(enc tykenc.Encoding) {
 // Copy will create a copy of the object
 func (p *DefaultPayload) Copy() Payload {
 	np := &DefaultPayload{
-		Message:    p.Message,
-		rawMessage: p.rawMessage,
-		Encoding:   p.Encoding,
-		Sig:        p.Sig,
-		Time:       p.Time,
-		Topic:      p.Topic,
-		FromID:     p.From(),
-		MsgID:      p.MsgID,
+		Message:     p.Message,
+		rawMessage:  p.rawMessage,
+		Encoding:    p.Encoding,
+		Sig:         p.Sig,
+		Time:        p.Time,
+		Topic:       p.Topic,
+		FromID:      p.From(),
+		MsgID:       p.MsgID,
+		Header:      copyHeaders(p.Header),
+		Compression: p.Compression,
 	}
 
 	return np
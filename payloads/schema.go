@@ -0,0 +1,103 @@
+package payloads
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// SchemaTypeHeader is the header that declares the type of the message carried by a payload
+const SchemaTypeHeader = "tcf-schema-type"
+
+// SchemaMismatchError is returned when a payload declares a different type to the one
+// registered for its topic
+type SchemaMismatchError struct {
+	Topic    string
+	Expected string
+	Declared string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("Payload on topic %v declares schema type %q, expected %q", e.Topic, e.Declared, e.Expected)
+}
+
+var topicTypes = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// RegisterTopicType declares the schema type that all payloads on a topic must carry
+func RegisterTopicType(topic, schemaType string) {
+	topicTypes.Lock()
+	topicTypes.m[topic] = schemaType
+	topicTypes.Unlock()
+}
+
+// UnregisterTopicType removes the schema type for a topic, payloads on it will no longer be checked
+func UnregisterTopicType(topic string) {
+	topicTypes.Lock()
+	delete(topicTypes.m, topic)
+	topicTypes.Unlock()
+}
+
+// TopicType returns the schema type registered for a topic
+func TopicType(topic string) (string, bool) {
+	topicTypes.RLock()
+	defer topicTypes.RUnlock()
+
+	t, found := topicTypes.m[topic]
+	return t, found
+}
+
+// SchemaTypeOf returns the schema type name for a value, this is the fully qualified Go type name
+// as it would be imported, so that a type has the same name whether or not a service vendors it
+func SchemaTypeOf(v interface{}) string {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return ""
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.PkgPath() == "" || t.Name() == "" {
+		return t.String()
+	}
+
+	return importPath(t.PkgPath()) + "." + t.Name()
+}
+
+// importPath strips the vendor directory, if any, from a package path
+func importPath(pkgPath string) string {
+	if strings.HasPrefix(pkgPath, "vendor/") {
+		return strings.TrimPrefix(pkgPath, "vendor/")
+	}
+	if i := strings.LastIndex(pkgPath, "/vendor/"); i >= 0 {
+		return pkgPath[i+len("/vendor/"):]
+	}
+
+	return pkgPath
+}
+
+// SetSchemaType will declare the schema type of the payload's message
+func SetSchemaType(p Payload, schemaType string) {
+	p.SetHeader(SchemaTypeHeader, schemaType)
+}
+
+// CheckSchemaType will return a *SchemaMismatchError if a schema type is registered for topic
+// and the payload does not declare the same type. Topics without a registered type always pass.
+func CheckSchemaType(topic string, p Payload) error {
+	expected, found := TopicType(topic)
+	if !found {
+		return nil
+	}
+
+	declared := p.GetHeader(SchemaTypeHeader)
+	if declared != expected {
+		return &SchemaMismatchError{Topic: topic, Expected: expected, Declared: declared}
+	}
+
+	return nil
+}
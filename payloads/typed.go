@@ -0,0 +1,39 @@
+//go:build go1.18
+// +build go1.18
+
+package payloads
+
+// SchemaType returns the schema type name for T
+func SchemaType[T any]() string {
+	return SchemaTypeOf((*T)(nil))
+}
+
+// RegisterTopic declares that all payloads on topic must carry a T
+func RegisterTopic[T any](topic string) {
+	RegisterTopicType(topic, SchemaType[T]())
+}
+
+// New will create a payload for msg that declares its schema type
+func New[T any](msg T) (Payload, error) {
+	p, err := NewPayload(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	SetSchemaType(p, SchemaType[T]())
+	return p, nil
+}
+
+// Decode will decode the message of a payload into a T. Payloads that declare a different schema
+// type are rejected, payloads that do not declare one are decoded as-is.
+func Decode[T any](p Payload) (T, error) {
+	var msg T
+
+	expected := SchemaType[T]()
+	if declared := p.GetHeader(SchemaTypeHeader); declared != "" && declared != expected {
+		return msg, &SchemaMismatchError{Topic: p.GetTopic(), Expected: expected, Declared: declared}
+	}
+
+	err := p.DecodeMessage(&msg)
+	return msg, err
+}
@@ -0,0 +1,71 @@
+//go:build go1.18
+// +build go1.18
+
+package payloads
+
+import "testing"
+
+type otherPayloadData struct {
+	Count int
+}
+
+func TestTyped(t *testing.T) {
+	p, err := New(testPayloadData{FullName: "Foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Schema type header", func(t *testing.T) {
+		expected := "github.com/TykTechnologies/tyk-cluster-framework/payloads.testPayloadData"
+		if p.GetHeader(SchemaTypeHeader) != expected {
+			t.Fatalf("Unexpected schema type: %v", p.GetHeader(SchemaTypeHeader))
+		}
+
+		// Services that vendor the type still agree on its name
+		vendored := "example.com/service/vendor/github.com/TykTechnologies/tyk-cluster-framework/payloads"
+		if importPath(vendored) != "github.com/TykTechnologies/tyk-cluster-framework/payloads" {
+			t.Fatalf("Vendor directory was not stripped: %v", importPath(vendored))
+		}
+	})
+
+	t.Run("Decode", func(t *testing.T) {
+		d, err := Decode[testPayloadData](p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.FullName != "Foo" {
+			t.Fatalf("Value is wrong: %v", d.FullName)
+		}
+	})
+
+	t.Run("Decode mismatch", func(t *testing.T) {
+		if _, err := Decode[otherPayloadData](p); err == nil {
+			t.Fatal("Decoding into a different type should fail")
+		}
+	})
+
+	t.Run("Topic registry", func(t *testing.T) {
+		RegisterTopic[testPayloadData]("test.typed")
+		defer UnregisterTopicType("test.typed")
+
+		if err := CheckSchemaType("test.typed", p); err != nil {
+			t.Fatal(err)
+		}
+
+		other, _ := New(otherPayloadData{Count: 1})
+		err := CheckSchemaType("test.typed", other)
+		if _, ok := err.(*SchemaMismatchError); !ok {
+			t.Fatalf("Expected a schema mismatch, got: %v", err)
+		}
+
+		untyped, _ := NewPayload(testPayloadData{FullName: "Foo"})
+		if err := CheckSchemaType("test.typed", untyped); err == nil {
+			t.Fatal("Payloads without a schema type should be rejected on a typed topic")
+		}
+
+		if err := CheckSchemaType("test.untyped", other); err != nil {
+			t.Fatal("Topics without a registered type should not be checked")
+		}
+	})
+}
@@ -22,6 +22,15 @@ func Unmarshal(into Payload, data interface{}, enc tykenc.Encoding) error {
 }
 
 func unmarshalMPK(into Payload, data interface{}) error {
+	// msgpack decodes into the existing message value, which fails if the payload was
+	// constructed with a placeholder message, so clear it first
+	switch p := into.(type) {
+	case *DefaultPayload:
+		p.Message = nil
+	case *MicroPayload:
+		p.M = nil
+	}
+
 	decErr := msgpack.Unmarshal(data.([]byte), into)
 	return decErr
 }
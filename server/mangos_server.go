@@ -6,7 +6,9 @@ import (
 	"github.com/TykTechnologies/logrus"
 	"github.com/TykTechnologies/tyk-cluster-framework/encoding"
 	"github.com/TykTechnologies/tyk-cluster-framework/helpers"
+	"github.com/TykTechnologies/tyk-cluster-framework/metrics"
 	"github.com/TykTechnologies/tyk-cluster-framework/payloads"
+	"github.com/TykTechnologies/tyk-cluster-framework/tracing"
 	"github.com/go-mangos/mangos"
 	"github.com/go-mangos/mangos/protocol/pub"
 	"github.com/go-mangos/mangos/protocol/sub"
@@ -112,7 +114,10 @@ func (s *MangosServer) onPortAction(action mangos.PortAction, data mangos.Port)
 			}).Error("Could not handle conneciton add: ", err)
 			return false
 		}
+		// Rejected ports are closed without being removed, so only count the ones we keep
+		metrics.AddGauge([]string{"server", "mangos", "connections"}, 1)
 	case mangos.PortActionRemove:
+		metrics.AddGauge([]string{"server", "mangos", "connections"}, -1)
 		if err = s.handleRemoveConnection(data); err != nil {
 			log.WithFields(logrus.Fields{
 				"prefix": "tcf.MangosServer",
@@ -148,6 +153,8 @@ func (s *MangosServer) receiveAndRelay(sock *socketMap, id string) {
 			}).Errorf("[ReceiveAndRelay] Failed relay: ", pubErr.Error())
 		}
 		log.Debug("[SERVER] Relayed: ", string(msg))
+		metrics.IncrCounter([]string{"server", "mangos", "relayed"}, 1)
+		metrics.IncrCounter([]string{"server", "mangos", "relayed_bytes"}, float32(len(msg)))
 
 		if s.onPublishHook != nil {
 			s.onPublishHook([]byte{}, msg)
@@ -340,6 +347,8 @@ func (s *MangosServer) startPullListener() error {
 			}).Errorf("[ReceiveAndRelay] Failed relay: ", pubErr.Error())
 		}
 		log.Debug("[SERVER] Relayed: ", string(msg))
+		metrics.IncrCounter([]string{"server", "mangos", "relayed"}, 1)
+		metrics.IncrCounter([]string{"server", "mangos", "relayed_bytes"}, float32(len(msg)))
 
 		if s.onPublishHook != nil {
 			s.onPublishHook([]byte{}, msg)
@@ -489,6 +498,15 @@ func (s *MangosServer) doPublish(filter string, payload payloads.Payload, withHo
 		payload.SetFrom(s.GetID())
 	}
 
+	operation := "publish "
+	if !withHook {
+		operation = "relay "
+	}
+
+	payload = payload.Copy()
+	span := tracing.StartProducer(payload, operation+filter)
+	defer span.End()
+
 	data, encErr := payloads.Marshal(payload, s.encoding)
 	if encErr != nil {
 		return encErr
@@ -519,6 +537,9 @@ func (s *MangosServer) doPublish(filter string, payload payloads.Payload, withHo
 		return fmt.Errorf("Failed publishing: %s", pubErr.Error())
 	}
 
+	metrics.IncrCounter([]string{"server", "mangos", "published"}, 1)
+	metrics.IncrCounter([]string{"server", "mangos", "published_bytes"}, float32(len(asPayload)))
+
 	if withHook {
 		// DEBUG: This is not causing duplicates - confirmed
 		if s.onPublishHook != nil {
@@ -6,6 +6,14 @@ echo "Testing verifier/"
 cd verifier
 go test -v
 cd ..
+echo "Testing metrics/"
+cd metrics
+go test -v
+cd ..
+echo "Testing tracing/"
+cd tracing
+go test -v
+cd ..
 echo "Testing client/"
 cd client
 go test -v
@@ -14,10 +22,22 @@ echo "Testing client/beacon"
 cd client/beacon
 go test -v
 cd ../..
+echo "Testing client/gossip"
+cd client/gossip
+go test -v
+cd ../..
+echo "Testing discovery/"
+cd discovery
+go test -v
+cd ..
 echo "Testing server/"
 cd server
 go test -v
 cd ..
+echo "Testing distributed_store/rafty/store"
+cd distributed_store/rafty/store
+go test -v
+cd ../../..
 echo "Testing distributed_store/"
 cd distributed_store
 go test -v
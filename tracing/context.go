@@ -0,0 +1,158 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	// TraceParentHeader is the W3C trace context header name
+	TraceParentHeader = "traceparent"
+	// BaggageHeader is the W3C baggage header name
+	BaggageHeader = "baggage"
+
+	traceParentVersion = "00"
+	flagSampled        = 0x01
+)
+
+// TraceID identifies a trace across all of the hops it takes
+type TraceID [16]byte
+
+// SpanID identifies a single span within a trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// SpanContext is the part of a span that is propagated between processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+}
+
+// IsValid reports whether the context has both a trace and a span ID
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// IsSampled reports whether the sampled flag is set
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&flagSampled == flagSampled
+}
+
+// TraceParent renders the context as a W3C traceparent header value
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceParentVersion, sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceParent parses a W3C traceparent header value
+func ParseTraceParent(v string) (SpanContext, error) {
+	sc := SpanContext{}
+
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 {
+		return sc, errors.New("traceparent must have four fields")
+	}
+
+	if len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("unsupported traceparent version: %v", parts[0])
+	}
+
+	// Version 00 has exactly four fields, future versions may append more
+	if parts[0] == traceParentVersion && len(parts) != 4 {
+		return sc, errors.New("traceparent version 00 must have four fields")
+	}
+
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return sc, fmt.Errorf("invalid trace ID: %v", err)
+	}
+
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return sc, fmt.Errorf("invalid span ID: %v", err)
+	}
+
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, fmt.Errorf("invalid trace flags: %v", err)
+	}
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return SpanContext{}, errors.New("traceparent has an all-zero trace or span ID")
+	}
+
+	return sc, nil
+}
+
+func decodeHex(into []byte, v string) error {
+	if len(v) != len(into)*2 || strings.ToLower(v) != v {
+		return fmt.Errorf("expected %d lower-case hex characters", len(into)*2)
+	}
+
+	_, err := hex.Decode(into, []byte(v))
+	return err
+}
+
+// Baggage is a set of key/value pairs that travel with the trace
+type Baggage map[string]string
+
+// String renders the baggage as a W3C baggage header value
+func (b Baggage) String() string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	members := make([]string, len(keys))
+	for i, k := range keys {
+		members[i] = k + "=" + url.PathEscape(b[k])
+	}
+
+	return strings.Join(members, ",")
+}
+
+// ParseBaggage parses a W3C baggage header value, malformed members are skipped
+func ParseBaggage(v string) Baggage {
+	b := Baggage{}
+	for _, member := range strings.Split(v, ",") {
+		// Drop any properties, we only propagate the key and value
+		member = strings.SplitN(member, ";", 2)[0]
+
+		kv := strings.SplitN(member, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			continue
+		}
+
+		value, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			continue
+		}
+		b[key] = value
+	}
+
+	return b
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	rand.Read(t[:])
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	rand.Read(s[:])
+	return s
+}
@@ -0,0 +1,167 @@
+// Package tracing propagates W3C trace context (traceparent and baggage) through TCF payload
+// headers so that a trace started by a request on one node can be followed across the cluster.
+//
+// TCF does not ship an OpenTelemetry SDK, instead the host application can plug its own tracer
+// in with SetTracer. The default tracer only generates IDs, which is enough to keep the trace
+// context intact across hops.
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// SpanKind describes the relationship between a span and the message it belongs to
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+// Carrier is anything that can hold propagation headers, TCF payloads implement this
+type Carrier interface {
+	SetHeader(key, value string)
+	GetHeader(key string) string
+}
+
+// Span is a single unit of work in a trace
+type Span interface {
+	Context() SpanContext
+	SetAttribute(key string, value interface{})
+	End()
+}
+
+// Tracer starts spans, the parent (if any) is taken from ctx
+type Tracer interface {
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+type contextKey int
+
+const (
+	spanContextKey contextKey = iota
+	baggageKey
+)
+
+var (
+	tracerMu sync.RWMutex
+	tracer   Tracer = idTracer{}
+)
+
+// SetTracer replaces the tracer used to create spans, pass nil to restore the default
+func SetTracer(t Tracer) {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+
+	if t == nil {
+		t = idTracer{}
+	}
+	tracer = t
+}
+
+// GetTracer returns the tracer currently in use
+func GetTracer() Tracer {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+	return tracer
+}
+
+// ContextWithSpanContext returns a copy of ctx that carries sc
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, it is invalid if there is none
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey).(SpanContext)
+	return sc
+}
+
+// ContextWithBaggage returns a copy of ctx that carries b
+func ContextWithBaggage(ctx context.Context, b Baggage) context.Context {
+	return context.WithValue(ctx, baggageKey, b)
+}
+
+// BaggageFromContext returns the baggage carried by ctx
+func BaggageFromContext(ctx context.Context) Baggage {
+	b, _ := ctx.Value(baggageKey).(Baggage)
+	return b
+}
+
+// Inject writes the trace context in ctx into the carrier's headers
+func Inject(ctx context.Context, c Carrier) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		c.SetHeader(TraceParentHeader, sc.TraceParent())
+	}
+
+	if b := BaggageFromContext(ctx); len(b) > 0 {
+		c.SetHeader(BaggageHeader, b.String())
+	}
+}
+
+// Extract reads the trace context from the carrier's headers into a copy of ctx
+func Extract(ctx context.Context, c Carrier) context.Context {
+	if tp := c.GetHeader(TraceParentHeader); tp != "" {
+		if sc, err := ParseTraceParent(tp); err == nil {
+			ctx = ContextWithSpanContext(ctx, sc)
+		}
+	}
+
+	if bg := c.GetHeader(BaggageHeader); bg != "" {
+		if b := ParseBaggage(bg); len(b) > 0 {
+			ctx = ContextWithBaggage(ctx, b)
+		}
+	}
+
+	return ctx
+}
+
+// StartProducer starts a producer span as a child of the context in the carrier, and replaces
+// that context with the new span so the consumer becomes its child. Callers should pass a copy
+// of any payload they do not own.
+func StartProducer(c Carrier, name string) Span {
+	return startFromCarrier(c, name, SpanKindProducer)
+}
+
+// StartConsumer starts a consumer span as a child of the producer span in the carrier, and
+// replaces the context so that handlers reading it with Extract continue the trace
+func StartConsumer(c Carrier, name string) Span {
+	return startFromCarrier(c, name, SpanKindConsumer)
+}
+
+func startFromCarrier(c Carrier, name string, kind SpanKind) Span {
+	ctx, span := GetTracer().Start(Extract(context.Background(), c), name, kind)
+	Inject(ctx, c)
+
+	return span
+}
+
+// idTracer is the default tracer, it records nothing but keeps the trace IDs flowing
+type idTracer struct{}
+
+func (idTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{
+		TraceID: parent.TraceID,
+		SpanID:  newSpanID(),
+		Flags:   parent.Flags,
+	}
+
+	if !parent.IsValid() {
+		sc.TraceID = newTraceID()
+		sc.Flags = flagSampled
+	}
+
+	return ContextWithSpanContext(ctx, sc), idSpan{sc: sc}
+}
+
+type idSpan struct {
+	sc SpanContext
+}
+
+func (s idSpan) Context() SpanContext                       { return s.sc }
+func (s idSpan) SetAttribute(key string, value interface{}) {}
+func (s idSpan) End()                                       {}
@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+type mapCarrier map[string]string
+
+func (m mapCarrier) SetHeader(key, value string) { m[key] = value }
+func (m mapCarrier) GetHeader(key string) string { return m[key] }
+
+func TestTraceParent(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		v := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		sc, err := ParseTraceParent(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !sc.IsSampled() {
+			t.Fatal("Expected context to be sampled")
+		}
+
+		if sc.TraceParent() != v {
+			t.Fatalf("Expected %v, got: %v", v, sc.TraceParent())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		invalid := []string{
+			"",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		}
+
+		for _, v := range invalid {
+			if _, err := ParseTraceParent(v); err == nil {
+				t.Fatalf("Expected %q to be rejected", v)
+			}
+		}
+	})
+}
+
+func TestBaggage(t *testing.T) {
+	b := ParseBaggage("tenant=acme, request=a%20b;prop=1,broken")
+	if len(b) != 2 {
+		t.Fatalf("Expected 2 members, got: %v", b)
+	}
+
+	if b["request"] != "a b" {
+		t.Fatalf("Unexpected value for request: %q", b["request"])
+	}
+
+	if b.String() != "request=a%20b,tenant=acme" {
+		t.Fatalf("Unexpected header value: %v", b.String())
+	}
+
+	// Other implementations don't decode + as a space, so it has to survive as itself
+	b = ParseBaggage(Baggage{"sum": "1+1", "list": "a,b;c"}.String())
+	if b["sum"] != "1+1" || b["list"] != "a,b;c" {
+		t.Fatalf("Values did not round trip: %v", b)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	root, _ := GetTracer().Start(context.Background(), "request", SpanKindInternal)
+	root = ContextWithBaggage(root, Baggage{"tenant": "acme"})
+	rootSC := SpanContextFromContext(root)
+
+	c := mapCarrier{}
+	Inject(root, c)
+
+	producer := StartProducer(c, "publish test")
+	producer.End()
+
+	if producer.Context().TraceID != rootSC.TraceID {
+		t.Fatal("Producer span should continue the trace")
+	}
+
+	if producer.Context().SpanID == rootSC.SpanID {
+		t.Fatal("Producer span should have its own span ID")
+	}
+
+	consumer := StartConsumer(c, "process test")
+	consumer.End()
+
+	if consumer.Context().TraceID != rootSC.TraceID {
+		t.Fatal("Consumer span should continue the trace")
+	}
+
+	ctx := Extract(context.Background(), c)
+	if SpanContextFromContext(ctx) != consumer.Context() {
+		t.Fatal("Handler context should be the consumer span")
+	}
+
+	if BaggageFromContext(ctx)["tenant"] != "acme" {
+		t.Fatalf("Baggage was not propagated: %v", BaggageFromContext(ctx))
+	}
+}
+
+func TestNewRoot(t *testing.T) {
+	c := mapCarrier{}
+	span := StartProducer(c, "publish test")
+
+	if !span.Context().IsValid() {
+		t.Fatal("Expected a new root span")
+	}
+
+	if c.GetHeader(TraceParentHeader) != span.Context().TraceParent() {
+		t.Fatalf("Carrier should hold the new span: %v", c)
+	}
+}